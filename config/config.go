@@ -3,25 +3,88 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultJwtSecret is the built-in JWT secret. It is public, so the app
+// refuses to start with it outside of development mode.
+const DefaultJwtSecret = "secret"
+
 type Config struct {
-	ServerAddr      string
-	BaseURL         string
-	FileStoragePath string
-	DatabaseDSN     string
-	JwtSecret       string
+	ServerAddr         string
+	BaseURL            string
+	FileStoragePath    string
+	DatabaseDSN        string
+	JwtSecret          string
+	ComingSoonPage     bool
+	GeoIPDBPath        string
+	Analytics          bool
+	FetchMetadata      bool
+	Interstitial       bool
+	AllowedDomains     []string
+	TrustedRole        string
+	InterstitialDelay  int
+	RedirectStatus     int
+	RedirectMaxAge     time.Duration
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCPostLoginURL   string
+	JWTKeyFile         string
+	JWTRetiredKeyFiles []string
+	Dev                bool
+	CookieDomain       string
+	CookiePath         string
+	CookieSecure       bool
+	CookieSameSite     string
+	TrustedOrigins     []string
+	RateLimitShorten   string
+	RateLimitRedirect  string
+	RateLimitRead      string
+	RateLimitAuth      string
+	DailyLinkQuota     int64
+	MaxBatchSize       int
+	LinkCacheSize      int
+	LinkCacheTTL       time.Duration
+	// LinkCacheNegativeTTL is how long unknown links are cached.
+	LinkCacheNegativeTTL time.Duration
+	// MetricsAddr serves the metrics apart from the app, MetricsToken
+	// guards them. Metrics are off without either.
+	MetricsAddr  string
+	MetricsToken string
+	// ReservedDomains serve the default domain along with the host of the
+	// base URL, so they cannot be registered as custom domains.
+	ReservedDomains []string
+	// ProxyHeader holds the client IP, such as X-Real-IP. It is only read
+	// from requests of TrustedProxies, IPs or CIDR ranges of the load
+	// balancers, which must overwrite it.
+	ProxyHeader    string
+	TrustedProxies []string
 }
 
 type Option func(*Config)
 
 func New(opts ...Option) *Config {
 	cfg := &Config{
-		ServerAddr:      ":8080",
-		BaseURL:         "http://localhost:8080",
-		FileStoragePath: "/tmp/short-url-db.json",
-		DatabaseDSN:     "",
-		JwtSecret:       "secret",
+		ServerAddr:           ":8080",
+		BaseURL:              "http://localhost:8080",
+		FileStoragePath:      "/tmp/short-url-db.json",
+		DatabaseDSN:          "",
+		JwtSecret:            DefaultJwtSecret,
+		InterstitialDelay:    5,
+		RedirectStatus:       307,
+		RedirectMaxAge:       time.Hour,
+		OIDCPostLoginURL:     "/api/user",
+		CookiePath:           "/",
+		CookieSameSite:       "Lax",
+		RateLimitAuth:        "10/1m",
+		MaxBatchSize:         1000,
+		LinkCacheSize:        10000,
+		LinkCacheTTL:         time.Minute,
+		LinkCacheNegativeTTL: 10 * time.Second,
 	}
 
 	for _, opt := range opts {
@@ -61,12 +124,214 @@ func WithJwtSecret(secret string) Option {
 	}
 }
 
+func WithComingSoonPage(enabled bool) Option {
+	return func(c *Config) {
+		c.ComingSoonPage = enabled
+	}
+}
+
+func WithGeoIPDBPath(path string) Option {
+	return func(c *Config) {
+		c.GeoIPDBPath = path
+	}
+}
+
+func WithAnalytics(enabled bool) Option {
+	return func(c *Config) {
+		c.Analytics = enabled
+	}
+}
+
+func WithFetchMetadata(enabled bool) Option {
+	return func(c *Config) {
+		c.FetchMetadata = enabled
+	}
+}
+
+func WithInterstitial(allowedDomains []string, trustedRole string) Option {
+	return func(c *Config) {
+		c.Interstitial = true
+		c.AllowedDomains = allowedDomains
+		c.TrustedRole = trustedRole
+	}
+}
+
+func WithRedirectStatus(status int) Option {
+	return func(c *Config) {
+		c.RedirectStatus = status
+	}
+}
+
+// WithRedirectMaxAge sets how long clients may cache permanent redirects.
+func WithRedirectMaxAge(maxAge time.Duration) Option {
+	return func(c *Config) {
+		c.RedirectMaxAge = maxAge
+	}
+}
+
+func WithOIDC(issuer string, clientID string, clientSecret string, redirectURL string) Option {
+	return func(c *Config) {
+		c.OIDCIssuer = issuer
+		c.OIDCClientID = clientID
+		c.OIDCClientSecret = clientSecret
+		c.OIDCRedirectURL = redirectURL
+	}
+}
+
+func WithJWTKeys(keyFile string, retiredKeyFiles []string) Option {
+	return func(c *Config) {
+		c.JWTKeyFile = keyFile
+		c.JWTRetiredKeyFiles = retiredKeyFiles
+	}
+}
+
+func WithDev(enabled bool) Option {
+	return func(c *Config) {
+		c.Dev = enabled
+	}
+}
+
+func WithCookie(domain string, path string, secure bool, sameSite string) Option {
+	return func(c *Config) {
+		c.CookieDomain = domain
+		c.CookiePath = path
+		c.CookieSecure = secure
+		c.CookieSameSite = sameSite
+	}
+}
+
+func WithReservedDomains(domains []string) Option {
+	return func(c *Config) {
+		c.ReservedDomains = domains
+	}
+}
+
+func WithTrustedOrigins(origins []string) Option {
+	return func(c *Config) {
+		c.TrustedOrigins = origins
+	}
+}
+
+func WithTrustedProxies(header string, proxies []string) Option {
+	return func(c *Config) {
+		c.ProxyHeader = header
+		c.TrustedProxies = proxies
+	}
+}
+
+// WithRateLimits sets the limits like "100/1m" for shortening, redirects
+// and API reads. Empty limits are disabled.
+func WithRateLimits(shorten string, redirect string, read string) Option {
+	return func(c *Config) {
+		c.RateLimitShorten = shorten
+		c.RateLimitRedirect = redirect
+		c.RateLimitRead = read
+	}
+}
+
+// WithAuthRateLimit sets the limit like "10/1m" for signups and logins. An
+// empty limit is disabled.
+func WithAuthRateLimit(limit string) Option {
+	return func(c *Config) {
+		c.RateLimitAuth = limit
+	}
+}
+
+func WithDailyLinkQuota(quota int64) Option {
+	return func(c *Config) {
+		c.DailyLinkQuota = quota
+	}
+}
+
+// WithMaxBatchSize limits how many links a batch request may shorten.
+func WithMaxBatchSize(size int) Option {
+	return func(c *Config) {
+		c.MaxBatchSize = size
+	}
+}
+
+// WithLinkCache sizes the cache of links in front of the database. A size
+// of 0 disables it.
+func WithLinkCache(size int, ttl time.Duration, negativeTTL time.Duration) Option {
+	return func(c *Config) {
+		c.LinkCacheSize = size
+		c.LinkCacheTTL = ttl
+		c.LinkCacheNegativeTTL = negativeTTL
+	}
+}
+
+// WithMetrics serves the metrics on a listen address of their own, if addr
+// is set, and requires the token as a bearer token, if set.
+func WithMetrics(addr string, token string) Option {
+	return func(c *Config) {
+		c.MetricsAddr = addr
+		c.MetricsToken = token
+	}
+}
+
 func (c *Config) ParseFlags() {
 	flag.StringVar(&c.ServerAddr, "a", c.ServerAddr, "Server address")
 	flag.StringVar(&c.BaseURL, "b", c.BaseURL, "Base url for generated links")
 	flag.StringVar(&c.FileStoragePath, "f", c.FileStoragePath, "Path to file storage")
 	flag.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "Database DSN (optional)")
 	flag.StringVar(&c.JwtSecret, "j", c.JwtSecret, "JWT secret")
+	flag.BoolVar(&c.ComingSoonPage, "coming-soon", c.ComingSoonPage, "Show placeholder page for inactive links")
+	flag.StringVar(&c.GeoIPDBPath, "geoip-db", c.GeoIPDBPath, "Path to MaxMind country database (optional)")
+	flag.BoolVar(&c.Analytics, "analytics", c.Analytics, "Count clicks on short links")
+	flag.BoolVar(&c.FetchMetadata, "fetch-metadata", c.FetchMetadata, "Fetch title and description of destination pages")
+	flag.BoolVar(&c.Interstitial, "interstitial", c.Interstitial, "Warn before redirecting outside of allowed domains")
+	flag.Func("allowed-domains", "Comma-separated domains that skip the interstitial page", func(s string) error {
+		c.AllowedDomains = splitList(s)
+
+		return nil
+	})
+	flag.StringVar(&c.TrustedRole, "interstitial-trusted-role", c.TrustedRole, "Workspace role whose links skip the interstitial page (optional)")
+	flag.IntVar(&c.InterstitialDelay, "interstitial-delay", c.InterstitialDelay, "Interstitial countdown in seconds")
+	flag.IntVar(&c.RedirectStatus, "redirect-status", c.RedirectStatus, "Default redirect status code (301, 302, 307 or 308)")
+	flag.DurationVar(&c.RedirectMaxAge, "redirect-max-age", c.RedirectMaxAge, "How long clients may cache permanent redirects")
+	flag.StringVar(&c.OIDCIssuer, "oidc-issuer", c.OIDCIssuer, "OpenID Connect issuer URL (optional)")
+	flag.StringVar(&c.OIDCClientID, "oidc-client-id", c.OIDCClientID, "OpenID Connect client ID")
+	flag.StringVar(&c.OIDCClientSecret, "oidc-client-secret", c.OIDCClientSecret, "OpenID Connect client secret")
+	flag.StringVar(&c.OIDCRedirectURL, "oidc-redirect-url", c.OIDCRedirectURL, "OpenID Connect redirect URL")
+	flag.StringVar(&c.OIDCPostLoginURL, "oidc-post-login-url", c.OIDCPostLoginURL, "Where users are sent after logging in with OpenID Connect")
+	flag.StringVar(&c.JWTKeyFile, "jwt-key-file", c.JWTKeyFile, "Session signing key file: Ed25519 or RSA PEM, or an HMAC secret (overrides -j)")
+	flag.Func("jwt-retired-key-files", "Comma-separated key files still accepted for verifying sessions", func(s string) error {
+		c.JWTRetiredKeyFiles = splitList(s)
+
+		return nil
+	})
+	flag.BoolVar(&c.Dev, "dev", c.Dev, "Development mode, allows the default JWT secret")
+	flag.StringVar(&c.CookieDomain, "cookie-domain", c.CookieDomain, "Domain of the session cookie (optional)")
+	flag.StringVar(&c.CookiePath, "cookie-path", c.CookiePath, "Path of the session cookie")
+	flag.BoolVar(&c.CookieSecure, "cookie-secure", c.CookieSecure, "Only send the session cookie over HTTPS")
+	flag.StringVar(&c.CookieSameSite, "cookie-same-site", c.CookieSameSite, "SameSite mode of the session cookie (Strict, Lax or None)")
+	flag.StringVar(&c.RateLimitShorten, "rate-limit-shorten", c.RateLimitShorten, "Shorten requests allowed per client, e.g. 60/1m (optional)")
+	flag.StringVar(&c.RateLimitRedirect, "rate-limit-redirect", c.RateLimitRedirect, "Redirects allowed per client, e.g. 600/1m (optional)")
+	flag.StringVar(&c.RateLimitRead, "rate-limit-read", c.RateLimitRead, "API reads allowed per client, e.g. 300/1m (optional)")
+	flag.StringVar(&c.RateLimitAuth, "rate-limit-auth", c.RateLimitAuth, "Signups and logins allowed per client, empty to disable")
+	flag.Int64Var(&c.DailyLinkQuota, "daily-link-quota", c.DailyLinkQuota, "Links an account, or an anonymous client address, may create per day, 0 for unlimited")
+	flag.IntVar(&c.MaxBatchSize, "max-batch-size", c.MaxBatchSize, "Links per batch request, and per chunk of streamed batches")
+	flag.IntVar(&c.LinkCacheSize, "link-cache-size", c.LinkCacheSize, "Links cached in front of the database, 0 to disable")
+	flag.DurationVar(&c.LinkCacheTTL, "link-cache-ttl", c.LinkCacheTTL, "How long links are cached")
+	flag.DurationVar(&c.LinkCacheNegativeTTL, "link-cache-negative-ttl", c.LinkCacheNegativeTTL, "How long unknown links are cached")
+	flag.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Address serving /metrics apart from the app (optional)")
+	flag.StringVar(&c.MetricsToken, "metrics-token", c.MetricsToken, "Bearer token required to read /metrics (optional)")
+	flag.Func("reserved-domains", "Comma-separated hosts serving the default domain, besides the base URL host", func(s string) error {
+		c.ReservedDomains = splitList(s)
+
+		return nil
+	})
+	flag.Func("trusted-origins", "Comma-separated origins allowed to make cross-origin requests with the session cookie", func(s string) error {
+		c.TrustedOrigins = splitList(s)
+
+		return nil
+	})
+	flag.StringVar(&c.ProxyHeader, "proxy-header", c.ProxyHeader, "Header the trusted proxies set to the client IP, e.g. X-Real-IP (optional)")
+	flag.Func("trusted-proxies", "Comma-separated IPs or CIDR ranges of proxies whose proxy header is trusted", func(s string) error {
+		c.TrustedProxies = splitList(s)
+
+		return nil
+	})
 
 	flag.Parse()
 }
@@ -91,4 +356,164 @@ func (c *Config) LoadFromEnv() {
 	if secret, ok := os.LookupEnv("JWT_SECRET"); ok {
 		c.JwtSecret = secret
 	}
+
+	if comingSoon, err := strconv.ParseBool(os.Getenv("COMING_SOON_PAGE")); err == nil {
+		c.ComingSoonPage = comingSoon
+	}
+
+	if path, ok := os.LookupEnv("GEOIP_DB_PATH"); ok {
+		c.GeoIPDBPath = path
+	}
+
+	if analytics, err := strconv.ParseBool(os.Getenv("ANALYTICS")); err == nil {
+		c.Analytics = analytics
+	}
+
+	if fetchMetadata, err := strconv.ParseBool(os.Getenv("FETCH_METADATA")); err == nil {
+		c.FetchMetadata = fetchMetadata
+	}
+
+	if interstitial, err := strconv.ParseBool(os.Getenv("INTERSTITIAL")); err == nil {
+		c.Interstitial = interstitial
+	}
+
+	if domains, ok := os.LookupEnv("ALLOWED_DOMAINS"); ok {
+		c.AllowedDomains = splitList(domains)
+	}
+
+	if role, ok := os.LookupEnv("INTERSTITIAL_TRUSTED_ROLE"); ok {
+		c.TrustedRole = role
+	}
+
+	if delay, err := strconv.Atoi(os.Getenv("INTERSTITIAL_DELAY")); err == nil {
+		c.InterstitialDelay = delay
+	}
+
+	if redirectStatus, err := strconv.Atoi(os.Getenv("REDIRECT_STATUS")); err == nil {
+		c.RedirectStatus = redirectStatus
+	}
+
+	if maxAge, err := time.ParseDuration(os.Getenv("REDIRECT_MAX_AGE")); err == nil {
+		c.RedirectMaxAge = maxAge
+	}
+
+	if issuer, ok := os.LookupEnv("OIDC_ISSUER"); ok {
+		c.OIDCIssuer = issuer
+	}
+
+	if clientID, ok := os.LookupEnv("OIDC_CLIENT_ID"); ok {
+		c.OIDCClientID = clientID
+	}
+
+	if clientSecret, ok := os.LookupEnv("OIDC_CLIENT_SECRET"); ok {
+		c.OIDCClientSecret = clientSecret
+	}
+
+	if redirectURL, ok := os.LookupEnv("OIDC_REDIRECT_URL"); ok {
+		c.OIDCRedirectURL = redirectURL
+	}
+
+	if postLoginURL, ok := os.LookupEnv("OIDC_POST_LOGIN_URL"); ok {
+		c.OIDCPostLoginURL = postLoginURL
+	}
+
+	if keyFile, ok := os.LookupEnv("JWT_KEY_FILE"); ok {
+		c.JWTKeyFile = keyFile
+	}
+
+	if keyFiles, ok := os.LookupEnv("JWT_RETIRED_KEY_FILES"); ok {
+		c.JWTRetiredKeyFiles = splitList(keyFiles)
+	}
+
+	if dev, err := strconv.ParseBool(os.Getenv("DEV")); err == nil {
+		c.Dev = dev
+	}
+
+	if domain, ok := os.LookupEnv("COOKIE_DOMAIN"); ok {
+		c.CookieDomain = domain
+	}
+
+	if path, ok := os.LookupEnv("COOKIE_PATH"); ok {
+		c.CookiePath = path
+	}
+
+	if secure, err := strconv.ParseBool(os.Getenv("COOKIE_SECURE")); err == nil {
+		c.CookieSecure = secure
+	}
+
+	if sameSite, ok := os.LookupEnv("COOKIE_SAME_SITE"); ok {
+		c.CookieSameSite = sameSite
+	}
+
+	if origins, ok := os.LookupEnv("TRUSTED_ORIGINS"); ok {
+		c.TrustedOrigins = splitList(origins)
+	}
+
+	if domains, ok := os.LookupEnv("RESERVED_DOMAINS"); ok {
+		c.ReservedDomains = splitList(domains)
+	}
+
+	if header, ok := os.LookupEnv("PROXY_HEADER"); ok {
+		c.ProxyHeader = header
+	}
+
+	if proxies, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		c.TrustedProxies = splitList(proxies)
+	}
+
+	if limit, ok := os.LookupEnv("RATE_LIMIT_SHORTEN"); ok {
+		c.RateLimitShorten = limit
+	}
+
+	if limit, ok := os.LookupEnv("RATE_LIMIT_REDIRECT"); ok {
+		c.RateLimitRedirect = limit
+	}
+
+	if limit, ok := os.LookupEnv("RATE_LIMIT_READ"); ok {
+		c.RateLimitRead = limit
+	}
+
+	if limit, ok := os.LookupEnv("RATE_LIMIT_AUTH"); ok {
+		c.RateLimitAuth = limit
+	}
+
+	if quota, err := strconv.ParseInt(os.Getenv("DAILY_LINK_QUOTA"), 10, 64); err == nil {
+		c.DailyLinkQuota = quota
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("MAX_BATCH_SIZE")); err == nil {
+		c.MaxBatchSize = size
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("LINK_CACHE_SIZE")); err == nil {
+		c.LinkCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("LINK_CACHE_TTL")); err == nil {
+		c.LinkCacheTTL = ttl
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("LINK_CACHE_NEGATIVE_TTL")); err == nil {
+		c.LinkCacheNegativeTTL = ttl
+	}
+
+	if addr, ok := os.LookupEnv("METRICS_ADDRESS"); ok {
+		c.MetricsAddr = addr
+	}
+
+	if token, ok := os.LookupEnv("METRICS_TOKEN"); ok {
+		c.MetricsToken = token
+	}
+}
+
+func splitList(s string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
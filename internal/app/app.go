@@ -2,27 +2,51 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/maxpain/shortener/config"
+	"github.com/maxpain/shortener/internal/auth"
+	"github.com/maxpain/shortener/internal/geoip"
 	"github.com/maxpain/shortener/internal/handler"
+	"github.com/maxpain/shortener/internal/metadata"
+	"github.com/maxpain/shortener/internal/metrics"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/ratelimit"
+	"github.com/maxpain/shortener/internal/repository/cache"
 	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
 	postgresRepository "github.com/maxpain/shortener/internal/repository/postgres"
 	"github.com/maxpain/shortener/internal/usecase"
 )
 
+var (
+	errDefaultJwtSecret = errors.New(
+		"refusing to sign sessions with the default JWT secret, set a secret or key file, or enable development mode",
+	)
+	errInvalidMaxBatchSize = errors.New("max batch size must be positive")
+)
+
 type App struct {
 	*fiber.App
 	logger     *slog.Logger
 	repository usecase.Repository
+	geo        *geoip.DB
+	fetcher    *metadata.Fetcher
+	listener   *postgresRepository.Listener
+	// metricsApp serves the metrics on metricsAddr, if set
+	metricsApp  *fiber.App
+	metricsAddr string
 }
 
 func New(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*App, error) {
-	repo, err := getRepository(ctx, cfg, logger)
+	appMetrics := getMetrics(cfg)
+
+	repo, listener, err := getRepository(ctx, cfg, logger, appMetrics)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create repository: %w", err)
 	}
@@ -32,28 +56,200 @@ func New(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*App, er
 		return nil, fmt.Errorf("failed to initialize repository: %w", err)
 	}
 
-	useCase := usecase.New(repo, logger)
-	handler := handler.New(useCase, logger, cfg.BaseURL)
-	app := fiber.New()
-	setupRoutes(app, cfg, logger, handler)
+	if listener != nil {
+		listener.Start(ctx)
+	}
+
+	if err := model.ValidateRedirectStatus(cfg.RedirectStatus); err != nil {
+		return nil, fmt.Errorf("invalid default redirect status %d: %w", cfg.RedirectStatus, err)
+	}
+
+	if cfg.TrustedRole != "" {
+		if err := model.Role(cfg.TrustedRole).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid interstitial trusted role %q: %w", cfg.TrustedRole, err)
+		}
+	}
+
+	if cfg.MaxBatchSize <= 0 {
+		return nil, errInvalidMaxBatchSize
+	}
+
+	useCaseOpts := []usecase.Option{
+		usecase.WithAnalytics(cfg.Analytics),
+		usecase.WithDefaultRedirectStatus(cfg.RedirectStatus),
+	}
+
+	var geo *geoip.DB
+
+	if cfg.GeoIPDBPath != "" {
+		geo, err = geoip.Open(cfg.GeoIPDBPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+		}
+
+		useCaseOpts = append(useCaseOpts, usecase.WithGeoResolver(geo))
+	}
+
+	var fetcher *metadata.Fetcher
+
+	if cfg.FetchMetadata {
+		fetcher = metadata.New(repo, logger)
+		fetcher.Start(ctx)
+
+		useCaseOpts = append(useCaseOpts, usecase.WithMetadataFetcher(fetcher))
+	}
+
+	if cfg.DailyLinkQuota > 0 {
+		useCaseOpts = append(useCaseOpts, usecase.WithDailyQuota(cfg.DailyLinkQuota))
+	}
+
+	if cfg.Interstitial {
+		useCaseOpts = append(useCaseOpts, usecase.WithInterstitial(cfg.AllowedDomains, model.Role(cfg.TrustedRole)))
+	}
+
+	if appMetrics != nil {
+		useCaseOpts = append(useCaseOpts, usecase.WithMetrics(appMetrics))
+	}
+
+	useCase := usecase.New(repo, logger, useCaseOpts...)
+	linkHandler := handler.New(useCase, logger, cfg.BaseURL,
+		handler.WithComingSoonPage(cfg.ComingSoonPage),
+		handler.WithInterstitialDelay(cfg.InterstitialDelay),
+		handler.WithMaxBatchSize(cfg.MaxBatchSize),
+		handler.WithRedirectMaxAge(cfg.RedirectMaxAge),
+	)
+	domainUseCase := usecase.NewDomainUseCase(repo, logger,
+		usecase.WithReservedDomains(append([]string{baseHost(cfg.BaseURL)}, cfg.ReservedDomains...)...),
+	)
+	domainHandler := handler.NewDomainHandler(domainUseCase, logger)
+	workspaceHandler := handler.NewWorkspaceHandler(usecase.NewWorkspaceUseCase(repo, logger), logger)
+	keys, err := getKeyset(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+
+	cookie := auth.CookieAttributes{
+		Domain:   cfg.CookieDomain,
+		Path:     cfg.CookiePath,
+		Secure:   cfg.CookieSecure,
+		SameSite: cfg.CookieSameSite,
+	}
+
+	if err := cookie.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid session cookie attributes: %w", err)
+	}
+
+	sessions := auth.New(keys, repo, logger, auth.WithCookieAttributes(cookie))
+	userUseCase := usecase.NewUserUseCase(repo, logger)
+	userHandler := handler.NewUserHandler(userUseCase, sessions, logger)
+	apiKeyUseCase := usecase.NewAPIKeyUseCase(repo, logger)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyUseCase, logger)
+
+	var oidcHandler *handler.OIDCHandler
+
+	if cfg.OIDCIssuer != "" {
+		provider, err := auth.NewOIDC(ctx, cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up OIDC login: %w", err)
+		}
+
+		oidcHandler = handler.NewOIDCHandler(provider, userUseCase, sessions, logger,
+			handler.WithPostLoginURL(cfg.OIDCPostLoginURL),
+			handler.WithStateCookie(cookie.Domain, cookie.Path, cookie.Secure),
+		)
+	}
+
+	limits, err := getRateLimits(cfg, repo, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit: %w", err)
+	}
+
+	// Bodies over the limit are streamed to the handler instead of rejected.
+	// Only the streaming routes read them as they arrive, see limitBody.
+	// Client IPs are taken from the proxy header only behind trusted proxies,
+	// so clients cannot pick their own rate limit bucket or variant.
+	app := fiber.New(fiber.Config{
+		StreamRequestBody:       true,
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+	// The public origin is trusted even when a proxy rewrites the Host header
+	trustedOrigins := append([]string{baseOrigin(cfg.BaseURL)}, cfg.TrustedOrigins...)
+
+	var (
+		metricsHandler fiber.Handler
+		separateApp    *fiber.App
+	)
+
+	if appMetrics != nil {
+		// Measures every request, including those the middlewares below answer
+		app.Use(appMetrics.Middleware())
+
+		if cfg.MetricsAddr != "" {
+			separateApp = metricsApp(appMetrics, cfg.MetricsToken)
+		} else {
+			metricsHandler = appMetrics.Handler(cfg.MetricsToken)
+		}
+	}
+
+	setupRoutes(app, logger, sessions, apiKeyUseCase, trustedOrigins, limits,
+		linkHandler, domainHandler, workspaceHandler, userHandler, apiKeyHandler, oidcHandler,
+		metricsHandler,
+	)
 
 	return &App{
-		App:        app,
-		logger:     logger,
-		repository: repo,
+		App:         app,
+		logger:      logger,
+		repository:  repo,
+		geo:         geo,
+		fetcher:     fetcher,
+		listener:    listener,
+		metricsApp:  separateApp,
+		metricsAddr: cfg.MetricsAddr,
 	}, nil
 }
 
-func getRepository(ctx context.Context, cfg *config.Config, logger *slog.Logger) (usecase.Repository, error) {
+// getRepository returns the listener keeping the link cache in sync with
+// other instances, if links are cached. The repository reports to metrics,
+// if not nil.
+func getRepository(
+	ctx context.Context,
+	cfg *config.Config,
+	logger *slog.Logger,
+	appMetrics *metrics.Metrics,
+) (usecase.Repository, *postgresRepository.Listener, error) {
 	if cfg.DatabaseDSN != "" {
 		db, err := pgxpool.New(ctx, cfg.DatabaseDSN)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to database: %w", err)
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
 		}
 
 		logger.Info("Initialized postgres repository")
 
-		return postgresRepository.New(db, logger), nil
+		repo := postgresRepository.New(db, logger)
+
+		if appMetrics != nil {
+			registerPostgresMetrics(appMetrics, db, repo)
+		}
+
+		// The memory repository has nothing to gain from a cache
+		if cfg.LinkCacheSize <= 0 {
+			return repo, nil, nil
+		}
+
+		linkCache := cache.New(repo,
+			cache.WithSize(cfg.LinkCacheSize),
+			cache.WithTTL(cfg.LinkCacheTTL),
+			cache.WithNegativeTTL(cfg.LinkCacheNegativeTTL),
+		)
+
+		if appMetrics != nil {
+			registerCacheMetrics(appMetrics, linkCache)
+		}
+
+		return linkCache, postgresRepository.NewListener(db, linkCache, logger), nil
 	}
 
 	var file *os.File
@@ -63,7 +259,7 @@ func getRepository(ctx context.Context, cfg *config.Config, logger *slog.Logger)
 
 		file, err = os.OpenFile(cfg.FileStoragePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s : %w", cfg.FileStoragePath, err)
+			return nil, nil, fmt.Errorf("failed to open file %s : %w", cfg.FileStoragePath, err)
 		}
 
 		logger.Info("Initialized memory repository with persistence")
@@ -71,9 +267,137 @@ func getRepository(ctx context.Context, cfg *config.Config, logger *slog.Logger)
 		logger.Info("Initialized memory repository without persistence")
 	}
 
-	return memoryRepository.New(file, logger), nil
+	repo := memoryRepository.New(file, logger)
+
+	if appMetrics != nil {
+		registerMemoryMetrics(appMetrics, repo, logger)
+	}
+
+	return repo, nil, nil
+}
+
+func getRateLimits(cfg *config.Config, repo usecase.Repository, logger *slog.Logger) (*rateLimits, error) {
+	limiter := ratelimit.New(repo, logger)
+	limits := &rateLimits{}
+
+	for _, limit := range []struct {
+		handler *fiber.Handler
+		name    string
+		spec    string
+	}{
+		{&limits.shorten, "shorten", cfg.RateLimitShorten},
+		{&limits.redirect, "redirect", cfg.RateLimitRedirect},
+		{&limits.read, "read", cfg.RateLimitRead},
+		{&limits.auth, "auth", cfg.RateLimitAuth},
+	} {
+		policy, err := ratelimit.ParsePolicy(limit.name, limit.spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", limit.name, err)
+		}
+
+		*limit.handler = limiter.Middleware(policy)
+	}
+
+	return limits, nil
+}
+
+// baseOrigin returns the scheme and host of the base URL.
+func baseOrigin(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// baseHost returns the host of the base URL without a port.
+func baseHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// getKeyset returns the session signing keys: the key file if configured,
+// the JWT secret otherwise.
+func getKeyset(cfg *config.Config) (*auth.Keyset, error) {
+	retired := make([]*auth.Key, 0, len(cfg.JWTRetiredKeyFiles)+1)
+
+	for _, path := range cfg.JWTRetiredKeyFiles {
+		key, err := auth.LoadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load retired key %s: %w", path, err)
+		}
+
+		retired = append(retired, key)
+	}
+
+	defaultSecret := cfg.JwtSecret == config.DefaultJwtSecret
+
+	if cfg.JWTKeyFile == "" {
+		if defaultSecret && !cfg.Dev {
+			return nil, errDefaultJwtSecret
+		}
+
+		active, err := auth.NewHMACKey([]byte(cfg.JwtSecret))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key from JWT secret: %w", err)
+		}
+
+		return auth.NewKeyset(active, retired...), nil
+	}
+
+	active, err := auth.LoadKey(cfg.JWTKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key %s: %w", cfg.JWTKeyFile, err)
+	}
+
+	// Sessions signed with the secret before switching to a key file stay
+	// valid until they expire
+	if cfg.JwtSecret != "" && !defaultSecret {
+		secretKey, err := auth.NewHMACKey([]byte(cfg.JwtSecret))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key from JWT secret: %w", err)
+		}
+
+		retired = append(retired, secretKey)
+	}
+
+	return auth.NewKeyset(active, retired...), nil
 }
 
 func (a *App) Close() {
+	if a.metricsApp != nil {
+		if err := a.metricsApp.Shutdown(); err != nil {
+			a.logger.Error("Failed to shut down metrics server", slog.Any("error", err))
+		}
+	}
+
+	if a.fetcher != nil {
+		a.fetcher.Close()
+	}
+
+	if a.listener != nil {
+		a.listener.Close()
+	}
+
+	if linkCache, ok := a.repository.(*cache.Repository); ok {
+		stats := linkCache.Stats()
+
+		a.logger.Info("Link cache stats",
+			slog.Uint64("hits", stats.Hits),
+			slog.Uint64("negative_hits", stats.NegativeHits),
+			slog.Uint64("misses", stats.Misses),
+			slog.Uint64("evictions", stats.Evictions),
+		)
+	}
+
 	a.repository.Close()
+
+	if a.geo != nil {
+		a.geo.Close()
+	}
 }
@@ -2,28 +2,34 @@ package app_test
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/maxpain/shortener/config"
 	"github.com/maxpain/shortener/internal/app"
+	"github.com/maxpain/shortener/internal/auth/oidctest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func initApp() (*app.App, error) {
+func initApp(opts ...config.Option) (*app.App, error) {
 	ctx := context.Background()
-	cfg := config.New(
+	cfg := config.New(append([]config.Option{
 		config.WithFileStoragePath(""),
-	)
+		config.WithDev(true),
+	}, opts...)...)
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
@@ -38,7 +44,7 @@ func initApp() (*app.App, error) {
 func TestRouter(t *testing.T) {
 	t.Parallel()
 
-	shortenerApp, err := initApp()
+	shortenerApp, err := initApp(config.WithReservedDomains([]string{"short.example"}))
 	require.NoError(t, err)
 	t.Cleanup(shortenerApp.Close)
 
@@ -54,6 +60,7 @@ func TestRouter(t *testing.T) {
 		response      string
 		isJSON        bool
 		checkResponse bool
+		contains      string
 		location      string
 		checkLocation bool
 	}{
@@ -148,6 +155,288 @@ func TestRouter(t *testing.T) {
 			checkResponse: true,
 			isJSON:        true,
 		},
+		{
+			name:          "Shorten link with future activation",
+			method:        "POST",
+			path:          "/api/shorten",
+			statusCode:    fiber.StatusCreated,
+			body:          `{"url":"https://example.com/soon","not_before":"2999-01-01T00:00:00Z"}`,
+			response:      `{"result":"http://localhost:8080/2326d5"}`,
+			checkResponse: true,
+			isJSON:        true,
+		},
+		{
+			name:       "Redirect before activation",
+			method:     "GET",
+			path:       "/2326d5",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Shorten expired link",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusCreated,
+			body:       `{"url":"https://example.com/expired","not_after":"2000-01-01T00:00:00Z"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Redirect after expiration",
+			method:     "GET",
+			path:       "/f4248e",
+			statusCode: fiber.StatusGone,
+		},
+		{
+			name:       "Preview",
+			method:     "GET",
+			path:       "/160009+",
+			statusCode: fiber.StatusOK,
+			contains:   "<dd>anonymous</dd>",
+		},
+		{
+			name:       "Preview of non-existent link",
+			method:     "GET",
+			path:       "/non-existent+",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "QR code",
+			method:     "GET",
+			path:       "/api/qr/160009?format=svg&size=128&level=H&margin=2",
+			statusCode: fiber.StatusOK,
+		},
+		{
+			name:       "QR code with invalid options",
+			method:     "GET",
+			path:       "/api/qr/160009?format=gif",
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "QR code of non-existent link",
+			method:     "GET",
+			path:       "/api/qr/non-existent",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Shorten link with invalid activation window",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"url":"https://example.com/invalid","not_before":"2030-01-01T00:00:00Z","not_after":"2020-01-01T00:00:00Z"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Shorten link with permanent redirect",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusCreated,
+			body:       `{"url":"https://example.com/permanent","redirect_status":308}`,
+			isJSON:     true,
+		},
+		{
+			name:          "Permanent redirect",
+			method:        "GET",
+			path:          "/53b57e",
+			statusCode:    fiber.StatusPermanentRedirect,
+			location:      "https://example.com/permanent",
+			checkLocation: true,
+		},
+		{
+			name:       "Shorten link with passthrough",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusCreated,
+			body:       `{"url":"https://example.com/docs?ref=short","passthrough":{"query":true,"path":true}}`,
+			isJSON:     true,
+		},
+		{
+			name:          "Redirect with query and path passthrough",
+			method:        "GET",
+			path:          "/0c038f/guide/install?utm_source=x&ref=other",
+			statusCode:    fiber.StatusTemporaryRedirect,
+			location:      "https://example.com/docs/guide/install?ref=short&utm_source=x",
+			checkLocation: true,
+		},
+		{
+			name:       "Redirect with trailing path without passthrough",
+			method:     "GET",
+			path:       "/160009/extra",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:          "Shorten link with UTM parameters",
+			method:        "POST",
+			path:          "/api/shorten",
+			statusCode:    fiber.StatusCreated,
+			body:          `{"url":"https://example.com/sale","utm":{"source":"mail","campaign":"spring"}}`,
+			response:      `{"result":"http://localhost:8080/ff3c95"}`,
+			checkResponse: true,
+			isJSON:        true,
+		},
+		{
+			name:       "Get links of a campaign",
+			method:     "GET",
+			path:       "/api/user/urls?campaign=spring",
+			statusCode: fiber.StatusOK,
+			response: `[{
+				"original_url": "https://example.com/sale?utm_source=mail&utm_campaign=spring",
+				"short_url": "http://localhost:8080/ff3c95",
+				"campaign": "spring"
+			}]`,
+			checkResponse: true,
+			isJSON:        true,
+		},
+		{
+			name:       "Register custom domain",
+			method:     "POST",
+			path:       "/api/user/domains",
+			statusCode: fiber.StatusCreated,
+			body:       `{"domain":"go.brand.example"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Register invalid custom domain",
+			method:     "POST",
+			path:       "/api/user/domains",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"domain":"localhost:8080"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Register reserved custom domain",
+			method:     "POST",
+			path:       "/api/user/domains",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"domain":"short.example"}`,
+			isJSON:     true,
+		},
+		{
+			name:          "Shorten link on unverified custom domain",
+			method:        "POST",
+			path:          "/api/shorten",
+			statusCode:    fiber.StatusBadRequest,
+			body:          `{"url":"https://yandex.ru","domain":"go.brand.example"}`,
+			response:      `{"error":"invalid link https://yandex.ru: domain ownership is not verified"}`,
+			checkResponse: true,
+			isJSON:        true,
+		},
+		{
+			name:       "Shorten link on foreign domain",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"url":"https://yandex.ru","domain":"unknown.example"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Create workspace",
+			method:     "POST",
+			path:       "/api/user/workspaces",
+			statusCode: fiber.StatusCreated,
+			body:       `{"name":"Marketing"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Create workspace without name",
+			method:     "POST",
+			path:       "/api/user/workspaces",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"name":""}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Shorten link in foreign workspace",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusForbidden,
+			body:       `{"url":"https://example.com/team","workspace_id":"unknown"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Accept unknown invitation",
+			method:     "POST",
+			path:       "/api/user/invitations/unknown/accept",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Shorten link with invalid redirect status",
+			method:     "POST",
+			path:       "/api/shorten",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"url":"https://example.com/invalid","redirect_status":200}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Current user of anonymous session",
+			method:     "GET",
+			path:       "/api/user",
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Sign up with weak password",
+			method:     "POST",
+			path:       "/api/user/signup",
+			statusCode: fiber.StatusBadRequest,
+			body:       `{"email":"user@example.com","password":"short"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Sign up",
+			method:     "POST",
+			path:       "/api/user/signup",
+			statusCode: fiber.StatusCreated,
+			body:       `{"email":"user@example.com","password":"long enough"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Sign up with taken email",
+			method:     "POST",
+			path:       "/api/user/signup",
+			statusCode: fiber.StatusConflict,
+			body:       `{"email":"user@example.com","password":"long enough"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Links are claimed by the account",
+			method:     "GET",
+			path:       "/api/user/urls?campaign=spring",
+			statusCode: fiber.StatusOK,
+			response: `[{
+				"original_url": "https://example.com/sale?utm_source=mail&utm_campaign=spring",
+				"short_url": "http://localhost:8080/ff3c95",
+				"campaign": "spring"
+			}]`,
+			checkResponse: true,
+			isJSON:        true,
+		},
+		{
+			name:       "Login with wrong password",
+			method:     "POST",
+			path:       "/api/user/login",
+			statusCode: fiber.StatusUnauthorized,
+			body:       `{"email":"user@example.com","password":"wrong password"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Login",
+			method:     "POST",
+			path:       "/api/user/login",
+			statusCode: fiber.StatusOK,
+			body:       `{"email":"user@example.com","password":"long enough"}`,
+			isJSON:     true,
+		},
+		{
+			name:       "Current user",
+			method:     "GET",
+			path:       "/api/user",
+			statusCode: fiber.StatusOK,
+		},
+		{
+			name:       "Preview of a claimed link",
+			method:     "GET",
+			path:       "/ff3c95+",
+			statusCode: fiber.StatusOK,
+			contains:   "<dd>a user at example.com</dd>",
+		},
 	}
 
 	for _, tt := range tests {
@@ -174,10 +463,10 @@ func TestRouter(t *testing.T) {
 			// Store received cookies in the jar
 			jar.SetCookies(u, resp.Cookies())
 
-			if tt.checkResponse {
-				body, err := io.ReadAll(resp.Body)
-				require.NoError(err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(err)
 
+			if tt.checkResponse {
 				if tt.isJSON {
 					assert.JSONEq(tt.response, string(body), "response json")
 				} else {
@@ -185,6 +474,10 @@ func TestRouter(t *testing.T) {
 				}
 			}
 
+			if tt.contains != "" {
+				assert.Contains(string(body), tt.contains, "response body")
+			}
+
 			if tt.checkLocation {
 				location := resp.Header.Get("Location")
 				assert.Equal(tt.location, location, "Location header")
@@ -194,3 +487,601 @@ func TestRouter(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp()
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	do := func(req *http.Request) *http.Response {
+		t.Helper()
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	req := httptest.NewRequest("POST", "/api/user/signup", strings.NewReader(`{"email":"ci@example.com","password":"long enough"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := do(req)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	cookies := resp.Cookies()
+	createKey := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/api/user/keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		resp := do(req)
+
+		var key struct {
+			Key string `json:"key"`
+		}
+
+		if resp.StatusCode == fiber.StatusCreated {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&key))
+		}
+
+		return resp.StatusCode, key.Key
+	}
+
+	status, _ := createKey(`{"name":"ci","scopes":["admin"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, shortenKey := createKey(`{"name":"ci","scopes":["shorten","read"]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+
+	req = httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url":"https://example.com/ci"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+shortenKey)
+	resp = do(req)
+	assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	assert.Empty(t, resp.Cookies(), "API key requests must not get a session")
+
+	req = httptest.NewRequest("GET", "/api/user/urls", nil)
+	req.Header.Set("X-API-Key", shortenKey)
+	resp = do(req)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest("DELETE", "/api/user/urls", strings.NewReader(`["3f1b1a"]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", shortenKey)
+	resp = do(req)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "key lacks the delete scope")
+
+	req = httptest.NewRequest("POST", "/api/user/keys", strings.NewReader(`{"name":"more","scopes":["delete"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", shortenKey)
+	resp = do(req)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "keys cannot mint keys")
+
+	req = httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url":"https://example.com/ci"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "sk_invalid")
+	resp = do(req)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestBatchSize(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp(config.WithMaxBatchSize(2))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	req := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(`[
+		{"original_url": "https://example.com/1", "correlation_id": "1"},
+		{"original_url": "https://example.com/2", "correlation_id": "2"},
+		{"original_url": "https://example.com/3", "correlation_id": "3"}
+	]`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// Chunks of two links, one of them with an invalid link
+	req = httptest.NewRequest("POST", "/api/shorten/batch/stream", strings.NewReader(`
+{"original_url": "https://example.com/1", "correlation_id": "1"}
+{"original_url": "https://example.com/1", "correlation_id": "dup"}
+not json
+{"original_url": "https://example.com/2", "not_before": "2024-07-02T00:00:00Z", "not_after": "2024-07-01T00:00:00Z"}
+{"original_url": "https://example.com/3", "correlation_id": "3"}
+{"correlation_id": "no url"}
+`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err = shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	expected := []string{
+		`{"line":2,"correlation_id":"1","short_url":"http://localhost:8080/f2f978","status":201}`,
+		`{"line":3,"correlation_id":"dup","short_url":"http://localhost:8080/f2f978","status":409}`,
+		`{"line":4,"status":400,"error":"Invalid JSON payload"}`,
+		`{"line":5,"status":400,"error":"invalid link https://example.com/2: not_after must be later than not_before"}`,
+		`{"line":6,"correlation_id":"3","short_url":"http://localhost:8080/2d3950","status":201}`,
+		`{"line":7,"correlation_id":"no url","status":400,"error":"URL is required"}`,
+	}
+
+	require.Len(t, lines, len(expected))
+
+	for i, line := range lines {
+		assert.JSONEq(t, expected[i], line)
+	}
+}
+
+func TestPermanentRedirectCaching(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp(config.WithRedirectMaxAge(24 * time.Hour))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	cacheControl := func(body string) string {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+		var shortened struct {
+			Result string `json:"result"`
+		}
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&shortened))
+
+		resp, err = shortenerApp.Test(httptest.NewRequest("GET", strings.TrimPrefix(shortened.Result, "http://localhost:8080"), nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, fiber.StatusPermanentRedirect, resp.StatusCode)
+
+		return resp.Header.Get(fiber.HeaderCacheControl)
+	}
+
+	assert.Equal(t, "public, max-age=86400", cacheControl(`{"url":"https://example.com/forever","redirect_status":308}`))
+
+	notAfter := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	limited := cacheControl(`{"url":"https://example.com/limited","redirect_status":308,"not_after":"` + notAfter + `"}`)
+
+	var maxAge int
+	_, err = fmt.Sscanf(limited, "public, max-age=%d", &maxAge)
+	require.NoError(t, err, limited)
+	assert.InDelta(t, 3600, maxAge, 5, "redirects must not be cached past not_after")
+}
+
+func TestQRCodeETag(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp()
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("https://example.com/qr"))
+
+	resp, err := shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	path := "/api/qr/" + strings.TrimPrefix(string(body), "http://localhost:8080/")
+
+	status := func(header string, value string) int {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	resp, err = shortenerApp.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	etag := resp.Header.Get(fiber.HeaderETag)
+	require.NotEmpty(t, etag)
+
+	assert.Equal(t, fiber.StatusNotModified, status(fiber.HeaderIfNoneMatch, etag))
+	assert.Equal(t, fiber.StatusNotModified, status(fiber.HeaderIfNoneMatch, "W/"+etag))
+	assert.Equal(t, fiber.StatusNotModified, status(fiber.HeaderIfNoneMatch, `"other", `+etag))
+	assert.Equal(t, fiber.StatusNotModified, status(fiber.HeaderIfNoneMatch, "*"))
+	assert.Equal(t, fiber.StatusOK, status(fiber.HeaderIfNoneMatch, `"other"`))
+	assert.Equal(t, fiber.StatusOK, status(fiber.HeaderIfModifiedSince, "Mon, 01 Jan 2024 00:00:00 GMT"))
+}
+
+func TestImportExport(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp()
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	req := httptest.NewRequest("POST", "/api/user/urls/import", strings.NewReader("Correlation ID,Tags,Link\n1,x,https://example.com"))
+	req.Header.Set("Content-Type", "text/csv")
+
+	resp, err := shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, "the url column is required")
+
+	req = httptest.NewRequest("POST", "/api/user/urls/import", strings.NewReader(`url,alias,tags,correlation_id,notes
+https://example.com/1,,"news, tech",1,ignored
+https://example.com/4,my-link,,2
+https://example.com/5,api,,3
+https://example.com/6,x"y,,4
+
+,,,5
+https://example.com/7,,-1;@team,=1+1
+`))
+	req.Header.Set("Content-Type", "text/csv")
+
+	resp, err = shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	expected := []string{
+		`{"line":2,"correlation_id":"1","short_url":"http://localhost:8080/f2f978","status":201}`,
+		`{"line":3,"correlation_id":"2","short_url":"http://localhost:8080/my-link","status":201}`,
+		`{"line":4,"correlation_id":"3","status":400,"error":"invalid link https://example.com/5: alias is reserved"}`,
+		`{"line":5,"status":400,"error":"Invalid CSV: bare \" in non-quoted-field"}`,
+		`{"line":7,"correlation_id":"5","status":400,"error":"URL is required"}`,
+		`{"line":8,"correlation_id":"=1+1","short_url":"http://localhost:8080/c644bc","status":201}`,
+	}
+
+	require.Len(t, lines, len(expected))
+
+	for i, line := range lines {
+		assert.JSONEq(t, expected[i], line)
+	}
+
+	cookies := resp.Cookies()
+	export := func(format string) (int, string) {
+		req := httptest.NewRequest("GET", "/api/user/urls/export?format="+format, nil)
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := export("xml")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, exported := export("csv")
+	require.Equal(t, fiber.StatusOK, status)
+
+	records, err := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{"url", "alias", "tags", "correlation_id", "domain", "short_url", "created_at"}, records[0])
+	assert.Equal(t, []string{"https://example.com/7", "c644bc", "'-1,@team", "'=1+1", "", "http://localhost:8080/c644bc"}, records[1][:6],
+		"cells must not be evaluated as formulas")
+	assert.Equal(t, []string{"https://example.com/1", "f2f978", "news,tech", "1", "", "http://localhost:8080/f2f978"}, records[2][:6])
+	assert.Equal(t, []string{"https://example.com/4", "my-link", "", "2", "", "http://localhost:8080/my-link"}, records[3][:6])
+
+	status, exported = export("json")
+	require.Equal(t, fiber.StatusOK, status)
+
+	var links []struct {
+		OriginalURL string   `json:"original_url"`
+		Alias       string   `json:"alias"`
+		Tags        []string `json:"tags"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(exported), &links))
+	require.Len(t, links, 3)
+	assert.Equal(t, []string{"-1", "@team"}, links[0].Tags)
+	assert.Equal(t, "f2f978", links[1].Alias)
+	assert.Equal(t, []string{"news", "tech"}, links[1].Tags)
+	assert.Equal(t, "my-link", links[2].Alias)
+
+	// Importing the export again keeps the short URLs
+	var csvExport strings.Builder
+
+	require.NoError(t, csv.NewWriter(&csvExport).WriteAll(records))
+
+	req = httptest.NewRequest("POST", "/api/user/urls/import", strings.NewReader(csvExport.String()))
+	req.Header.Set("Content-Type", "text/csv")
+
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err = shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `"short_url":"http://localhost:8080/my-link","status":409`)
+	assert.Contains(t, string(body), `"correlation_id":"=1+1","short_url":"http://localhost:8080/c644bc","status":409`)
+}
+
+func TestDefaultJwtSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := initApp(config.WithDev(false))
+	require.Error(t, err, "the default secret is only allowed in development mode")
+
+	shortenerApp, err := initApp(config.WithDev(false), config.WithJwtSecret("not the default"))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	resp, err := shortenerApp.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+
+	issuer, err := oidctest.NewIssuer(oidctest.Identity{Subject: "idp|42", Email: "Jane@Example.com"})
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	shortenerApp, err := initApp(
+		config.WithOIDC(issuer.URL, oidctest.ClientID, oidctest.ClientSecret, "http://localhost/api/user/oidc/callback"),
+		config.WithCookie("", "/", true, "Lax"),
+	)
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	do := func(req *http.Request, cookies ...*http.Cookie) *http.Response {
+		t.Helper()
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	// Links shortened anonymously before logging in are claimed
+	req := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url":"https://example.com/oidc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := do(req)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	anonymous := resp.Cookies()
+
+	resp = do(httptest.NewRequest("GET", "/api/user/oidc/login", nil), anonymous...)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	loginState := resp.Cookies()
+	require.Len(t, loginState, 1)
+	assert.True(t, loginState[0].Secure, "the state cookie must follow the session cookie attributes")
+	assert.Equal(t, "/", loginState[0].Path)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	issuerResp, err := client.Get(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	issuerResp.Body.Close()
+	require.Equal(t, http.StatusFound, issuerResp.StatusCode)
+
+	callback, err := url.Parse(issuerResp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	forged := callback.Query()
+	forged.Set("state", "forged")
+	resp = do(httptest.NewRequest("GET", callback.Path+"?"+forged.Encode(), nil), loginState...)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, "state must match the login cookie")
+
+	resp = do(httptest.NewRequest("GET", callback.RequestURI(), nil), append(anonymous, loginState...)...)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/api/user", resp.Header.Get("Location"))
+	session := resp.Cookies()
+
+	resp = do(httptest.NewRequest("GET", "/api/user", nil), session...)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var user struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+	}
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&user))
+	assert.Equal(t, "oidc:"+issuer.URL+":idp|42", user.ID, "the user ID is namespaced by the issuer")
+	assert.Equal(t, "jane@example.com", user.Email)
+
+	resp = do(httptest.NewRequest("GET", "/api/user/urls", nil), session...)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = do(httptest.NewRequest("GET", callback.RequestURI(), nil), loginState...)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "codes are single use")
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp(config.WithMetrics("", "secret"))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	send := func(req *http.Request) int {
+		t.Helper()
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	for range 2 {
+		send(httptest.NewRequest("POST", "/", strings.NewReader("https://example.com/1")))
+	}
+
+	assert.Equal(t, fiber.StatusTemporaryRedirect, send(httptest.NewRequest("GET", "/f2f978", nil)))
+	assert.Equal(t, fiber.StatusNotFound, send(httptest.NewRequest("GET", "/unknown", nil)))
+	assert.Equal(t, fiber.StatusUnauthorized, send(httptest.NewRequest("GET", "/metrics", nil)))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := shortenerApp.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`shortener_http_requests_total{method="GET",route="/:hash",status="307"} 1`,
+		`shortener_http_requests_total{method="GET",route="/:hash",status="404"} 1`,
+		`shortener_http_requests_total{method="POST",route="/",status="409"} 1`,
+		`shortener_http_requests_total{method="GET",route="/metrics",status="401"} 1`,
+		`shortener_redirects_total{outcome="found"} 1`,
+		`shortener_redirects_total{outcome="not_found"} 1`,
+		`shortener_shorten_conflicts_total 1`,
+		`shortener_journal_size_bytes 0`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	redirect := func(shortenerApp *app.App, clientIP string) int {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/unknown", nil)
+		req.Header.Set("X-Real-IP", clientIP)
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	behindProxy, err := initApp(
+		config.WithRateLimits("", "1/1m", ""),
+		config.WithTrustedProxies("X-Real-IP", []string{"0.0.0.0/8"}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(behindProxy.Close)
+
+	assert.Equal(t, fiber.StatusNotFound, redirect(behindProxy, "192.0.2.1"))
+	assert.Equal(t, fiber.StatusNotFound, redirect(behindProxy, "192.0.2.2"), "clients behind the proxy must not share a bucket")
+	assert.Equal(t, fiber.StatusTooManyRequests, redirect(behindProxy, "192.0.2.1"))
+
+	untrusted, err := initApp(
+		config.WithRateLimits("", "1/1m", ""),
+		config.WithTrustedProxies("X-Real-IP", []string{"198.51.100.1"}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(untrusted.Close)
+
+	assert.Equal(t, fiber.StatusNotFound, redirect(untrusted, "192.0.2.1"))
+	assert.Equal(t, fiber.StatusTooManyRequests, redirect(untrusted, "192.0.2.2"), "clients must not pick their own IP")
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp(config.WithAuthRateLimit("2/1m"))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	login := func() int {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/api/user/login", strings.NewReader(`{"email":"jane@example.com","password":"guessed wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusUnauthorized, login())
+	assert.Equal(t, fiber.StatusUnauthorized, login())
+	assert.Equal(t, fiber.StatusTooManyRequests, login(), "fresh anonymous sessions must not reset the limit")
+}
+
+func TestAnonymousQuota(t *testing.T) {
+	t.Parallel()
+
+	shortenerApp, err := initApp(config.WithDailyLinkQuota(1))
+	require.NoError(t, err)
+	t.Cleanup(shortenerApp.Close)
+
+	shorten := func(originalURL string) int {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(originalURL))
+
+		resp, err := shortenerApp.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusCreated, shorten("https://example.com/first"))
+	assert.Equal(t, fiber.StatusTooManyRequests, shorten("https://example.com/second"), "fresh anonymous sessions must not reset the quota")
+}
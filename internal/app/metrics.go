@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/maxpain/shortener/config"
+	"github.com/maxpain/shortener/internal/metrics"
+	"github.com/maxpain/shortener/internal/repository/cache"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	postgresRepository "github.com/maxpain/shortener/internal/repository/postgres"
+)
+
+const metricsPath = "/metrics"
+
+// getMetrics returns nil unless metrics are exposed, on a listen address of
+// their own or behind a token.
+func getMetrics(cfg *config.Config) *metrics.Metrics {
+	if cfg.MetricsAddr == "" && cfg.MetricsToken == "" {
+		return nil
+	}
+
+	return metrics.New()
+}
+
+// metricsApp serves the metrics apart from the public routes.
+func metricsApp(m *metrics.Metrics, token string) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get(metricsPath, m.Handler(token))
+
+	return app
+}
+
+func registerPostgresMetrics(m *metrics.Metrics, db *pgxpool.Pool, repo *postgresRepository.Repository) {
+	m.Register(metrics.NewPoolCollector(db))
+	m.Gauge("deletion_queue_length", "Deletion requests waiting to be applied.", func() float64 {
+		return float64(repo.DeletionQueueLength())
+	})
+}
+
+func registerCacheMetrics(m *metrics.Metrics, linkCache *cache.Repository) {
+	m.Counter("link_cache_hits_total", "Links served from the cache.", func() float64 {
+		return float64(linkCache.Stats().Hits)
+	})
+	m.Counter("link_cache_negative_hits_total", "Unknown links answered from the cache.", func() float64 {
+		return float64(linkCache.Stats().NegativeHits)
+	})
+	m.Counter("link_cache_misses_total", "Links loaded from the database.", func() float64 {
+		return float64(linkCache.Stats().Misses)
+	})
+	m.Counter("link_cache_evictions_total", "Links evicted to make room for others.", func() float64 {
+		return float64(linkCache.Stats().Evictions)
+	})
+	m.Gauge("link_cache_entries", "Links in the cache.", func() float64 {
+		return float64(linkCache.Stats().Entries)
+	})
+}
+
+func registerMemoryMetrics(m *metrics.Metrics, repo *memoryRepository.Repository, logger *slog.Logger) {
+	m.Gauge("journal_size_bytes", "Size of the file the links are persisted to.", func() float64 {
+		size, err := repo.JournalSize()
+		if err != nil {
+			logger.Error("Failed to get journal size", slog.Any("error", err))
+		}
+
+		return float64(size)
+	})
+}
+
+// Listen serves the metrics on their own address, if any, along with the app.
+func (a *App) Listen(addr string) error {
+	if a.metricsApp != nil {
+		// Listening first fails startup on a busy address
+		ln, err := net.Listen("tcp", a.metricsAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for metrics on %s: %w", a.metricsAddr, err)
+		}
+
+		go func() {
+			if err := a.metricsApp.Listener(ln); err != nil {
+				a.logger.Error("Failed to serve metrics", slog.Any("error", err))
+			}
+		}()
+	}
+
+	return a.App.Listen(addr) //nolint:wrapcheck
+}
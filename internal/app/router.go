@@ -1,73 +1,134 @@
 package app
 
 import (
+	"io"
 	"log/slog"
-	"time"
+	"slices"
 
-	jwtMiddleware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	compressMiddleware "github.com/gofiber/fiber/v2/middleware/compress"
 	loggerMiddleware "github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
-	"github.com/maxpain/shortener/config"
+	"github.com/maxpain/shortener/internal/auth"
 	"github.com/maxpain/shortener/internal/handler"
+	"github.com/maxpain/shortener/internal/model"
 )
 
+// Streamed paths take batches of any size.
+const (
+	streamBatchPath = "/api/shorten/batch/stream"
+	importPath      = "/api/user/urls/import"
+)
+
+// rateLimits are the middlewares enforcing the rate limit policies.
+type rateLimits struct {
+	shorten  fiber.Handler
+	redirect fiber.Handler
+	read     fiber.Handler
+	auth     fiber.Handler
+}
+
 func setupRoutes(
 	app *fiber.App,
-	cfg *config.Config,
 	logger *slog.Logger,
+	sessions *auth.Sessions,
+	apiKeys auth.APIKeyAuthenticator,
+	trustedOrigins []string,
+	limits *rateLimits,
 	handler *handler.LinkHandler,
+	domainHandler *handler.DomainHandler,
+	workspaceHandler *handler.WorkspaceHandler,
+	userHandler *handler.UserHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	oidcHandler *handler.OIDCHandler,
+	metricsHandler fiber.Handler,
 ) {
 	app.Use(compressMiddleware.New())
 	app.Use(loggerMiddleware.New())
-	app.Use(jwtMiddleware.New(jwtMiddleware.Config{
-		SigningKey: jwtMiddleware.SigningKey{
-			JWTAlg: "HS256",
-			Key:    []byte(cfg.JwtSecret),
-		},
-		TokenLookup: "cookie:auth",
-		ErrorHandler: func(c *fiber.Ctx, _ error) error {
-			if c.Method() != "POST" {
-				return c.Next()
-			}
-
-			expiresAt := time.Now().Add(time.Hour * 72)
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-				"userID": uuid.New().String(),
-				"exp":    expiresAt.Unix(),
-			})
-
-			t, err := token.SignedString([]byte(cfg.JwtSecret))
-			if err != nil {
-				logger.Error("Failed to sign JWT token", slog.Any("error", err))
-
-				return c.SendStatus(fiber.StatusInternalServerError)
-			}
-
-			c.Cookie(&fiber.Cookie{
-				Name:     "auth",
-				Value:    t,
-				Expires:  expiresAt,
-				HTTPOnly: true,
-			})
-
-			c.Locals("user", token)
+	app.Use(limitBody(fiber.DefaultBodyLimit, streamBatchPath, importPath))
 
-			return c.Next()
-		},
-	}))
+	// Served here unless metrics have a listen address of their own. Their
+	// bearer token would be taken for an API key further down.
+	if metricsHandler != nil {
+		app.Get(metricsPath, metricsHandler)
+	}
+
+	app.Use(auth.APIKeyMiddleware(apiKeys, logger))
+	app.Use(auth.CrossOriginProtection(trustedOrigins...))
+	app.Use(sessions.Middleware())
+
+	read := auth.RequireScope(model.ScopeRead)
+	shorten := auth.RequireScope(model.ScopeShorten)
+	remove := auth.RequireScope(model.ScopeDelete)
+	session := auth.RequireSession()
 
 	app.Get("/ping", handler.Ping)
+	app.Get("/.well-known/jwks.json", sessions.JWKS)
 
 	// Plain routes
-	app.Get("/:hash", handler.Redirect)
-	app.Post("/", handler.ShortenSinglePlain)
+	app.Get("/:hash\\+", limits.redirect, handler.Preview) // Must be registered before the redirect route
+	app.Get("/:hash", limits.redirect, handler.Redirect)
+	app.Post("/", limits.shorten, shorten, handler.ShortenSinglePlain)
 
 	// API routes
-	app.Get("/api/user/urls", handler.GetUserLinks)
-	app.Delete("/api/user/urls", handler.DeleteUserLinks)
-	app.Post("/api/shorten", handler.ShortenSingleJSON)
-	app.Post("/api/shorten/batch", handler.ShortenBatchJSON)
+	app.Get("/api/user/urls", limits.read, read, handler.GetUserLinks)
+	app.Get("/api/user/urls/export", limits.read, read, handler.ExportLinks)
+	app.Post(importPath, limits.shorten, shorten, handler.ImportLinks)
+	app.Get("/api/user/urls/:hash/stats", limits.read, read, handler.GetLinkStats)
+	app.Delete("/api/user/urls", remove, handler.DeleteUserLinks)
+	app.Post("/api/shorten", limits.shorten, shorten, handler.ShortenSingleJSON)
+	app.Post("/api/shorten/batch", limits.shorten, shorten, handler.ShortenBatchJSON)
+	app.Post(streamBatchPath, limits.shorten, shorten, handler.ShortenBatchStream)
+	app.Get("/api/qr/:hash", limits.read, handler.QRCode)
+	app.Get("/api/user/domains", limits.read, read, domainHandler.GetUserDomains)
+	app.Post("/api/user/domains", session, domainHandler.Register)
+	app.Post("/api/user/domains/:domain/verify", session, domainHandler.Verify)
+	app.Get("/api/user/workspaces", limits.read, read, workspaceHandler.GetUserWorkspaces)
+	app.Post("/api/user/workspaces", session, workspaceHandler.Create)
+	app.Get("/api/user/workspaces/:id/members", limits.read, read, workspaceHandler.GetMembers)
+	app.Post("/api/user/workspaces/:id/invitations", session, workspaceHandler.Invite)
+	app.Post("/api/user/invitations/:token/accept", session, workspaceHandler.Accept)
+	app.Get("/api/user", limits.read, read, userHandler.GetUser)
+	app.Post("/api/user/signup", limits.auth, session, userHandler.SignUp)
+	app.Post("/api/user/login", limits.auth, session, userHandler.Login)
+	app.Post("/api/user/logout", session, userHandler.Logout)
+	app.Get("/api/user/keys", session, apiKeyHandler.GetUserAPIKeys)
+	app.Post("/api/user/keys", session, apiKeyHandler.Create)
+	app.Delete("/api/user/keys/:id", session, apiKeyHandler.Revoke)
+
+	// Identity provider login, only when one is configured
+	if oidcHandler != nil {
+		app.Get("/api/user/oidc/login", session, oidcHandler.Login)
+		app.Get("/api/user/oidc/callback", session, oidcHandler.Callback)
+	}
+
+	// Trailing path passthrough, registered last so it never shadows API routes
+	app.Get("/:hash/*", limits.redirect, handler.Redirect)
+}
+
+// limitBody reads request bodies up to the limit into memory for the
+// handlers parsing them whole. The app streams large bodies so that the
+// streamed paths can read them as they arrive, any other path gets 413.
+func limitBody(limit int, streamed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stream := c.Context().RequestBodyStream()
+		if stream == nil || slices.Contains(streamed, c.Path()) {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if len(body) > limit {
+			// The rest of the body is still unread on the connection
+			c.Context().SetConnectionClose()
+
+			return c.SendStatus(fiber.StatusRequestEntityTooLarge)
+		}
+
+		c.Request().SetBody(body)
+
+		return c.Next()
+	}
 }
@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrossOriginProtection(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	app.Use(auth.CrossOriginProtection("https://app.example.com"))
+	app.All("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		cookie  bool
+		headers map[string]string
+		want    int
+	}{
+		{
+			name:    "safe method",
+			method:  "GET",
+			cookie:  true,
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site"},
+			want:    fiber.StatusNoContent,
+		},
+		{
+			name:    "cross-site POST with cookie",
+			method:  "POST",
+			cookie:  true,
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"},
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "same-site DELETE with cookie",
+			method:  "DELETE",
+			cookie:  true,
+			headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://sub.example.com"},
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "same-origin POST",
+			method:  "POST",
+			cookie:  true,
+			headers: map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://example.com"},
+			want:    fiber.StatusNoContent,
+		},
+		{
+			name:    "trusted origin",
+			method:  "POST",
+			cookie:  true,
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.com"},
+			want:    fiber.StatusNoContent,
+		},
+		{
+			name:    "old browser, foreign origin",
+			method:  "POST",
+			cookie:  true,
+			headers: map[string]string{"Origin": "https://evil.example"},
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "old browser, same host",
+			method:  "POST",
+			cookie:  true,
+			headers: map[string]string{"Origin": "http://example.com"},
+			want:    fiber.StatusNoContent,
+		},
+		{
+			name:   "not a browser",
+			method: "POST",
+			cookie: true,
+			want:   fiber.StatusNoContent,
+		},
+		{
+			name:    "cross-site POST without cookie",
+			method:  "POST",
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"},
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:   "not a browser, without cookie",
+			method: "POST",
+			want:   fiber.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com/", nil)
+
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: "token"})
+			}
+
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	errUnknownKeyID       = errors.New("unknown key ID")
+	errUnexpectedMethod   = errors.New("unexpected signing method")
+	errUnsupportedKeyType = errors.New("unsupported key type")
+	errEmptySecret        = errors.New("empty secret")
+)
+
+// Key signs and verifies session tokens. Its ID goes into the kid header.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// NewHMACKey returns an HS256 key for a shared secret.
+func NewHMACKey(secret []byte) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, errEmptySecret
+	}
+
+	return &Key{
+		ID:     keyID(secret),
+		method: jwt.SigningMethodHS256,
+		sign:   secret,
+		verify: secret,
+	}, nil
+}
+
+// LoadKey reads a key file. PEM files hold an Ed25519 (EdDSA) or RSA (RS256)
+// private key in PKCS #8 or, for RSA, PKCS #1 form. Anything else is taken
+// as an HS256 secret.
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return NewHMACKey([]byte(strings.TrimSpace(string(data))))
+	}
+
+	var privateKey any
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return newAsymmetricKey(privateKey)
+}
+
+func newAsymmetricKey(privateKey any) (*Key, error) {
+	var method jwt.SigningMethod
+
+	switch privateKey.(type) {
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("%w: %T", errUnsupportedKeyType, privateKey)
+	}
+
+	publicKey := privateKey.(crypto.Signer).Public()
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	return &Key{
+		ID:     keyID(der),
+		method: method,
+		sign:   privateKey,
+		verify: publicKey,
+	}, nil
+}
+
+// keyID derives a stable ID from the key material, so operators do not
+// have to name keys.
+func keyID(material []byte) string {
+	sum := sha256.Sum256(material)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// Keyset signs tokens with the active key and verifies them against the
+// active and retired keys, so the signing key can be rotated without
+// logging everyone out.
+type Keyset struct {
+	active *Key
+	all    []*Key
+	keys   map[string]*Key
+	// legacy verifies tokens issued before tokens carried a kid header
+	legacy *Key
+}
+
+func NewKeyset(active *Key, retired ...*Key) *Keyset {
+	k := &Keyset{
+		active: active,
+		all:    append([]*Key{active}, retired...),
+		keys:   make(map[string]*Key, len(retired)+1),
+	}
+
+	for _, key := range k.all {
+		k.keys[key.ID] = key
+
+		if k.legacy == nil && key.method == jwt.SigningMethodHS256 {
+			k.legacy = key
+		}
+	}
+
+	return k
+}
+
+// Sign signs the token with the active key.
+func (k *Keyset) Sign(claims jwt.Claims) (*jwt.Token, string, error) {
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.ID
+
+	signed, err := token.SignedString(k.active.sign)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign JWT token: %w", err)
+	}
+
+	return token, signed, nil
+}
+
+// Keyfunc picks the verification key by the kid header.
+func (k *Keyset) Keyfunc(token *jwt.Token) (any, error) {
+	key := k.legacy
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = k.keys[kid]
+	}
+
+	if key == nil {
+		return nil, errUnknownKeyID
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: %s", errUnexpectedMethod, token.Method.Alg())
+	}
+
+	return key.verify, nil
+}
+
+// JSONWebKey is a public key in JWKS form.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. HMAC keys are secret and left
+// out, so the set is empty when only HS256 is used.
+func (k *Keyset) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range k.all {
+		jwk := JSONWebKey{
+			KeyID:     key.ID,
+			Algorithm: key.method.Alg(),
+			Use:       "sig",
+		}
+
+		switch publicKey := key.verify.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
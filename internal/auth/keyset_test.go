@@ -0,0 +1,93 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maxpain/shortener/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyFile(t *testing.T, name string, block *pem.Block) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+
+	return path
+}
+
+func TestKeyset(t *testing.T) {
+	t.Parallel()
+
+	_, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivateKey)
+	require.NoError(t, err)
+
+	edKey, err := auth.LoadKey(writeKeyFile(t, "ed25519.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rsaKey, err := auth.LoadKey(writeKeyFile(t, "rsa.pem", &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivateKey),
+	}))
+	require.NoError(t, err)
+
+	secretKey, err := auth.NewHMACKey([]byte("old secret"))
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{auth.UserIDClaim: "user-id"}
+
+	// Tokens signed before the rotation stay valid while the key is retired
+	_, oldToken, err := auth.NewKeyset(rsaKey).Sign(claims)
+	require.NoError(t, err)
+
+	keys := auth.NewKeyset(edKey, rsaKey, secretKey)
+
+	_, newToken, err := keys.Sign(claims)
+	require.NoError(t, err)
+
+	for _, signed := range []string{oldToken, newToken} {
+		token, err := jwt.Parse(signed, keys.Keyfunc)
+		require.NoError(t, err)
+		assert.Equal(t, "user-id", token.Claims.(jwt.MapClaims)[auth.UserIDClaim])
+	}
+
+	// Tokens from before kid headers were added are checked against the secret
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("old secret"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(legacyToken, keys.Keyfunc)
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(oldToken, auth.NewKeyset(edKey).Keyfunc)
+	require.Error(t, err, "tokens of dropped keys must be rejected")
+
+	// The kid must not let a token pick a different algorithm
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = rsaKey.ID
+	forgedToken, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&rsaPrivateKey.PublicKey))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(forgedToken, keys.Keyfunc)
+	require.Error(t, err)
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2, "HMAC secrets must not be published")
+	assert.Equal(t, edKey.ID, jwks.Keys[0].KeyID)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/maxpain/shortener/internal/model"
+	"golang.org/x/oauth2"
+)
+
+var (
+	errMissingIDToken = errors.New("token response has no id_token")
+	errNonceMismatch  = errors.New("id_token nonce does not match")
+	errMissingSubject = errors.New("id_token has no sub claim")
+)
+
+// OIDC signs users in with an OpenID Connect provider using the
+// authorization code flow.
+type OIDC struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC discovers the provider endpoints and signing keys from the issuer.
+func NewOIDC(ctx context.Context, issuer string, clientID string, clientSecret string, redirectURL string) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	return &OIDC{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// AuthCodeURL returns the provider URL the user is sent to for signing in.
+func (o *OIDC) AuthCodeURL(state string, nonce string) string {
+	return o.config.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange redeems the authorization code and verifies the returned ID
+// token against the provider keys and the nonce of the login request.
+func (o *OIDC) Exchange(ctx context.Context, code string, nonce string) (*model.ExternalIdentity, error) {
+	token, err := o.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errMissingIDToken
+	}
+
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errNonceMismatch
+	}
+
+	if idToken.Subject == "" {
+		return nil, errMissingSubject
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+
+	return &model.ExternalIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Email:   claims.Email,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRevocationCacheTTL  = 30 * time.Second
+	defaultRevocationCacheSize = 10000
+)
+
+// revocationCache remembers recent revocation checks, so that requests
+// bearing a session, redirects included, do not each query the revocation
+// list. Sessions revoked by other instances are rejected once the checks
+// expire.
+type revocationCache struct {
+	list RevocationList
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]revocationCheck
+}
+
+type revocationCheck struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+func newRevocationCache(list RevocationList) *revocationCache {
+	return &revocationCache{
+		list:    list,
+		ttl:     defaultRevocationCacheTTL,
+		size:    defaultRevocationCacheSize,
+		entries: make(map[string]revocationCheck),
+	}
+}
+
+func (c *revocationCache) IsTokenRevoked(ctx context.Context, id string, now time.Time) (bool, error) {
+	c.mu.Lock()
+	check, ok := c.entries[id]
+	c.mu.Unlock()
+
+	if ok && now.Before(check.expiresAt) {
+		return check.revoked, nil
+	}
+
+	revoked, err := c.list.IsTokenRevoked(ctx, id)
+	if err != nil {
+		return false, err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	c.remember(id, revoked, now)
+
+	return revoked, nil
+}
+
+func (c *revocationCache) RevokeToken(ctx context.Context, id string, expiresAt time.Time, now time.Time) error {
+	if err := c.list.RevokeToken(ctx, id, expiresAt); err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	c.remember(id, true, now)
+
+	return nil
+}
+
+func (c *revocationCache) remember(id string, revoked bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		for id, check := range c.entries {
+			if !now.Before(check.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+
+		// Every check is recent, so a burst of sessions is going on
+		if len(c.entries) >= c.size {
+			clear(c.entries)
+		}
+	}
+
+	c.entries[id] = revocationCheck{revoked: revoked, expiresAt: now.Add(c.ttl)}
+}
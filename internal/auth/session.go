@@ -0,0 +1,361 @@
+// Package auth issues and verifies the session cookies identifying users.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	jwtMiddleware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+const (
+	CookieName = "auth"
+	// UserIDClaim holds the user ID: an account ID after login, a random
+	// anonymous ID otherwise.
+	UserIDClaim = "userID"
+	// AccountClaim marks sessions started by logging in, as opposed to the
+	// anonymous sessions anyone can start.
+	AccountClaim = "account"
+	// SessionStartClaim holds when the session started, which renewals keep.
+	SessionStartClaim = "auth_time"
+
+	defaultSessionTTL  = 72 * time.Hour
+	defaultRenewBefore = 24 * time.Hour
+	defaultMaxLifetime = 30 * 24 * time.Hour
+)
+
+var (
+	errInvalidSameSite      = errors.New("SameSite must be Strict, Lax or None")
+	errInsecureSameSiteNone = errors.New("SameSite=None requires a secure cookie")
+)
+
+// RevocationList remembers revoked sessions by their jti claim until
+// expiresAt. Renewed tokens keep the jti, so revoking it ends the session
+// for good.
+type RevocationList interface {
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// CookieAttributes scope the session cookie. Secure should be set whenever
+// the app is served over HTTPS.
+type CookieAttributes struct {
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite string
+}
+
+func (a CookieAttributes) Validate() error {
+	switch strings.ToLower(a.SameSite) {
+	case fiber.CookieSameSiteStrictMode, fiber.CookieSameSiteLaxMode:
+	case fiber.CookieSameSiteNoneMode:
+		if !a.Secure {
+			return errInsecureSameSiteNone
+		}
+	default:
+		return fmt.Errorf("%w, got %q", errInvalidSameSite, a.SameSite)
+	}
+
+	return nil
+}
+
+// Sessions keeps the user identity in a signed JWT cookie.
+type Sessions struct {
+	logger      *slog.Logger
+	keys        *Keyset
+	revocations *revocationCache
+	ttl         time.Duration
+	renewBefore time.Duration
+	// maxLifetime bounds how long renewals keep a session alive, and so how
+	// long its revocation must be remembered.
+	maxLifetime time.Duration
+	cookie      CookieAttributes
+	clock       func() time.Time
+}
+
+type Option func(*Sessions)
+
+func New(keys *Keyset, revocations RevocationList, logger *slog.Logger, opts ...Option) *Sessions {
+	s := &Sessions{
+		logger: logger.With(
+			slog.String("component", "sessions"),
+		),
+		keys:        keys,
+		revocations: newRevocationCache(revocations),
+		ttl:         defaultSessionTTL,
+		renewBefore: defaultRenewBefore,
+		maxLifetime: defaultMaxLifetime,
+		cookie: CookieAttributes{
+			Path:     "/",
+			SameSite: fiber.CookieSameSiteLaxMode,
+		},
+		clock: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Sessions) {
+		s.ttl = ttl
+	}
+}
+
+// WithRenewBefore sets how close to expiry a session is renewed.
+func WithRenewBefore(renewBefore time.Duration) Option {
+	return func(s *Sessions) {
+		s.renewBefore = renewBefore
+	}
+}
+
+// WithMaxLifetime sets how long after it started a session ends, however
+// often it was renewed.
+func WithMaxLifetime(maxLifetime time.Duration) Option {
+	return func(s *Sessions) {
+		s.maxLifetime = maxLifetime
+	}
+}
+
+func WithClock(clock func() time.Time) Option {
+	return func(s *Sessions) {
+		s.clock = clock
+	}
+}
+
+func WithCookieAttributes(attributes CookieAttributes) Option {
+	return func(s *Sessions) {
+		s.cookie = attributes
+	}
+}
+
+// Middleware verifies the session cookie and stores the token in the "user"
+// local. Sessions close to expiry are renewed, so active users stay logged
+// in. POST requests without a valid session get a new anonymous one, so
+// visitors can shorten links without signing up.
+func (s *Sessions) Middleware() fiber.Handler {
+	return jwtMiddleware.New(jwtMiddleware.Config{
+		// Requests authenticated by an API key already carry a user
+		Filter:         IsAPIKeyRequest,
+		KeyFunc:        s.keys.Keyfunc,
+		TokenLookup:    "cookie:" + CookieName,
+		SuccessHandler: s.verified,
+		ErrorHandler: func(c *fiber.Ctx, _ error) error {
+			return s.unauthenticated(c)
+		},
+	})
+}
+
+func (s *Sessions) verified(c *fiber.Ctx) error {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return s.unauthenticated(c)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return s.unauthenticated(c)
+	}
+
+	now := s.clock()
+	jti, _ := claims["jti"].(string)
+	// Sessions from before the claim was added started at the latest when
+	// their token was issued
+	startedAt, ok := timeClaim(claims, SessionStartClaim)
+	if !ok {
+		startedAt, ok = timeClaim(claims, "iat")
+	}
+
+	// Tokens without an ID could not be revoked
+	if jti == "" || !ok || !now.Before(startedAt.Add(s.maxLifetime)) {
+		c.Locals("user", nil)
+
+		return s.unauthenticated(c)
+	}
+
+	revoked, err := s.revocations.IsTokenRevoked(c.Context(), jti, now)
+	if err != nil {
+		s.logger.Error("Failed to check session revocation", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if revoked {
+		c.Locals("user", nil)
+
+		return s.unauthenticated(c)
+	}
+
+	expiresAt, ok := timeClaim(claims, "exp")
+	if ok && expiresAt.Sub(now) < s.renewBefore {
+		userID, _ := claims[UserIDClaim].(string)
+		account, _ := claims[AccountClaim].(bool)
+
+		// The current session is still valid, so a failed renewal is not
+		// worth failing the request
+		if err := s.issue(c, userID, jti, startedAt, account); err != nil {
+			s.logger.Error("Failed to renew session", slog.Any("error", err))
+		}
+	}
+
+	return c.Next()
+}
+
+func (s *Sessions) unauthenticated(c *fiber.Ctx) error {
+	if c.Method() != fiber.MethodPost {
+		return c.Next()
+	}
+
+	if err := s.issue(c, uuid.New().String(), "", time.Time{}, false); err != nil {
+		s.logger.Error("Failed to issue anonymous session", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Next()
+}
+
+// Issue starts a session for the logged in user, replacing the current one.
+func (s *Sessions) Issue(c *fiber.Ctx, userID string) error {
+	return s.issue(c, userID, "", time.Time{}, true)
+}
+
+// issue signs a token for the session, starting a new one if jti is empty.
+// Renewed tokens expire with the session at the latest.
+func (s *Sessions) issue(c *fiber.Ctx, userID string, jti string, startedAt time.Time, account bool) error {
+	now := s.clock()
+
+	if jti == "" {
+		jti = uuid.New().String()
+		startedAt = now
+	}
+
+	expiresAt := now.Add(s.ttl)
+	if end := startedAt.Add(s.maxLifetime); end.Before(expiresAt) {
+		expiresAt = end
+	}
+
+	claims := jwt.MapClaims{
+		UserIDClaim:       userID,
+		SessionStartClaim: startedAt.Unix(),
+		"jti":             jti,
+		"iat":             now.Unix(),
+		"exp":             expiresAt.Unix(),
+	}
+
+	if account {
+		claims[AccountClaim] = true
+	}
+
+	token, signed, err := s.keys.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	s.setCookie(c, signed, expiresAt)
+	c.Locals("user", token)
+
+	return nil
+}
+
+func (s *Sessions) setCookie(c *fiber.Ctx, value string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Domain:   s.cookie.Domain,
+		Path:     s.cookie.Path,
+		Expires:  expiresAt,
+		Secure:   s.cookie.Secure,
+		HTTPOnly: true,
+		SameSite: s.cookie.SameSite,
+	})
+}
+
+// Revoke ends the current session. Its tokens, including copies of the
+// cookie from before or after renewals, are rejected from now on.
+func (s *Sessions) Revoke(c *fiber.Ctx) error {
+	// The browser only drops the cookie if domain and path match
+	s.setCookie(c, "", time.Unix(0, 0))
+
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil
+	}
+
+	c.Locals("user", nil)
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+
+	// A stolen copy may be renewed after this token expires, but no copy
+	// outlives the max lifetime of a session that started before now
+	now := s.clock()
+
+	if err := s.revocations.RevokeToken(c.Context(), jti, now.Add(s.maxLifetime), now); err != nil {
+		return fmt.Errorf("failed to revoke session token: %w", err)
+	}
+
+	return nil
+}
+
+// AccountID returns the ID of the account that made the request, through
+// an API key or a logged in session. Anonymous sessions are free to start,
+// so they do not identify a client.
+func AccountID(c *fiber.Ctx) (string, bool) {
+	if apiKey, ok := c.Locals(apiKeyLocal).(*model.APIKey); ok {
+		return apiKey.UserID, true
+	}
+
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return "", false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+
+	userID, _ := claims[UserIDClaim].(string)
+	account, _ := claims[AccountClaim].(bool)
+
+	return userID, account && userID != ""
+}
+
+// timeClaim reads a time claim of both parsed tokens, where it is a
+// float64, and tokens issued by this request, where it is an int64.
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool) {
+	switch value := claims[name].(type) {
+	case int64:
+		return time.Unix(value, 0), true
+	case float64:
+		return time.Unix(int64(value), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// JWKS serves the public keys sessions are signed with, so other services
+// can verify them.
+func (s *Sessions) JWKS(c *fiber.Ctx) error {
+	return c.JSON(s.keys.JWKS())
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maxpain/shortener/internal/auth"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	key, err := auth.NewHMACKey([]byte("test secret"))
+	require.NoError(t, err)
+
+	keys := auth.NewKeyset(key)
+	now := time.Now()
+
+	// Every session is within the renewal window
+	sessions := auth.New(keys, memoryRepository.New(nil, logger), logger,
+		auth.WithTTL(time.Hour),
+		auth.WithRenewBefore(2*time.Hour),
+		auth.WithMaxLifetime(3*time.Hour),
+		auth.WithClock(func() time.Time { return now }),
+	)
+
+	app := fiber.New()
+	app.Use(sessions.Middleware())
+	app.Post("/logout", func(c *fiber.Ctx) error {
+		require.NoError(t, sessions.Revoke(c))
+
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.All("/", func(c *fiber.Ctx) error {
+		token, ok := c.Locals("user").(*jwt.Token)
+		if !ok {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return c.SendString(token.Claims.(jwt.MapClaims)[auth.UserIDClaim].(string))
+	})
+
+	do := func(method string, path string, cookie *http.Cookie) (*http.Response, string) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(body)
+	}
+
+	sessionCookie := func(resp *http.Response) *http.Cookie {
+		t.Helper()
+
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == auth.CookieName {
+				return cookie
+			}
+		}
+
+		return nil
+	}
+
+	resp, _ := do("GET", "/", nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "GET requests do not start sessions")
+
+	resp, userID := do("POST", "/", nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	original := sessionCookie(resp)
+	require.NotNil(t, original)
+
+	resp, renewedUserID := do("GET", "/", original)
+	assert.Equal(t, userID, renewedUserID)
+	renewed := sessionCookie(resp)
+	require.NotNil(t, renewed, "sessions near expiry must be renewed on any request")
+
+	resp, _ = do("POST", "/logout", renewed)
+	require.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+
+	for _, cookie := range []*http.Cookie{original, renewed} {
+		resp, _ = do("GET", "/", cookie)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "logout must revoke the session and its renewals")
+	}
+
+	resp, anonymousID := do("POST", "/", original)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, userID, anonymousID, "a revoked session is replaced by a new anonymous one")
+
+	_, unrevocable, err := keys.Sign(jwt.MapClaims{
+		auth.UserIDClaim: userID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	resp, _ = do("GET", "/", &http.Cookie{Name: auth.CookieName, Value: unrevocable})
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "tokens without an ID must be rejected")
+
+	resp, _ = do("POST", "/", nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	cookie := sessionCookie(resp)
+	require.NotNil(t, cookie)
+
+	for range 2 {
+		now = now.Add(time.Hour)
+
+		resp, _ = do("GET", "/", cookie)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		cookie = sessionCookie(resp)
+		require.NotNil(t, cookie)
+	}
+
+	now = now.Add(time.Hour)
+
+	resp, _ = do("GET", "/", cookie)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "renewals must not outlive the max lifetime")
+}
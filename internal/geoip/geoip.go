@@ -0,0 +1,59 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var errInvalidIP = errors.New("invalid IP address")
+
+// DB resolves client IP addresses to countries using a local MaxMind-format
+// database such as GeoLite2-Country.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+
+	return &DB{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country the IP belongs to,
+// or an empty string if the database has no record for it.
+func (d *DB) Country(ip string) (string, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", errInvalidIP
+	}
+
+	var r record
+
+	err := d.reader.Lookup(parsedIP, &r)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup IP: %w", err)
+	}
+
+	return r.Country.ISOCode, nil
+}
+
+func (d *DB) Close() error {
+	err := d.reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close GeoIP database: %w", err)
+	}
+
+	return nil
+}
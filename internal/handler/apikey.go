@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+type APIKeyUseCase interface {
+	Create(ctx context.Context, name string, scopes []model.Scope, userID string) (*model.APIKey, string, error)
+	GetUserAPIKeys(ctx context.Context, userID string) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, id string, userID string) error
+}
+
+type APIKeyHandler struct {
+	logger  *slog.Logger
+	useCase APIKeyUseCase
+}
+
+func NewAPIKeyHandler(u APIKeyUseCase, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		logger: logger.With(
+			slog.String("handler", "apikey"),
+		),
+		useCase: u,
+	}
+}
+
+// Create issues a key. The response is the only place the key is shown.
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var r struct {
+		Name   string        `json:"name"`
+		Scopes []model.Scope `json:"scopes"`
+	}
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid JSON payload"})
+	}
+
+	key, plaintext, err := h.useCase.Create(c.Context(), r.Name, r.Scopes, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidScope) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrAccountRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		h.logger.Error("Failed to create API key", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	type Response struct {
+		*model.APIKey
+		Key string `json:"key"`
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(Response{APIKey: key, Key: plaintext})
+}
+
+func (h *APIKeyHandler) GetUserAPIKeys(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	keys, err := h.useCase.GetUserAPIKeys(c.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get API keys", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if len(keys) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	return c.JSON(keys)
+}
+
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = h.useCase.Revoke(c.Context(), c.Params("id"), userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "API key not found"})
+		}
+
+		h.logger.Error("Failed to revoke API key", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
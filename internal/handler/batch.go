@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+// maxStreamLineSize bounds a single link of a streamed batch.
+const maxStreamLineSize = 1 << 20
+
+// StreamResult reports the outcome for one line of a streamed batch.
+type StreamResult struct {
+	Line          int    `json:"line"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        int    `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// nextLink reads the next link of a streamed batch, with its result to
+// fill in. Items rejected while reading come without a link and with the
+// result telling why. It returns io.EOF at the end of the batch, and any
+// other error when the rest of the batch cannot be read.
+type nextLink func() (*model.Link, *StreamResult, error)
+
+// ShortenBatchStream shortens links sent as NDJSON, one link per line, and
+// streams back a result line for each. Links are read as they arrive and
+// stored in chunks, so batches of any size are imported in constant memory.
+// Results come in the order of the lines and carry their line number.
+func (h *LinkHandler) ShortenBatchStream(c *fiber.Ctx) error {
+	userID, err := h.getUserIDFromContext(c)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	h.streamBatch(c, ndjsonLinks(requestBody(c)), userID)
+
+	return nil
+}
+
+// requestBody returns the request body as it arrives, if the app streams
+// request bodies.
+func requestBody(c *fiber.Ctx) io.Reader {
+	if body := c.Context().RequestBodyStream(); body != nil {
+		return body
+	}
+
+	return bytes.NewReader(slices.Clone(c.Body()))
+}
+
+func ndjsonLinks(body io.Reader) nextLink {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxStreamLineSize)
+
+	line := 0
+
+	return func() (*model.Link, *StreamResult, error) {
+		for scanner.Scan() {
+			line++
+
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+
+			var link model.Link
+
+			if err := json.Unmarshal(data, &link); err != nil {
+				return nil, &StreamResult{Line: line, Status: fiber.StatusBadRequest, Error: "Invalid JSON payload"}, nil
+			}
+
+			return &link, &StreamResult{Line: line}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, &StreamResult{
+				Line:   line + 1,
+				Status: fiber.StatusRequestEntityTooLarge,
+				Error:  "Line is too long or could not be read",
+			}, err
+		}
+
+		return nil, nil, io.EOF
+	}
+}
+
+// streamBatch shortens the links in chunks and streams back NDJSON results
+// once each chunk is stored.
+func (h *LinkHandler) streamBatch(c *fiber.Ctx, next nextLink, userID string) {
+	// The fiber context is released when the handler returns, the request
+	// context lives until the response is written
+	ctx := c.Context()
+	body := ctx.RequestBodyStream()
+	quotaKey := quotaKey(c)
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		if !h.writeBatch(ctx, next, w, userID, quotaKey) && body != nil {
+			// Whatever was not read would be taken for the next request
+			_, _ = io.Copy(io.Discard, body)
+		}
+	})
+}
+
+// writeBatch reports whether it read the whole batch. Streamed bodies must
+// not be read past their end, it would block on the connection.
+func (h *LinkHandler) writeBatch(
+	ctx context.Context,
+	next nextLink,
+	w *bufio.Writer,
+	userID string,
+	quotaKey string,
+) bool {
+	encoder := json.NewEncoder(w)
+	results := make([]*StreamResult, 0, h.maxBatchSize)
+	links := make([]*model.Link, 0, h.maxBatchSize)
+	pending := make([]*StreamResult, 0, h.maxBatchSize)
+	quotaExceeded := false
+
+	flush := func() bool {
+		if len(links) > 0 {
+			quotaExceeded = h.shortenChunk(ctx, links, pending, userID, quotaKey, quotaExceeded)
+		}
+
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return false
+			}
+		}
+
+		results, links, pending = results[:0], links[:0], pending[:0]
+
+		// Clients see the results as soon as the chunk is stored
+		return w.Flush() == nil
+	}
+
+	for {
+		link, result, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if result != nil {
+			results = append(results, result)
+		}
+
+		if err != nil {
+			flush()
+
+			return false
+		}
+
+		if link != nil {
+			result.CorrelationID = link.CorrelationID
+
+			if link.OriginalURL == "" {
+				result.Status = fiber.StatusBadRequest
+				result.Error = "URL is required"
+			} else {
+				links = append(links, link)
+				pending = append(pending, result)
+			}
+		}
+
+		if len(results) >= h.maxBatchSize && !flush() {
+			return false
+		}
+	}
+
+	flush()
+
+	return true
+}
+
+// shortenChunk stores the links and fills in their results. A chunk
+// rejected because of some of its links is retried link by link, so the
+// valid ones are still stored. It reports whether the quota ran out, after
+// which links are no longer attempted.
+func (h *LinkHandler) shortenChunk(
+	ctx context.Context,
+	links []*model.Link,
+	results []*StreamResult,
+	userID string,
+	quotaKey string,
+	quotaExceeded bool,
+) bool {
+	if quotaExceeded {
+		for _, result := range results {
+			setStreamError(result, model.ErrQuotaExceeded)
+		}
+
+		return true
+	}
+
+	shortenedLinks, err := h.useCase.Shorten(ctx, links, h.baseURL, userID, quotaKey)
+	if err == nil {
+		for i, shortenedLink := range shortenedLinks {
+			results[i].ShortURL = shortenedLink.ShortURL
+			results[i].Status = fiber.StatusCreated
+
+			if !shortenedLink.Saved {
+				results[i].Status = fiber.StatusConflict
+			}
+		}
+
+		return false
+	}
+
+	if len(links) > 1 && streamErrorStatus(err) != fiber.StatusInternalServerError {
+		for i := range links {
+			quotaExceeded = h.shortenChunk(ctx, links[i:i+1], results[i:i+1], userID, quotaKey, quotaExceeded)
+		}
+
+		return quotaExceeded
+	}
+
+	if streamErrorStatus(err) == fiber.StatusInternalServerError {
+		h.logger.Error("Failed to shorten URLs", slog.Any("error", err))
+	}
+
+	for _, result := range results {
+		setStreamError(result, err)
+	}
+
+	return errors.Is(err, model.ErrQuotaExceeded)
+}
+
+func setStreamError(result *StreamResult, err error) {
+	result.Status = streamErrorStatus(err)
+	result.Error = err.Error()
+
+	if result.Status == fiber.StatusInternalServerError {
+		result.Error = "Internal server error"
+	}
+}
+
+func streamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrInvalidLink):
+		return fiber.StatusBadRequest
+	case errors.Is(err, model.ErrForbidden):
+		return fiber.StatusForbidden
+	case errors.Is(err, model.ErrQuotaExceeded):
+		return fiber.StatusTooManyRequests
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
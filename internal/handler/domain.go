@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+type DomainUseCase interface {
+	Register(ctx context.Context, name string, userID string, workspaceID string) (*model.Domain, error)
+	Verify(ctx context.Context, name string, userID string) (*model.Domain, error)
+	GetUserDomains(ctx context.Context, userID string) ([]*model.Domain, error)
+}
+
+// DomainResponse tells where to publish the verification token.
+type DomainResponse struct {
+	*model.Domain
+	VerificationRecord string `json:"verification_record"`
+}
+
+func newDomainResponse(domain *model.Domain) DomainResponse {
+	return DomainResponse{Domain: domain, VerificationRecord: domain.VerificationRecord()}
+}
+
+type DomainHandler struct {
+	logger  *slog.Logger
+	useCase DomainUseCase
+}
+
+func NewDomainHandler(u DomainUseCase, logger *slog.Logger) *DomainHandler {
+	return &DomainHandler{
+		logger: logger.With(
+			slog.String("handler", "domain"),
+		),
+		useCase: u,
+	}
+}
+
+// Register binds a custom domain to the current user, or to a workspace they
+// own. The domain must point to this service, and its verification token be
+// published as a TXT record, for its links to work.
+func (h *DomainHandler) Register(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var r struct {
+		Domain      string `json:"domain"`
+		WorkspaceID string `json:"workspace_id"`
+	}
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid JSON payload"})
+	}
+
+	domain, err := h.useCase.Register(c.Context(), r.Domain, userID, r.WorkspaceID)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidDomain) || errors.Is(err, model.ErrDomainReserved) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrDomainTaken) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		h.logger.Error("Failed to register domain", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newDomainResponse(domain))
+}
+
+// Verify checks the TXT record of the domain, after which its links are
+// served.
+func (h *DomainHandler) Verify(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	domain, err := h.useCase.Verify(c.Context(), c.Params("domain"), userID)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidDomain) || errors.Is(err, model.ErrUnknownDomain) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrDomainNotVerified) || errors.Is(err, model.ErrDomainTaken) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		h.logger.Error("Failed to verify domain", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(newDomainResponse(domain))
+}
+
+func (h *DomainHandler) GetUserDomains(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	domains, err := h.useCase.GetUserDomains(c.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get user domains", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if len(domains) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	response := make([]DomainResponse, 0, len(domains))
+
+	for _, domain := range domains {
+		response = append(response, newDomainResponse(domain))
+	}
+
+	return c.JSON(response)
+}
@@ -3,38 +3,109 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/maxpain/shortener/internal/auth"
 	"github.com/maxpain/shortener/internal/model"
 )
 
 type LinkUseCase interface {
-	Shorten(ctx context.Context, links []*model.Link, baseURL string, userID string) ([]*model.ShortenedLink, error)
-	Resolve(ctx context.Context, hash string) (string, error)
-	GetUserLinks(ctx context.Context, baseURL string, userID string) ([]*model.UserLink, error)
-	DeleteUserLinks(hashes []string, userID string) error
+	Shorten(ctx context.Context, links []*model.Link, baseURL string, userID string, quotaKey string) ([]*model.ShortenedLink, error)
+	Resolve(ctx context.Context, host string, hash string, visitor *model.Visitor) (*model.Destination, error)
+	Preview(ctx context.Context, host string, hash string, baseURL string) (*model.LinkPreview, error)
+	GetShortURL(ctx context.Context, host string, hash string, baseURL string) (string, error)
+	GetUserLinks(ctx context.Context, baseURL string, userID string, filter model.LinkFilter) ([]*model.UserLink, error)
+	ExportUserLinks(ctx context.Context, baseURL string, userID string, yield func(*model.ExportedLink) error) error
+	GetLinkStats(ctx context.Context, host string, hash string, userID string) (*model.LinkStats, error)
+	DeleteUserLinks(ctx context.Context, host string, hashes []string, userID string, workspaceID string) error
 	Ping(ctx context.Context) error
 }
 
+const (
+	variantCookiePrefix = "ab_"
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+
+	// Links may still be edited or deleted, which cached redirects miss
+	defaultRedirectMaxAge = time.Hour
+
+	defaultInterstitialDelay = 5
+	defaultMaxBatchSize      = 1000
+)
+
 type LinkHandler struct {
-	logger  *slog.Logger
-	baseURL string
-	useCase LinkUseCase
+	logger            *slog.Logger
+	baseURL           string
+	useCase           LinkUseCase
+	comingSoon        bool
+	interstitialDelay int
+	maxBatchSize      int
+	redirectMaxAge    time.Duration
 }
 
-func New(u LinkUseCase, logger *slog.Logger, baseURL string) *LinkHandler {
-	return &LinkHandler{
+type Option func(*LinkHandler)
+
+func New(u LinkUseCase, logger *slog.Logger, baseURL string, opts ...Option) *LinkHandler {
+	h := &LinkHandler{
 		logger: logger.With(
 			slog.String("handler", "link"),
 		),
-		baseURL: baseURL,
-		useCase: u,
+		baseURL:           baseURL,
+		useCase:           u,
+		interstitialDelay: defaultInterstitialDelay,
+		maxBatchSize:      defaultMaxBatchSize,
+		redirectMaxAge:    defaultRedirectMaxAge,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// WithComingSoonPage makes Redirect render a placeholder page for links
+// that are not active yet instead of answering 404.
+func WithComingSoonPage(enabled bool) Option {
+	return func(h *LinkHandler) {
+		h.comingSoon = enabled
+	}
+}
+
+// WithInterstitialDelay sets how many seconds the interstitial page waits
+// before redirecting. Zero disables the automatic redirect.
+func WithInterstitialDelay(seconds int) Option {
+	return func(h *LinkHandler) {
+		h.interstitialDelay = seconds
+	}
+}
+
+// WithRedirectMaxAge sets how long clients may cache permanent redirects.
+func WithRedirectMaxAge(maxAge time.Duration) Option {
+	return func(h *LinkHandler) {
+		h.redirectMaxAge = maxAge
+	}
+}
+
+// WithMaxBatchSize limits how many links a batch request may shorten.
+// Streamed batches are stored in chunks of this size.
+func WithMaxBatchSize(size int) Option {
+	return func(h *LinkHandler) {
+		h.maxBatchSize = size
 	}
 }
 
 func (h *LinkHandler) getUserIDFromContext(c *fiber.Ctx) (string, error) {
+	return getUserID(c, h.logger)
+}
+
+func getUserID(c *fiber.Ctx, logger *slog.Logger) (string, error) {
 	token, ok := c.Locals("user").(*jwt.Token)
 	if !ok {
 		return "", errUnauthorized
@@ -42,14 +113,14 @@ func (h *LinkHandler) getUserIDFromContext(c *fiber.Ctx) (string, error) {
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		h.logger.Debug("Failed to get claims from token")
+		logger.Debug("Failed to get claims from token")
 
 		return "", errGetClaimsFromToken
 	}
 
 	userID, ok := claims["userID"].(string)
 	if !ok {
-		h.logger.Debug("Failed to get userID from claims")
+		logger.Debug("Failed to get userID from claims")
 
 		return "", errGetUserIDFromClaims
 	}
@@ -57,6 +128,37 @@ func (h *LinkHandler) getUserIDFromContext(c *fiber.Ctx) (string, error) {
 	return userID, nil
 }
 
+// quotaKey identifies whom the links of the request count against the daily
+// quota: the account, or the client address for anonymous sessions, which
+// anyone may start as many of as they like.
+func quotaKey(c *fiber.Ctx) string {
+	if userID, ok := auth.AccountID(c); ok {
+		return "user:" + userID
+	}
+
+	return "ip:" + c.IP()
+}
+
+// setQuotaRetryAfter tells the client when the daily quota resets.
+func setQuotaRetryAfter(c *fiber.Ctx) {
+	now := time.Now()
+	seconds := int64((model.QuotaReset(now).Sub(now) + time.Second - 1) / time.Second)
+
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(seconds, 10))
+}
+
+// requestHost returns the lowercased host the request was sent to, without
+// the port. Links are scoped by it when it is a registered custom domain.
+func requestHost(c *fiber.Ctx) string {
+	host := c.Hostname()
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	return strings.ToLower(host)
+}
+
 func (h *LinkHandler) Ping(c *fiber.Ctx) error {
 	err := h.useCase.Ping(c.Context())
 	if err != nil {
@@ -75,22 +177,114 @@ func (h *LinkHandler) Redirect(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Short URL is required")
 	}
 
-	originalURL, err := h.useCase.Resolve(c.Context(), shortURL)
+	visitor := &model.Visitor{
+		UserAgent:      c.Get(fiber.HeaderUserAgent),
+		AcceptLanguage: c.Get(fiber.HeaderAcceptLanguage),
+		IP:             c.IP(),
+		Variant:        c.Cookies(variantCookiePrefix + shortURL),
+		Query:          string(c.Request().URI().QueryString()),
+		Path:           c.Params("*"),
+	}
+
+	destination, err := h.useCase.Resolve(c.Context(), requestHost(c), shortURL, visitor)
 	if err != nil {
-		if errors.Is(err, model.ErrNotFound) {
-			return c.Status(fiber.StatusNotFound).SendString("URL not found")
-		}
+		return h.sendResolveError(c, err)
+	}
 
-		if errors.Is(err, model.ErrDeleted) {
-			return c.SendStatus(fiber.StatusGone)
-		}
+	if destination.Variant != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     variantCookiePrefix + shortURL,
+			Value:    destination.Variant,
+			Path:     "/" + shortURL,
+			MaxAge:   variantCookieMaxAge,
+			HTTPOnly: true,
+		})
+	}
 
-		h.logger.Error("Failed to resolve URL", slog.Any("error", err))
+	if destination.Interstitial {
+		return h.renderInterstitial(c, destination.URL)
+	}
 
-		return c.SendStatus(fiber.StatusInternalServerError)
+	switch {
+	case !destination.Cacheable:
+		c.Set(fiber.HeaderCacheControl, "no-store")
+	case model.IsPermanentRedirect(destination.StatusCode):
+		c.Set(fiber.HeaderCacheControl, h.redirectCacheControl(destination.NotAfter))
+	}
+
+	return c.Redirect(destination.URL, destination.StatusCode)
+}
+
+// redirectCacheControl lets clients cache permanent redirects, but never past
+// the end of the activation window of the link.
+func (h *LinkHandler) redirectCacheControl(notAfter *time.Time) string {
+	maxAge := h.redirectMaxAge
+
+	if notAfter != nil {
+		maxAge = min(maxAge, time.Until(*notAfter))
+	}
+
+	if maxAge < time.Second {
+		return "no-store"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
+}
+
+// renderInterstitial warns the visitor about leaving for an external site.
+func (h *LinkHandler) renderInterstitial(c *fiber.Ctx, url string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+
+	return templates.ExecuteTemplate(c, "interstitial.html", struct {
+		URL   string
+		Delay int
+	}{
+		URL:   url,
+		Delay: h.interstitialDelay,
+	})
+}
+
+// Preview renders an HTML page describing the link instead of redirecting.
+func (h *LinkHandler) Preview(c *fiber.Ctx) error {
+	preview, err := h.useCase.Preview(c.Context(), requestHost(c), c.Params("hash"), h.baseURL)
+	if err != nil {
+		return h.sendResolveError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+
+	return templates.ExecuteTemplate(c, "preview.html", preview)
+}
+
+func (h *LinkHandler) sendResolveError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, model.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString("URL not found")
+	}
+
+	if errors.Is(err, model.ErrDeleted) || errors.Is(err, model.ErrExpired) {
+		return c.SendStatus(fiber.StatusGone)
 	}
 
-	return c.Redirect(originalURL, fiber.StatusTemporaryRedirect)
+	if errors.Is(err, model.ErrNotActive) {
+		return h.renderNotActive(c)
+	}
+
+	h.logger.Error("Failed to resolve URL", slog.Any("error", err))
+
+	return c.SendStatus(fiber.StatusInternalServerError)
+}
+
+func (h *LinkHandler) renderNotActive(c *fiber.Ctx) error {
+	if !h.comingSoon {
+		return c.Status(fiber.StatusNotFound).SendString("URL not found")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+
+	return templates.ExecuteTemplate(c, "coming_soon.html", nil)
 }
 
 func (h *LinkHandler) ShortenSinglePlain(c *fiber.Ctx) error {
@@ -112,8 +306,15 @@ func (h *LinkHandler) ShortenSinglePlain(c *fiber.Ctx) error {
 		[]*model.Link{{OriginalURL: originalURL}},
 		h.baseURL,
 		userID,
+		quotaKey(c),
 	)
 	if err != nil {
+		if errors.Is(err, model.ErrQuotaExceeded) {
+			setQuotaRetryAfter(c)
+
+			return c.Status(fiber.StatusTooManyRequests).SendString(err.Error())
+		}
+
 		h.logger.Error("Failed to shorten URL", slog.Any("error", err))
 
 		return c.SendStatus(fiber.StatusInternalServerError)
@@ -143,7 +344,16 @@ func (h *LinkHandler) ShortenSingleJSON(c *fiber.Ctx) error {
 	}
 
 	var r struct {
-		URL string `json:"url"`
+		URL            string             `json:"url"`
+		NotBefore      *time.Time         `json:"not_before"`
+		NotAfter       *time.Time         `json:"not_after"`
+		Rules          []model.Rule       `json:"rules"`
+		Variants       []model.Variant    `json:"variants"`
+		RedirectStatus int                `json:"redirect_status"`
+		Passthrough    *model.Passthrough `json:"passthrough"`
+		UTM            *model.UTM         `json:"utm"`
+		Domain         string             `json:"domain"`
+		WorkspaceID    string             `json:"workspace_id"`
 	}
 
 	if err := c.BodyParser(&r); err != nil {
@@ -154,8 +364,35 @@ func (h *LinkHandler) ShortenSingleJSON(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "URL is required"})
 	}
 
-	shortenedLinks, err := h.useCase.Shorten(c.Context(), []*model.Link{{OriginalURL: r.URL}}, h.baseURL, userID)
+	link := &model.Link{
+		OriginalURL:    r.URL,
+		NotBefore:      r.NotBefore,
+		NotAfter:       r.NotAfter,
+		Rules:          r.Rules,
+		Variants:       r.Variants,
+		RedirectStatus: r.RedirectStatus,
+		Passthrough:    r.Passthrough,
+		UTM:            r.UTM,
+		Domain:         r.Domain,
+		WorkspaceID:    r.WorkspaceID,
+	}
+
+	shortenedLinks, err := h.useCase.Shorten(c.Context(), []*model.Link{link}, h.baseURL, userID, quotaKey(c))
 	if err != nil {
+		if errors.Is(err, model.ErrInvalidLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrQuotaExceeded) {
+			setQuotaRetryAfter(c)
+
+			return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{Error: err.Error()})
+		}
+
 		h.logger.Error("Failed to shorten URL", slog.Any("error", err))
 
 		return c.SendStatus(fiber.StatusInternalServerError)
@@ -198,8 +435,28 @@ func (h *LinkHandler) ShortenBatchJSON(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "URLs are required"})
 	}
 
-	shortenedLinks, err := h.useCase.Shorten(c.Context(), links, h.baseURL, userID)
+	if len(links) > h.maxBatchSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Batch exceeds %d links, use the streaming endpoint instead", h.maxBatchSize),
+		})
+	}
+
+	shortenedLinks, err := h.useCase.Shorten(c.Context(), links, h.baseURL, userID, quotaKey(c))
 	if err != nil {
+		if errors.Is(err, model.ErrInvalidLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		if errors.Is(err, model.ErrQuotaExceeded) {
+			setQuotaRetryAfter(c)
+
+			return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{Error: err.Error()})
+		}
+
 		h.logger.Error("Failed to shorten URLs", slog.Any("error", err))
 
 		return c.SendStatus(fiber.StatusInternalServerError)
@@ -236,8 +493,17 @@ func (h *LinkHandler) GetUserLinks(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	links, err := h.useCase.GetUserLinks(c.Context(), h.baseURL, userID)
+	filter := model.LinkFilter{
+		Campaign:    c.Query("campaign"),
+		WorkspaceID: c.Query("workspace"),
+	}
+
+	links, err := h.useCase.GetUserLinks(c.Context(), h.baseURL, userID, filter)
 	if err != nil {
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
 		h.logger.Error("Failed to get user links", slog.Any("error", err))
 
 		return c.SendStatus(fiber.StatusInternalServerError)
@@ -250,6 +516,32 @@ func (h *LinkHandler) GetUserLinks(c *fiber.Ctx) error {
 	return c.JSON(links)
 }
 
+func (h *LinkHandler) GetLinkStats(c *fiber.Ctx) error {
+	userID, err := h.getUserIDFromContext(c)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	stats, err := h.useCase.GetLinkStats(c.Context(), c.Query("domain", requestHost(c)), c.Params("hash"), userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "URL not found"})
+		}
+
+		h.logger.Error("Failed to get link stats", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(stats)
+}
+
 func (h *LinkHandler) DeleteUserLinks(c *fiber.Ctx) error {
 	userID, err := h.getUserIDFromContext(c)
 	if err != nil {
@@ -268,8 +560,12 @@ func (h *LinkHandler) DeleteUserLinks(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Hashes are required"})
 	}
 
-	err = h.useCase.DeleteUserLinks(hashes, userID)
+	err = h.useCase.DeleteUserLinks(c.Context(), c.Query("domain", requestHost(c)), hashes, userID, c.Query("workspace"))
 	if err != nil {
+		if errors.Is(err, model.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+
 		h.logger.Error("Failed to delete user links", slog.Any("error", err))
 
 		return c.SendStatus(fiber.StatusInternalServerError)
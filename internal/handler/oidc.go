@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+const (
+	oidcCookieName = "oidc"
+	oidcCookieTTL  = 10 * time.Minute
+	// defaultPostLoginURL shows the account that was signed in to.
+	defaultPostLoginURL = "/api/user"
+)
+
+type OIDCProvider interface {
+	AuthCodeURL(state string, nonce string) string
+	Exchange(ctx context.Context, code string, nonce string) (*model.ExternalIdentity, error)
+}
+
+type OIDCUseCase interface {
+	LoginExternal(ctx context.Context, identity *model.ExternalIdentity, anonymousID string) (*model.User, error)
+}
+
+type OIDCHandler struct {
+	logger       *slog.Logger
+	provider     OIDCProvider
+	useCase      OIDCUseCase
+	sessions     SessionIssuer
+	postLoginURL string
+	cookieDomain string
+	cookiePath   string
+	cookieSecure bool
+}
+
+type OIDCOption func(*OIDCHandler)
+
+func NewOIDCHandler(
+	provider OIDCProvider,
+	u OIDCUseCase,
+	sessions SessionIssuer,
+	logger *slog.Logger,
+	opts ...OIDCOption,
+) *OIDCHandler {
+	h := &OIDCHandler{
+		logger: logger.With(
+			slog.String("handler", "oidc"),
+		),
+		provider:     provider,
+		useCase:      u,
+		sessions:     sessions,
+		postLoginURL: defaultPostLoginURL,
+		cookiePath:   "/",
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// WithPostLoginURL sets where users are sent once logged in.
+func WithPostLoginURL(url string) OIDCOption {
+	return func(h *OIDCHandler) {
+		if url != "" {
+			h.postLoginURL = url
+		}
+	}
+}
+
+// WithStateCookie scopes the login state cookie like the session cookie.
+func WithStateCookie(domain string, path string, secure bool) OIDCOption {
+	return func(h *OIDCHandler) {
+		h.cookieDomain = domain
+		h.cookiePath = path
+		h.cookieSecure = secure
+	}
+}
+
+// Login sends the user to the identity provider. The state and nonce are
+// kept in a short-lived cookie and checked when the provider redirects back.
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	state, err := randomToken()
+	if err != nil {
+		h.logger.Error("Failed to generate OIDC state", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		h.logger.Error("Failed to generate OIDC nonce", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcCookieName,
+		Value:    state + "." + nonce,
+		Domain:   h.cookieDomain,
+		Path:     h.cookiePath,
+		Expires:  time.Now().Add(oidcCookieTTL),
+		Secure:   h.cookieSecure,
+		HTTPOnly: true,
+		// Lax lets the cookie through on the provider's top-level redirect
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(h.provider.AuthCodeURL(state, nonce), fiber.StatusFound)
+}
+
+// Callback completes the login the provider redirected back from and starts
+// a session for the account of the provider subject. Links created with the
+// current anonymous session are moved to the account.
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	state, nonce, ok := strings.Cut(c.Cookies(oidcCookieName), ".")
+
+	// The browser only drops the cookie if domain and path match
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcCookieName,
+		Domain:   h.cookieDomain,
+		Path:     h.cookiePath,
+		Expires:  time.Unix(0, 0),
+		Secure:   h.cookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if !ok || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid or expired login state"})
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Login failed: " + providerError})
+	}
+
+	identity, err := h.provider.Exchange(c.Context(), c.Query("code"), nonce)
+	if err != nil {
+		h.logger.Warn("Failed to complete OIDC login", slog.Any("error", err))
+
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Login failed"})
+	}
+
+	// The callback is a GET, so there is only an anonymous session if the
+	// visitor made a POST before
+	anonymousID, err := getUserID(c, h.logger)
+	if err != nil && !errors.Is(err, errUnauthorized) {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	user, err := h.useCase.LoginExternal(c.Context(), identity, anonymousID)
+	if err != nil {
+		h.logger.Error("Failed to log in external user", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if err := h.sessions.Issue(c, user.ID); err != nil {
+		h.logger.Error("Failed to issue session", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Redirect(h.postLoginURL, fiber.StatusFound)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
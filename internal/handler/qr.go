@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/qr"
+)
+
+// QRCode renders the short URL of a link as a PNG or SVG QR code.
+func (h *LinkHandler) QRCode(c *fiber.Ctx) error {
+	opts := qr.Options{
+		Format: c.Query("format", qr.FormatPNG),
+		Size:   c.QueryInt("size", qr.DefaultSize),
+		Level:  c.Query("level", qr.DefaultLevel),
+		Margin: c.QueryInt("margin", qr.DefaultMargin),
+	}
+
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+
+	shortURL, err := h.useCase.GetShortURL(c.Context(), c.Query("domain", requestHost(c)), c.Params("hash"), h.baseURL)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "URL not found"})
+		}
+
+		if errors.Is(err, model.ErrDeleted) {
+			return c.SendStatus(fiber.StatusGone)
+		}
+
+		h.logger.Error("Failed to get short URL", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	etag := qrETag(shortURL, opts)
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+
+	// Fresh matches the ETag against lists, weak tags and *. Without
+	// If-None-Match it would trust If-Modified-Since, but there is no
+	// Last-Modified to compare it with.
+	if c.Get(fiber.HeaderIfNoneMatch) != "" && c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	image, err := qr.Render(shortURL, opts)
+	if err != nil {
+		if errors.Is(err, qr.ErrInvalidOptions) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		h.logger.Error("Failed to render QR code", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	c.Set(fiber.HeaderContentType, opts.ContentType())
+
+	return c.Send(image)
+}
+
+func qrETag(shortURL string, opts qr.Options) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%d",
+		shortURL, opts.Format, opts.Size, opts.Level, opts.Margin,
+	)))
+
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
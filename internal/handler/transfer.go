@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+var exportHeader = []string{"url", "alias", "tags", "correlation_id", "domain", "short_url", "created_at"}
+
+// importColumns maps the accepted CSV header names to the link fields.
+var importColumns = map[string]string{
+	"url":            "url",
+	"original_url":   "url",
+	"long_url":       "url",
+	"alias":          "alias",
+	"tags":           "tags",
+	"correlation_id": "correlation_id",
+	"domain":         "domain",
+}
+
+// ImportLinks shortens the links of a CSV file, as exported by this or
+// another shortener. The header names the columns, of which only url is
+// required. Like the streamed batch endpoint, it stores the rows in chunks
+// and streams back an NDJSON result line for each, with its line number.
+func (h *LinkHandler) ImportLinks(c *fiber.Ctx) error {
+	userID, err := h.getUserIDFromContext(c)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	reader := csv.NewReader(requestBody(c))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	columns, err := importHeader(reader)
+	if err != nil {
+		if c.Context().RequestBodyStream() != nil {
+			// The rest of the body is still unread on the connection
+			c.Context().SetConnectionClose()
+		}
+
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+
+	h.streamBatch(c, csvLinks(reader, columns), userID)
+
+	return nil
+}
+
+// importHeader reads the header and returns the field of each column,
+// empty for the columns that are ignored.
+func importHeader(reader *csv.Reader) ([]string, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV header is missing or invalid")
+	}
+
+	columns := make([]string, len(header))
+	hasURL := false
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+
+		columns[i] = importColumns[name]
+		hasURL = hasURL || columns[i] == "url"
+	}
+
+	if !hasURL {
+		return nil, errors.New("CSV header has no url column")
+	}
+
+	return columns, nil
+}
+
+func csvLinks(reader *csv.Reader, columns []string) nextLink {
+	return func() (*model.Link, *StreamResult, error) {
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil, nil, io.EOF
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				// The reader resumes at the next line
+				return nil, &StreamResult{
+					Line:   parseErr.StartLine,
+					Status: fiber.StatusBadRequest,
+					Error:  "Invalid CSV: " + parseErr.Err.Error(),
+				}, nil
+			}
+
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+
+				return nil, &StreamResult{
+					Line:   line + 1,
+					Status: fiber.StatusRequestEntityTooLarge,
+					Error:  "Row could not be read",
+				}, err
+			}
+
+			if isBlankRecord(record) {
+				continue
+			}
+
+			line, _ := reader.FieldPos(0)
+
+			return csvLink(record, columns), &StreamResult{Line: line}, nil
+		}
+	}
+}
+
+func csvLink(record []string, columns []string) *model.Link {
+	link := &model.Link{}
+
+	for i, value := range record {
+		if i >= len(columns) {
+			break
+		}
+
+		value = unescapeFormula(strings.TrimSpace(value))
+
+		switch columns[i] {
+		case "url":
+			link.OriginalURL = value
+		case "alias":
+			link.Alias = value
+		case "tags":
+			link.Tags = splitTags(value)
+		case "correlation_id":
+			link.CorrelationID = value
+		case "domain":
+			link.Domain = value
+		}
+	}
+
+	return link
+}
+
+// splitTags splits a list of tags separated by commas, semicolons or pipes.
+func splitTags(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(model.TagSeparators, r)
+	})
+
+	tags := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		if tag := strings.TrimSpace(field); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return tags
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExportLinks streams the links of the user as CSV, or as a JSON array with
+// format=json. Both can be imported back, keeping the short URLs.
+func (h *LinkHandler) ExportLinks(c *fiber.Ctx) error {
+	userID, err := h.getUserIDFromContext(c)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// The fiber context is released when the handler returns
+	ctx := c.Context()
+
+	var write func(w *bufio.Writer) error
+
+	format := c.Query("format", "csv")
+
+	switch format {
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+
+		write = func(w *bufio.Writer) error {
+			return h.exportCSV(ctx, w, userID)
+		}
+	case "json":
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		write = func(w *bufio.Writer) error {
+			return h.exportJSON(ctx, w, userID)
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Format must be csv or json"})
+	}
+
+	c.Attachment("links." + format)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := write(w); err != nil {
+			h.logger.Error("Failed to export user links", slog.Any("error", err))
+		}
+
+		_ = w.Flush()
+	})
+
+	return nil
+}
+
+func (h *LinkHandler) exportCSV(ctx context.Context, w *bufio.Writer, userID string) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(exportHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	err := h.useCase.ExportUserLinks(ctx, h.baseURL, userID, func(link *model.ExportedLink) error {
+		return writer.Write([]string{
+			escapeFormula(link.OriginalURL),
+			escapeFormula(link.Alias),
+			escapeFormula(strings.Join(link.Tags, ",")),
+			escapeFormula(link.CorrelationID),
+			escapeFormula(link.Domain),
+			escapeFormula(link.ShortURL),
+			link.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// formulaPrefixes start cells that spreadsheets evaluate as formulas. A
+// quote makes them text, and is prefixed to cells starting with a quote too,
+// so that importing the export strips exactly the one added.
+const formulaPrefixes = "=+-@'"
+
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+
+	return value
+}
+
+func (h *LinkHandler) exportJSON(ctx context.Context, w *bufio.Writer, userID string) error {
+	encoder := json.NewEncoder(w)
+	separator := "["
+
+	err := h.useCase.ExportUserLinks(ctx, h.baseURL, userID, func(link *model.ExportedLink) error {
+		if _, err := w.WriteString(separator); err != nil {
+			return err
+		}
+
+		separator = ","
+
+		return encoder.Encode(link)
+	})
+	if err != nil {
+		return err
+	}
+
+	if separator == "[" {
+		_, err = w.WriteString("[]\n")
+	} else {
+		_, err = w.WriteString("]\n")
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+type UserUseCase interface {
+	SignUp(ctx context.Context, email string, password string, anonymousID string) (*model.User, error)
+	Login(ctx context.Context, email string, password string, anonymousID string) (*model.User, error)
+	GetUser(ctx context.Context, id string) (*model.User, error)
+}
+
+// SessionIssuer starts a session for the user by setting the auth cookie.
+type SessionIssuer interface {
+	Issue(c *fiber.Ctx, userID string) error
+}
+
+type SessionManager interface {
+	SessionIssuer
+	// Revoke ends the current session.
+	Revoke(c *fiber.Ctx) error
+}
+
+type UserHandler struct {
+	logger   *slog.Logger
+	useCase  UserUseCase
+	sessions SessionManager
+}
+
+func NewUserHandler(u UserUseCase, sessions SessionManager, logger *slog.Logger) *UserHandler {
+	return &UserHandler{
+		logger: logger.With(
+			slog.String("handler", "user"),
+		),
+		useCase:  u,
+		sessions: sessions,
+	}
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// SignUp creates an account and logs the user in. Links created with the
+// current anonymous session are moved to the account.
+func (h *UserHandler) SignUp(c *fiber.Ctx) error {
+	return h.authenticate(c, h.useCase.SignUp, fiber.StatusCreated)
+}
+
+// Login starts a session for the account. Links created with the current
+// anonymous session are moved to the account.
+func (h *UserHandler) Login(c *fiber.Ctx) error {
+	return h.authenticate(c, h.useCase.Login, fiber.StatusOK)
+}
+
+func (h *UserHandler) authenticate(
+	c *fiber.Ctx,
+	authenticate func(ctx context.Context, email string, password string, anonymousID string) (*model.User, error),
+	status int,
+) error {
+	anonymousID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var r credentials
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid JSON payload"})
+	}
+
+	user, err := authenticate(c.Context(), r.Email, r.Password, anonymousID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidEmail), errors.Is(err, model.ErrWeakPassword):
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrEmailTaken):
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrInvalidCredentials):
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+		}
+
+		h.logger.Error("Failed to authenticate user", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if err := h.sessions.Issue(c, user.ID); err != nil {
+		h.logger.Error("Failed to issue session", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(status).JSON(user)
+}
+
+// Logout revokes the current session. The next POST starts a new anonymous
+// one.
+func (h *UserHandler) Logout(c *fiber.Ctx) error {
+	if err := h.sessions.Revoke(c); err != nil {
+		h.logger.Error("Failed to revoke session", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetUser returns the account of the current session, or 404 if the session
+// is anonymous.
+func (h *UserHandler) GetUser(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	user, err := h.useCase.GetUser(c.Context(), userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Session is anonymous"})
+		}
+
+		h.logger.Error("Failed to get user", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(user)
+}
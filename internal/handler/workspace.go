@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+type WorkspaceUseCase interface {
+	Create(ctx context.Context, name string, userID string) (*model.Workspace, error)
+	GetUserWorkspaces(ctx context.Context, userID string) ([]*model.Workspace, error)
+	GetMembers(ctx context.Context, workspaceID string, userID string) ([]*model.Member, error)
+	Invite(ctx context.Context, workspaceID string, role model.Role, userID string) (*model.Invitation, error)
+	Accept(ctx context.Context, token string, userID string) (*model.Member, error)
+}
+
+type WorkspaceHandler struct {
+	logger  *slog.Logger
+	useCase WorkspaceUseCase
+}
+
+func NewWorkspaceHandler(u WorkspaceUseCase, logger *slog.Logger) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		logger: logger.With(
+			slog.String("handler", "workspace"),
+		),
+		useCase: u,
+	}
+}
+
+func (h *WorkspaceHandler) Create(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var r struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid JSON payload"})
+	}
+
+	workspace, err := h.useCase.Create(c.Context(), r.Name, userID)
+	if err != nil {
+		return h.sendError(c, err, "Failed to create workspace")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(workspace)
+}
+
+func (h *WorkspaceHandler) GetUserWorkspaces(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	workspaces, err := h.useCase.GetUserWorkspaces(c.Context(), userID)
+	if err != nil {
+		return h.sendError(c, err, "Failed to get user workspaces")
+	}
+
+	if len(workspaces) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	return c.JSON(workspaces)
+}
+
+func (h *WorkspaceHandler) GetMembers(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	members, err := h.useCase.GetMembers(c.Context(), c.Params("id"), userID)
+	if err != nil {
+		return h.sendError(c, err, "Failed to get workspace members")
+	}
+
+	return c.JSON(members)
+}
+
+// Invite creates an invitation token that can be shared with the new member.
+func (h *WorkspaceHandler) Invite(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var r struct {
+		Role model.Role `json:"role"`
+	}
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid JSON payload"})
+	}
+
+	invitation, err := h.useCase.Invite(c.Context(), c.Params("id"), r.Role, userID)
+	if err != nil {
+		return h.sendError(c, err, "Failed to create invitation")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+func (h *WorkspaceHandler) Accept(c *fiber.Ctx) error {
+	userID, err := getUserID(c, h.logger)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from context", slog.Any("error", err))
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	member, err := h.useCase.Accept(c.Context(), c.Params("token"), userID)
+	if err != nil {
+		return h.sendError(c, err, "Failed to accept invitation")
+	}
+
+	return c.JSON(member)
+}
+
+func (h *WorkspaceHandler) sendError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, model.ErrInvalidWorkspace), errors.Is(err, model.ErrInvalidRole):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrInvitationInactive):
+		return c.Status(fiber.StatusGone).JSON(ErrorResponse{Error: err.Error()})
+	}
+
+	h.logger.Error(message, slog.Any("error", err))
+
+	return c.SendStatus(fiber.StatusInternalServerError)
+}
@@ -0,0 +1,402 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 1024
+	defaultTimeout     = 5 * time.Second
+	defaultMaxBodySize = 1 << 20
+	maxRedirects       = 5
+)
+
+var (
+	ErrForbiddenAddress = errors.New("destination resolves to a private address")
+	ErrUnsupportedURL   = errors.New("only http and https URLs are supported")
+	ErrNotHTML          = errors.New("destination is not an HTML page")
+	errTooManyRedirects = errors.New("too many redirects")
+	errUnexpectedStatus = errors.New("unexpected response status")
+)
+
+// Store persists fetched metadata.
+type Store interface {
+	SaveLinkMetadata(ctx context.Context, domain string, hash string, metadata *model.Metadata) error
+}
+
+type job struct {
+	domain string
+	hash   string
+	url    string
+}
+
+// Fetcher asynchronously downloads destination pages and extracts their
+// title, description, preview image and favicon. It runs its own worker
+// pool, so shortening requests never wait for remote servers.
+type Fetcher struct {
+	logger       *slog.Logger
+	store        Store
+	client       *http.Client
+	queue        chan job
+	workers      int
+	timeout      time.Duration
+	maxBodySize  int64
+	allowPrivate bool
+	done         chan struct{}
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+}
+
+type Option func(*Fetcher)
+
+func New(store Store, logger *slog.Logger, opts ...Option) *Fetcher {
+	f := &Fetcher{
+		logger: logger.With(
+			slog.String("component", "metadata"),
+		),
+		store:       store,
+		queue:       make(chan job, defaultQueueSize),
+		done:        make(chan struct{}),
+		workers:     defaultWorkers,
+		timeout:     defaultTimeout,
+		maxBodySize: defaultMaxBodySize,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: f.timeout,
+		Control: f.checkAddress,
+	}
+
+	f.client = &http.Client{
+		Timeout: f.timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   f.timeout,
+			ResponseHeaderTimeout: f.timeout,
+			MaxIdleConns:          f.workers,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errTooManyRedirects
+			}
+
+			return checkScheme(req.URL)
+		},
+	}
+
+	return f
+}
+
+func WithWorkers(workers int) Option {
+	return func(f *Fetcher) {
+		f.workers = workers
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		f.timeout = timeout
+	}
+}
+
+func WithMaxBodySize(size int64) Option {
+	return func(f *Fetcher) {
+		f.maxBodySize = size
+	}
+}
+
+// WithPrivateNetworks disables SSRF protection. Only meant for tests.
+func WithPrivateNetworks() Option {
+	return func(f *Fetcher) {
+		f.allowPrivate = true
+	}
+}
+
+// Start launches the worker pool. Workers stop when ctx is cancelled or
+// Close is called; pending links are dropped.
+func (f *Fetcher) Start(ctx context.Context) {
+	for range f.workers {
+		f.wg.Add(1)
+
+		go f.worker(ctx)
+	}
+}
+
+// Enqueue schedules metadata fetching for the link. It never blocks: when
+// the queue is full the link is skipped.
+func (f *Fetcher) Enqueue(domain string, hash string, url string) {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+
+	select {
+	case f.queue <- job{domain: domain, hash: hash, url: url}:
+	default:
+		f.logger.Warn("metadata queue is full, skipping link", slog.String("hash", hash))
+	}
+}
+
+func (f *Fetcher) Close() {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+
+	f.wg.Wait()
+}
+
+func (f *Fetcher) worker(ctx context.Context) {
+	defer f.wg.Done()
+
+	for {
+		select {
+		case j := <-f.queue:
+			f.process(ctx, j)
+		case <-f.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Fetcher) process(ctx context.Context, j job) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	metadata, err := f.Fetch(timeoutCtx, j.url)
+	if err != nil {
+		f.logger.Debug("failed to fetch metadata",
+			slog.String("hash", j.hash),
+			slog.String("url", j.url),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	err = f.store.SaveLinkMetadata(timeoutCtx, j.domain, j.hash, metadata)
+	if err != nil {
+		f.logger.Error("failed to save metadata", slog.String("hash", j.hash), slog.Any("error", err))
+	}
+}
+
+// Fetch downloads the page and extracts its metadata.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*model.Metadata, error) {
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if err := checkScheme(pageURL); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "ShortenerBot/1.0 (+metadata)")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", errUnexpectedStatus, resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	return parse(io.LimitReader(resp.Body, f.maxBodySize), resp.Request.URL), nil
+}
+
+// checkAddress runs after DNS resolution for every connection, including
+// redirects, so rebinding a hostname to an internal address does not help.
+func (f *Fetcher) checkAddress(_, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("failed to split address: %w", err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivate(ip) {
+		return ErrForbiddenAddress
+	}
+
+	return nil
+}
+
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		carrierGradeNAT.Contains(ip)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedURL
+	}
+
+	return nil
+}
+
+// parse extracts metadata from the document head. Relative URLs are resolved
+// against the final page URL.
+func parse(body io.Reader, pageURL *url.URL) *model.Metadata {
+	metadata := &model.Metadata{}
+	tokenizer := html.NewTokenizer(body)
+	inTitle := false
+
+	for {
+		tokenType := tokenizer.Next()
+
+		switch tokenType {
+		case html.ErrorToken:
+			return finalize(metadata, pageURL)
+		case html.TextToken:
+			if inTitle && metadata.Title == "" {
+				metadata.Title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return finalize(metadata, pageURL)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+
+			switch token.Data {
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "meta":
+				parseMeta(metadata, token, pageURL)
+			case "link":
+				parseLink(metadata, token, pageURL)
+			case "body":
+				return finalize(metadata, pageURL)
+			}
+		}
+	}
+}
+
+func parseMeta(metadata *model.Metadata, token html.Token, pageURL *url.URL) {
+	key := strings.ToLower(attr(token, "property"))
+	if key == "" {
+		key = strings.ToLower(attr(token, "name"))
+	}
+
+	content := strings.TrimSpace(attr(token, "content"))
+
+	switch key {
+	case "og:title":
+		if metadata.Title == "" {
+			metadata.Title = content
+		}
+	case "og:description":
+		metadata.Description = content
+	case "description":
+		if metadata.Description == "" {
+			metadata.Description = content
+		}
+	case "og:image":
+		metadata.Image = resolve(pageURL, content)
+	}
+}
+
+func parseLink(metadata *model.Metadata, token html.Token, pageURL *url.URL) {
+	if metadata.Favicon != "" {
+		return
+	}
+
+	for _, rel := range strings.Fields(strings.ToLower(attr(token, "rel"))) {
+		if rel == "icon" || rel == "apple-touch-icon" {
+			metadata.Favicon = resolve(pageURL, attr(token, "href"))
+
+			return
+		}
+	}
+}
+
+func finalize(metadata *model.Metadata, pageURL *url.URL) *model.Metadata {
+	if metadata.Favicon == "" {
+		metadata.Favicon = resolve(pageURL, "/favicon.ico")
+	}
+
+	return metadata
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// resolve returns the absolute URL of the reference, or an empty string
+// unless it is an http(s) URL, as the page may point anywhere, including
+// javascript: and data: URLs.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+
+	resolved := base.ResolveReference(refURL)
+	if checkScheme(resolved) != nil || resolved.Host == "" {
+		return ""
+	}
+
+	return resolved.String()
+}
@@ -0,0 +1,181 @@
+package metadata_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxpain/shortener/internal/metadata"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+	<title> Example Domain </title>
+	<meta name="description" content="Plain description">
+	<meta property="og:description" content="OpenGraph description">
+	<meta property="og:image" content="/images/preview.png">
+	<link rel="shortcut icon" href="/static/favicon.png">
+</head>
+<body><title>Ignored</title></body>
+</html>`
+
+type storeFunc func(ctx context.Context, hash string, metadata *model.Metadata) error
+
+func (f storeFunc) SaveLinkMetadata(ctx context.Context, _ string, hash string, metadata *model.Metadata) error {
+	return f(ctx, hash, metadata)
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page) //nolint:errcheck
+	})
+	mux.HandleFunc("/unsafe", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head>`+ //nolint:errcheck
+			`<meta property="og:image" content="javascript:alert(1)">`+
+			`<link rel="icon" href="data:image/png;base64,AAAA">`+
+			`</head></html>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`) //nolint:errcheck
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><title>")     //nolint:errcheck
+		io.WriteString(w, strings.Repeat("a", 4096)) //nolint:errcheck
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fetcher := metadata.New(nil, logger, metadata.WithPrivateNetworks(), metadata.WithMaxBodySize(1024))
+
+	t.Run("page", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := fetcher.Fetch(context.Background(), server.URL+"/redirect")
+		require.NoError(t, err)
+
+		assert.Equal(t, &model.Metadata{
+			Title:       "Example Domain",
+			Description: "OpenGraph description",
+			Image:       server.URL + "/images/preview.png",
+			Favicon:     server.URL + "/static/favicon.png",
+		}, m)
+	})
+
+	t.Run("unsafe URLs", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := fetcher.Fetch(context.Background(), server.URL+"/unsafe")
+		require.NoError(t, err)
+
+		assert.Empty(t, m.Image)
+		assert.Equal(t, server.URL+"/favicon.ico", m.Favicon, "only http(s) icons are kept")
+	})
+
+	t.Run("not HTML", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fetcher.Fetch(context.Background(), server.URL+"/json")
+		require.ErrorIs(t, err, metadata.ErrNotHTML)
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := fetcher.Fetch(context.Background(), server.URL+"/huge")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(m.Title), 1024)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fetcher.Fetch(context.Background(), "file:///etc/passwd")
+		require.ErrorIs(t, err, metadata.ErrUnsupportedURL)
+	})
+}
+
+func TestFetchRejectsPrivateAddresses(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fetcher := metadata.New(nil, logger)
+
+	_, err := fetcher.Fetch(context.Background(), server.URL+"/page")
+	require.ErrorIs(t, err, metadata.ErrForbiddenAddress)
+}
+
+func TestWorkers(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var (
+		mu    sync.Mutex
+		saved = make(map[string]*model.Metadata)
+		done  = make(chan struct{}, 2)
+	)
+
+	store := storeFunc(func(_ context.Context, hash string, m *model.Metadata) error {
+		mu.Lock()
+		saved[hash] = m
+		mu.Unlock()
+
+		done <- struct{}{}
+
+		return nil
+	})
+
+	fetcher := metadata.New(store, logger, metadata.WithPrivateNetworks(), metadata.WithWorkers(2))
+	fetcher.Start(context.Background())
+	t.Cleanup(fetcher.Close)
+
+	fetcher.Enqueue("", "aaaaaa", server.URL+"/page")
+	fetcher.Enqueue("", "bbbbbb", server.URL+"/json")
+	fetcher.Enqueue("", "cccccc", server.URL+"/redirect")
+
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for metadata")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Len(t, saved, 2)
+	assert.Equal(t, "Example Domain", saved["aaaaaa"].Title)
+	assert.Equal(t, "Example Domain", saved["cccccc"].Title)
+}
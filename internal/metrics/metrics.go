@@ -0,0 +1,167 @@
+// Package metrics exposes Prometheus metrics of the app.
+package metrics
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// unmatchedRoute labels requests answered before reaching a route, which
+// keeps unknown paths from adding series.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	registry  *prometheus.Registry
+	requests  *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	redirects *prometheus.CounterVec
+	conflicts prometheus.Counter
+}
+
+// New creates the metrics in a registry of their own, so that several apps
+// can run in one process.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to handle HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short link resolutions by outcome: found, not_found, gone or error.",
+		}, []string{"outcome"}),
+		conflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "shorten_conflicts_total",
+			Help:      "Links not created because they already exist.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.redirects,
+		m.conflicts,
+	)
+
+	return m
+}
+
+// Register adds collectors, such as those reporting on the repository.
+func (m *Metrics) Register(collectors ...prometheus.Collector) {
+	m.registry.MustRegister(collectors...)
+}
+
+// Gauge reports the value returned by value on every scrape.
+func (m *Metrics) Gauge(name string, help string, value func() float64) {
+	m.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// Counter reports the value returned by value on every scrape.
+func (m *Metrics) Counter(name string, help string, value func() float64) {
+	m.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// LinkResolved counts a redirect by its outcome.
+func (m *Metrics) LinkResolved(outcome string) {
+	m.redirects.WithLabelValues(outcome).Inc()
+}
+
+// LinksConflicted counts links that were already shortened.
+func (m *Metrics) LinksConflicted(count int) {
+	m.conflicts.Add(float64(count))
+}
+
+// Middleware counts requests and measures how long they take, labelled by
+// route pattern rather than path. Streamed responses are measured until
+// streaming starts.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		// Middlewares share a route, which stays current when no other matches
+		middleware := c.Route()
+
+		err := c.Next()
+
+		route := c.Route()
+		routePath := route.Path
+
+		if route == middleware {
+			routePath = unmatchedRoute
+		}
+
+		status := c.Response().StatusCode()
+
+		// The error handler only sets the status after the middlewares ran
+		if err != nil {
+			status = fiber.StatusInternalServerError
+
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		labels := prometheus.Labels{
+			"route": routePath,
+			// The method is only valid until the request context is reused
+			"method": utils.CopyString(c.Method()),
+			"status": strconv.Itoa(status),
+		}
+
+		m.requests.With(labels).Inc()
+		m.latency.With(labels).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// Handler serves the metrics. With a token, requests must send it as a
+// bearer token.
+func (m *Metrics) Handler(token string) fiber.Handler {
+	serve := adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	if token == "" {
+		return serve
+	}
+
+	want := []byte("Bearer " + token)
+
+	return func(c *fiber.Ctx) error {
+		if subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), want) != 1 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return serve(c)
+	}
+}
@@ -0,0 +1,113 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+
+	app := fiber.New()
+	app.Use(m.Middleware())
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-Block") != "" {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+
+		return c.Next()
+	})
+	app.Get("/metrics", m.Handler("secret"))
+	app.Get("/:hash", func(c *fiber.Ctx) error {
+		if c.Params("hash") == "broken" {
+			return fiber.NewError(fiber.StatusServiceUnavailable)
+		}
+
+		m.LinkResolved("found")
+
+		return c.SendStatus(fiber.StatusTemporaryRedirect)
+	})
+	app.Post("/", func(c *fiber.Ctx) error {
+		m.LinksConflicted(2)
+
+		return c.SendStatus(fiber.StatusConflict)
+	})
+
+	send := func(req *http.Request) *http.Response {
+		t.Helper()
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	send(httptest.NewRequest("GET", "/first", nil))
+	send(httptest.NewRequest("GET", "/second", nil))
+	send(httptest.NewRequest("GET", "/broken", nil))
+	send(httptest.NewRequest("POST", "/", nil))
+	send(httptest.NewRequest("DELETE", "/unknown/path", nil))
+
+	blocked := httptest.NewRequest("GET", "/third", nil)
+	blocked.Header.Set("X-Block", "1")
+	send(blocked)
+
+	assert.Equal(t, fiber.StatusUnauthorized, send(httptest.NewRequest("GET", "/metrics", nil)).StatusCode)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp := send(req)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`shortener_http_requests_total{method="GET",route="/:hash",status="307"} 2`,
+		`shortener_http_requests_total{method="GET",route="/:hash",status="503"} 1`,
+		`shortener_http_requests_total{method="POST",route="/",status="409"} 1`,
+		`shortener_http_requests_total{method="DELETE",route="unmatched",status="404"} 1`,
+		`shortener_http_requests_total{method="GET",route="unmatched",status="403"} 1`,
+		`shortener_http_requests_total{method="GET",route="/metrics",status="401"} 1`,
+		`shortener_http_request_duration_seconds_count{method="GET",route="/:hash",status="307"} 2`,
+		`shortener_redirects_total{outcome="found"} 2`,
+		`shortener_shorten_conflicts_total 2`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+
+	assert.NotContains(t, string(body), "/first", "paths must not become labels")
+}
+
+func TestGaugeAndCounter(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+	m.Gauge("journal_size_bytes", "Size of the journal.", func() float64 { return 42 })
+	m.Counter("cache_hits_total", "Cache hits.", func() float64 { return 7 })
+
+	app := fiber.New()
+	app.Get("/metrics", m.Handler(""))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode, "metrics are public without a token")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "shortener_journal_size_bytes 42")
+	assert.Contains(t, string(body), "shortener_cache_hits_total 7")
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Scope limits what an API key may do. Cookie sessions are not scoped.
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"
+	ScopeShorten Scope = "shorten"
+	ScopeDelete  Scope = "delete"
+)
+
+// APIKey authenticates scripts on behalf of a user. Only a hash of the key
+// is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the beginning of the key, to tell keys apart in listings.
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+var (
+	ErrInvalidScope    = errors.New("scopes must be one or more of read, shorten and delete")
+	ErrInvalidAPIKey   = errors.New("invalid API key")
+	ErrAccountRequired = errors.New("a registered account is required")
+)
+
+func ValidateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return ErrInvalidScope
+	}
+
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopeShorten && scope != ScopeDelete {
+			return ErrInvalidScope
+		}
+	}
+
+	return nil
+}
+
+func (k *APIKey) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Domain is a custom short link domain registered by a user, optionally on
+// behalf of a workspace whose editors may then use it too. It only serves
+// links once its owner proved control of it, see VerificationRecord. Until
+// then, other users may register it too, and the first to verify it wins.
+type Domain struct {
+	Name              string     `json:"domain"`
+	UserID            string     `json:"user_id"`
+	WorkspaceID       string     `json:"workspace_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	VerificationToken string     `json:"verification_token"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+}
+
+// domainVerificationLabel prefixes the domain in the name of the TXT record
+// holding the verification token.
+const domainVerificationLabel = "_shortener-challenge."
+
+var (
+	ErrInvalidDomain     = errors.New("invalid domain name")
+	ErrDomainTaken       = errors.New("domain is already registered")
+	ErrDomainReserved    = errors.New("domain is reserved")
+	ErrUnknownDomain     = errors.New("domain is not registered to the user")
+	ErrDomainNotVerified = errors.New("domain ownership is not verified")
+)
+
+func (d *Domain) Verified() bool {
+	return d.VerifiedAt != nil
+}
+
+// VerificationRecord is the name of the TXT record that must hold the
+// verification token.
+func (d *Domain) VerificationRecord() string {
+	return domainVerificationLabel + d.Name
+}
+
+// NormalizeDomain lowercases the domain name and checks that it is a valid
+// fully qualified hostname without a port.
+func NormalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+
+	if len(name) == 0 || len(name) > 253 || !strings.Contains(name, ".") {
+		return "", ErrInvalidDomain
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidDomain
+		}
+
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return "", ErrInvalidDomain
+			}
+		}
+	}
+
+	return name, nil
+}
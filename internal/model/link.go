@@ -5,27 +5,111 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 )
 
 const length = 6
 
 type (
 	Link struct {
-		OriginalURL   string `json:"original_url"`
-		CorrelationID string `json:"correlation_id"`
+		OriginalURL    string       `json:"original_url"`
+		CorrelationID  string       `json:"correlation_id"`
+		NotBefore      *time.Time   `json:"not_before,omitempty"`
+		NotAfter       *time.Time   `json:"not_after,omitempty"`
+		Rules          []Rule       `json:"rules,omitempty"`
+		Variants       []Variant    `json:"variants,omitempty"`
+		RedirectStatus int          `json:"redirect_status,omitempty"`
+		Passthrough    *Passthrough `json:"passthrough,omitempty"`
+		UTM            *UTM         `json:"utm,omitempty"`
+		Campaign       string       `json:"campaign,omitempty"`
+		// Domain is the custom domain the link is served from, empty for the
+		// default one. The same hash may exist on several domains.
+		Domain string `json:"domain,omitempty"`
+		// WorkspaceID shares the link with the members of the workspace.
+		WorkspaceID string `json:"workspace_id,omitempty"`
+		// Alias replaces the generated hash of the short URL.
+		Alias string   `json:"alias,omitempty"`
+		Tags  []string `json:"tags,omitempty"`
 	}
 
 	UserLink struct {
-		OriginalURL string `json:"original_url"`
-		ShortURL    string `json:"short_url"`
+		OriginalURL    string       `json:"original_url"`
+		ShortURL       string       `json:"short_url"`
+		NotBefore      *time.Time   `json:"not_before,omitempty"`
+		NotAfter       *time.Time   `json:"not_after,omitempty"`
+		Rules          []Rule       `json:"rules,omitempty"`
+		Variants       []Variant    `json:"variants,omitempty"`
+		Metadata       *Metadata    `json:"metadata,omitempty"`
+		RedirectStatus int          `json:"redirect_status,omitempty"`
+		Passthrough    *Passthrough `json:"passthrough,omitempty"`
+		Campaign       string       `json:"campaign,omitempty"`
+		Domain         string       `json:"domain,omitempty"`
+		WorkspaceID    string       `json:"workspace_id,omitempty"`
+		Tags           []string     `json:"tags,omitempty"`
+	}
+
+	// ExportedLink is a link as exported for migrating to another
+	// shortener. The alias is the hash, so importing it keeps the short URL.
+	ExportedLink struct {
+		OriginalURL   string    `json:"original_url"`
+		ShortURL      string    `json:"short_url"`
+		Alias         string    `json:"alias"`
+		Tags          []string  `json:"tags,omitempty"`
+		CorrelationID string    `json:"correlation_id,omitempty"`
+		Domain        string    `json:"domain,omitempty"`
+		CreatedAt     time.Time `json:"created_at"`
+	}
+
+	// Metadata describes the destination page of a link.
+	Metadata struct {
+		Title       string `json:"title,omitempty"`
+		Description string `json:"description,omitempty"`
+		Image       string `json:"image,omitempty"`
+		Favicon     string `json:"favicon,omitempty"`
 	}
 
 	StoredLink struct {
 		*Link
-		UserID    string `json:"user_id"`
-		Hash      string `json:"hash"`
-		IsDeleted bool   `json:"is_deleted"`
+		UserID    string    `json:"user_id"`
+		Hash      string    `json:"hash"`
+		IsDeleted bool      `json:"is_deleted"`
+		CreatedAt time.Time `json:"created_at"`
+		Metadata  *Metadata `json:"metadata,omitempty"`
+	}
+
+	// LinkPreview is shown to visitors who want to inspect a link before following it.
+	LinkPreview struct {
+		ShortURL    string
+		OriginalURL string
+		// CreatedBy tells who created the link without identifying them.
+		CreatedBy string
+		CreatedAt time.Time
+		Clicks    *int64
+	}
+
+	// Destination is where a visitor of a short link should be sent.
+	Destination struct {
+		URL        string
+		Variant    string
+		StatusCode int
+		// Interstitial asks to warn the visitor before leaving.
+		Interstitial bool
+		// Cacheable is false when clients must come back on every visit,
+		// either to be counted or because the destination depends on them.
+		Cacheable bool
+		// NotAfter is when the link stops redirecting, if ever.
+		NotAfter *time.Time
+	}
+
+	// LinkFilter narrows down the list of user links. Empty fields match any link.
+	LinkFilter struct {
+		Campaign string
+		// WorkspaceID lists the links of the workspace instead of the user's own.
+		WorkspaceID string
 	}
 
 	ShortenedLink struct {
@@ -36,25 +120,186 @@ type (
 )
 
 var (
-	ErrNotFound = errors.New("Link not found")
-	ErrDeleted  = errors.New("Link is deleted")
+	ErrNotFound  = errors.New("Link not found")
+	ErrDeleted   = errors.New("Link is deleted")
+	ErrNotActive = errors.New("Link is not active yet")
+	ErrExpired   = errors.New("Link is expired")
+
+	ErrInvalidLink             = errors.New("invalid link")
+	ErrInvalidActivationWindow = errors.New("not_after must be later than not_before")
+	ErrInvalidRedirectStatus   = errors.New("redirect status must be one of 301, 302, 307 or 308")
+	ErrInvalidAlias            = errors.New("alias must be 1 to 64 letters, digits, '-' or '_'")
+	ErrReservedAlias           = errors.New("alias is reserved")
+	ErrInvalidTags             = errors.New("links may have up to 32 tags of 1 to 64 characters, without ',', ';' or '|'")
+)
+
+const (
+	maxAliasLength = 64
+	maxTags        = 32
+	maxTagLength   = 64
+
+	// TagSeparators separate the tags of a link in CSV files, so they
+	// cannot be part of a tag.
+	TagSeparators = ",;|"
+)
+
+var (
+	aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// hashPattern matches generated hashes. Aliases looking like one could
+	// take the hash of a link shortened later.
+	hashPattern = regexp.MustCompile(`^[0-9a-f]{6}$`)
+	// reservedAliases would be shadowed by routes.
+	reservedAliases = map[string]bool{"api": true, "metrics": true, "ping": true}
 )
 
+// Validate checks the link attributes supplied by the client.
+func (l *Link) Validate() error {
+	if l.NotBefore != nil && l.NotAfter != nil && !l.NotAfter.After(*l.NotBefore) {
+		return ErrInvalidActivationWindow
+	}
+
+	for _, rule := range l.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if l.RedirectStatus != 0 {
+		if err := ValidateRedirectStatus(l.RedirectStatus); err != nil {
+			return err
+		}
+	}
+
+	if l.Passthrough != nil {
+		if err := l.Passthrough.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(l.Tags) > maxTags {
+		return ErrInvalidTags
+	}
+
+	for _, tag := range l.Tags {
+		if tag == "" || len(tag) > maxTagLength || strings.ContainsAny(tag, TagSeparators) {
+			return ErrInvalidTags
+		}
+	}
+
+	return validateVariants(l.Variants)
+}
+
+// ValidateAlias checks the alias against the final original URL, so it
+// must run after ApplyUTM. An alias looking like a generated hash is only
+// allowed if it is the hash of the link itself, as in exported links.
+func (l *Link) ValidateAlias() error {
+	if l.Alias == "" {
+		return nil
+	}
+
+	if len(l.Alias) > maxAliasLength || !aliasPattern.MatchString(l.Alias) {
+		return ErrInvalidAlias
+	}
+
+	if reservedAliases[strings.ToLower(l.Alias)] {
+		return ErrReservedAlias
+	}
+
+	if hashPattern.MatchString(l.Alias) && l.Alias != generateHash(l.OriginalURL) {
+		return ErrReservedAlias
+	}
+
+	return nil
+}
+
+// ValidateRedirectStatus checks that the status code is a supported redirect.
+func ValidateRedirectStatus(status int) error {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	default:
+		return ErrInvalidRedirectStatus
+	}
+}
+
+// IsPermanentRedirect reports whether clients may cache the redirect forever.
+func IsPermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// ApplyUTM merges the UTM parameters into the original URL and remembers
+// the campaign. It must run before the link is hashed.
+func (l *Link) ApplyUTM() error {
+	if l.UTM == nil {
+		return nil
+	}
+
+	originalURL, err := l.UTM.Apply(l.OriginalURL)
+	if err != nil {
+		return err
+	}
+
+	l.OriginalURL = originalURL
+
+	if l.UTM.Campaign != "" {
+		l.Campaign = l.UTM.Campaign
+	}
+
+	l.UTM = nil
+
+	return nil
+}
+
 func (l *Link) GetStoredLink(userID string) *StoredLink {
+	hash := l.Alias
+	if hash == "" {
+		hash = generateHash(l.OriginalURL)
+	}
+
 	return &StoredLink{
 		Link:   l,
-		Hash:   generateHash(l.OriginalURL),
+		Hash:   hash,
 		UserID: userID,
 	}
 }
 
+// Matches reports whether the link passes the filter.
+func (f *LinkFilter) Matches(link *StoredLink) bool {
+	return (f.Campaign == "" || f.Campaign == link.Campaign) &&
+		(f.WorkspaceID == "" || f.WorkspaceID == link.WorkspaceID)
+}
+
+// CheckActive reports whether the link can be followed at the given time.
+func (l *StoredLink) CheckActive(now time.Time) error {
+	if l.NotBefore != nil && now.Before(*l.NotBefore) {
+		return ErrNotActive
+	}
+
+	if l.NotAfter != nil && !now.Before(*l.NotAfter) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
 func generateHash(url string) string {
 	hash := sha256.Sum256([]byte(url))
 
 	return hex.EncodeToString(hash[:])[:length]
 }
 
+// GetShortenedLink builds the short URL of the link. Links bound to a custom
+// domain keep the scheme of baseURL but use their own host.
 func (l *StoredLink) GetShortenedLink(baseURL string) (*ShortenedLink, error) {
+	if l.Domain != "" {
+		parsedURL, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse base URL: %w", err)
+		}
+
+		baseURL = (&url.URL{Scheme: parsedURL.Scheme, Host: l.Domain, Path: "/"}).String()
+	}
+
 	url, err := constructURL(baseURL, l.Hash)
 	if err != nil {
 		return nil, err
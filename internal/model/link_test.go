@@ -1,6 +1,7 @@
 package model_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/maxpain/shortener/internal/model"
@@ -83,3 +84,154 @@ func TestGetShortenedLink(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyUTM(t *testing.T) {
+	t.Parallel()
+
+	link := &model.Link{
+		OriginalURL: "https://example.com/sale?ref=newsletter&utm_source=old&flag&q=a%2fb",
+		UTM: &model.UTM{
+			Source:   "twitter",
+			Medium:   "social",
+			Campaign: "spring",
+		},
+	}
+
+	require.NoError(t, link.ApplyUTM())
+	assert.Equal(t,
+		"https://example.com/sale?ref=newsletter&utm_source=twitter&flag&q=a%2fb&utm_medium=social&utm_campaign=spring",
+		link.OriginalURL,
+	)
+	assert.Equal(t, "spring", link.Campaign)
+	assert.Nil(t, link.UTM)
+}
+
+func TestValidateAlias(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		alias string
+		err   error
+	}{
+		{alias: ""},
+		{alias: "spring-sale_2024"},
+		{alias: "05046f"},
+		{alias: "with space", err: model.ErrInvalidAlias},
+		{alias: "API", err: model.ErrReservedAlias},
+		{alias: "metrics", err: model.ErrReservedAlias},
+		{alias: "160009", err: model.ErrReservedAlias},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			t.Parallel()
+
+			link := &model.Link{OriginalURL: "https://google.com", Alias: tt.alias}
+
+			assert.ErrorIs(t, link.ValidateAlias(), tt.err)
+		})
+	}
+}
+
+func TestValidateVariantWeights(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		weight int
+		err    error
+	}{
+		{name: "max", weight: 10000},
+		{name: "zero", weight: 0, err: model.ErrInvalidVariant},
+		{name: "huge", weight: 1 << 31, err: model.ErrInvalidVariant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			link := &model.Link{
+				OriginalURL: "https://google.com",
+				Variants: []model.Variant{
+					{Name: "a", URL: "https://a.example.com", Weight: tt.weight},
+					{Name: "b", URL: "https://b.example.com", Weight: tt.weight},
+				},
+			}
+
+			assert.ErrorIs(t, link.Validate(), tt.err)
+		})
+	}
+}
+
+func TestPickVariantHugeWeights(t *testing.T) {
+	t.Parallel()
+
+	variants := []model.Variant{
+		{Name: "a", URL: "https://a.example.com", Weight: 1 << 31},
+		{Name: "b", URL: "https://b.example.com", Weight: 1 << 31},
+	}
+
+	assert.NotPanics(t, func() {
+		variant, ok := model.PickVariant(variants, "192.0.2.1")
+		assert.True(t, ok)
+		assert.NotNil(t, variant)
+	})
+}
+
+func TestValidateVariantNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "control_B-2"},
+		{name: "", err: model.ErrInvalidVariant},
+		{name: "x; Domain=example.com; Max-Age=99999999", err: model.ErrInvalidVariant},
+		{name: "with space", err: model.ErrInvalidVariant},
+		{name: `"quoted"`, err: model.ErrInvalidVariant},
+		{name: "a,b", err: model.ErrInvalidVariant},
+		{name: strings.Repeat("a", 65), err: model.ErrInvalidVariant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			link := &model.Link{
+				OriginalURL: "https://google.com",
+				Variants: []model.Variant{
+					{Name: tt.name, URL: "https://a.example.com", Weight: 1},
+				},
+			}
+
+			assert.ErrorIs(t, link.Validate(), tt.err)
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		tag string
+		err error
+	}{
+		{tag: "@team"},
+		{tag: "", err: model.ErrInvalidTags},
+		{tag: "a,b", err: model.ErrInvalidTags},
+		{tag: "a;b", err: model.ErrInvalidTags},
+		{tag: "a|b", err: model.ErrInvalidTags},
+		{tag: strings.Repeat("a", 65), err: model.ErrInvalidTags},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			t.Parallel()
+
+			link := &model.Link{OriginalURL: "https://google.com", Tags: []string{tt.tag}}
+
+			assert.ErrorIs(t, link.Validate(), tt.err)
+		})
+	}
+}
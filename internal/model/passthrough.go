@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Conflict policies for query parameters present both in the destination URL
+// and in the incoming request.
+const (
+	ConflictKeep     = "keep"
+	ConflictOverride = "override"
+	ConflictAppend   = "append"
+)
+
+// Passthrough controls which parts of the incoming request are forwarded to
+// the destination.
+type Passthrough struct {
+	Query    bool   `json:"query,omitempty"`
+	Path     bool   `json:"path,omitempty"`
+	Conflict string `json:"conflict,omitempty"`
+}
+
+var ErrInvalidPassthrough = errors.New("passthrough conflict must be one of keep, override or append")
+
+func (p *Passthrough) Validate() error {
+	switch p.Conflict {
+	case "", ConflictKeep, ConflictOverride, ConflictAppend:
+		return nil
+	default:
+		return ErrInvalidPassthrough
+	}
+}
+
+// Apply appends the trailing path and merges the raw query string of the
+// incoming request into the destination URL. Destination parameters win
+// conflicts unless the policy says otherwise.
+func (p *Passthrough) Apply(destination string, rawQuery string, path string) (string, error) {
+	destinationURL, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse destination URL: %w", err)
+	}
+
+	if p.Path && path != "" {
+		destinationURL = destinationURL.JoinPath(cleanSegments(path)...)
+	}
+
+	if p.Query && rawQuery != "" {
+		destinationURL.RawQuery = p.mergeQuery(destinationURL.RawQuery, rawQuery)
+	}
+
+	return destinationURL.String(), nil
+}
+
+// mergeQuery adds the incoming pairs to the destination query. Pairs that
+// are not affected by the merge are kept as they were, in their order.
+func (p *Passthrough) mergeQuery(destinationQuery string, rawQuery string) string {
+	merged := splitQuery(destinationQuery)
+	destinationKeys := make(map[string]bool, len(merged))
+
+	for _, pair := range merged {
+		destinationKeys[pair.key] = true
+	}
+
+	incoming := make([]queryPair, 0)
+	incomingKeys := make(map[string]bool)
+
+	for _, pair := range splitQuery(rawQuery) {
+		// Malformed pairs are skipped, the rest of the query is still forwarded.
+		if _, err := url.ParseQuery(pair.raw); err != nil {
+			continue
+		}
+
+		incoming = append(incoming, pair)
+		incomingKeys[pair.key] = true
+	}
+
+	if p.Conflict == ConflictOverride {
+		kept := merged[:0]
+
+		for _, pair := range merged {
+			if !incomingKeys[pair.key] {
+				kept = append(kept, pair)
+			}
+		}
+
+		merged = kept
+	}
+
+	for _, pair := range incoming {
+		if p.Conflict == "" || p.Conflict == ConflictKeep {
+			if destinationKeys[pair.key] {
+				continue
+			}
+		}
+
+		merged = append(merged, pair)
+	}
+
+	return joinQuery(merged)
+}
+
+// cleanSegments drops empty and dot segments, so the trailing path can never
+// climb above the destination path. The path is still escaped, so segments
+// are checked as decoded, and dropped if they hide a dot segment or a
+// separator, or cannot be decoded.
+func cleanSegments(path string) []string {
+	segments := make([]string, 0)
+
+	for _, segment := range strings.Split(path, "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil || decoded == "" || decoded == "." || decoded == ".." || strings.ContainsAny(decoded, `/\`) {
+			continue
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments
+}
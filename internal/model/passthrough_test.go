@@ -0,0 +1,116 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassthroughApply(t *testing.T) {
+	t.Parallel()
+
+	const destination = "https://example.com/docs?ref=short&lang=en"
+
+	tests := []struct {
+		name        string
+		passthrough model.Passthrough
+		query       string
+		path        string
+		expectedURL string
+	}{
+		{
+			name:        "disabled",
+			passthrough: model.Passthrough{},
+			query:       "utm_source=x",
+			path:        "guide",
+			expectedURL: destination,
+		},
+		{
+			name:        "keep destination values",
+			passthrough: model.Passthrough{Query: true},
+			query:       "utm_source=x&ref=other",
+			expectedURL: "https://example.com/docs?ref=short&lang=en&utm_source=x",
+		},
+		{
+			name:        "override destination values",
+			passthrough: model.Passthrough{Query: true, Conflict: model.ConflictOverride},
+			query:       "ref=other",
+			expectedURL: "https://example.com/docs?lang=en&ref=other",
+		},
+		{
+			name:        "append to destination values",
+			passthrough: model.Passthrough{Query: true, Conflict: model.ConflictAppend},
+			query:       "ref=other",
+			expectedURL: "https://example.com/docs?ref=short&lang=en&ref=other",
+		},
+		{
+			name:        "unaffected pairs are kept as sent",
+			passthrough: model.Passthrough{Query: true},
+			query:       "flag&q=a+b%2Fc&bad=%zz",
+			expectedURL: "https://example.com/docs?ref=short&lang=en&flag&q=a+b%2Fc",
+		},
+		{
+			name:        "trailing path",
+			passthrough: model.Passthrough{Path: true},
+			path:        "getting-started/install",
+			expectedURL: "https://example.com/docs/getting-started/install?ref=short&lang=en",
+		},
+		{
+			name:        "dot segments are dropped",
+			passthrough: model.Passthrough{Path: true},
+			path:        "../../admin/./panel",
+			expectedURL: "https://example.com/docs/admin/panel?ref=short&lang=en",
+		},
+		{
+			name:        "encoded dot segments are dropped",
+			passthrough: model.Passthrough{Path: true},
+			path:        "%2e%2e/.%2E/%2E/admin",
+			expectedURL: "https://example.com/docs/admin?ref=short&lang=en",
+		},
+		{
+			name:        "encoded separators are dropped",
+			passthrough: model.Passthrough{Path: true},
+			path:        "..%2F..%2Fadmin/%5c/panel",
+			expectedURL: "https://example.com/docs/panel?ref=short&lang=en",
+		},
+		{
+			name:        "escaped segments are kept",
+			passthrough: model.Passthrough{Path: true},
+			path:        "caf%C3%A9/a%20b",
+			expectedURL: "https://example.com/docs/caf%C3%A9/a%20b?ref=short&lang=en",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			url, err := tt.passthrough.Apply(destination, tt.query, tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, url)
+		})
+	}
+}
+
+func TestPassthroughValidate(t *testing.T) {
+	t.Parallel()
+
+	link := &model.Link{
+		OriginalURL: "https://example.com",
+		Passthrough: &model.Passthrough{Query: true, Conflict: "merge"},
+	}
+
+	require.ErrorIs(t, link.Validate(), model.ErrInvalidPassthrough)
+}
+
+func TestPassthroughKeepsDestinationQuery(t *testing.T) {
+	t.Parallel()
+
+	passthrough := model.Passthrough{Query: true, Conflict: model.ConflictOverride}
+
+	url, err := passthrough.Apply("https://example.com/?b=2&flag&a=%2f&ref=x", "ref=y", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/?b=2&flag&a=%2f&ref=y", url)
+}
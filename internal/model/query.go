@@ -0,0 +1,74 @@
+package model
+
+import (
+	"net/url"
+	"strings"
+)
+
+// queryPair is a pair of a raw query string. The pair is kept as it was
+// sent, so re-joining the query leaves untouched pairs byte for byte the same,
+// including their order, escaping and missing values.
+type queryPair struct {
+	key string
+	raw string
+}
+
+// splitQuery splits the raw query into its pairs. Pairs whose key is not
+// properly escaped are compared by their raw key.
+func splitQuery(rawQuery string) []queryPair {
+	pairs := make([]queryPair, 0)
+
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		rawKey, _, _ := strings.Cut(raw, "=")
+
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+
+		pairs = append(pairs, queryPair{key: key, raw: raw})
+	}
+
+	return pairs
+}
+
+func joinQuery(pairs []queryPair) string {
+	raw := make([]string, 0, len(pairs))
+
+	for _, pair := range pairs {
+		raw = append(raw, pair.raw)
+	}
+
+	return strings.Join(raw, "&")
+}
+
+// setQueryValue replaces the first pair of the key with the value and drops
+// any other, or appends the pair if the key is missing.
+func setQueryValue(pairs []queryPair, key string, value string) []queryPair {
+	pair := queryPair{key: key, raw: url.QueryEscape(key) + "=" + url.QueryEscape(value)}
+	result := make([]queryPair, 0, len(pairs)+1)
+	replaced := false
+
+	for _, existing := range pairs {
+		if existing.key != key {
+			result = append(result, existing)
+
+			continue
+		}
+
+		if !replaced {
+			result = append(result, pair)
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		result = append(result, pair)
+	}
+
+	return result
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("daily link quota exceeded")
+
+// QuotaDay returns the start of the UTC day quotas are counted in.
+func QuotaDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// QuotaReset returns when the quota counted at now is reset.
+func QuotaReset(now time.Time) time.Time {
+	return QuotaDay(now).Add(24 * time.Hour)
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+)
+
+type (
+	// Rule sends visitors matching all of its non-empty conditions to URL.
+	Rule struct {
+		Platform string `json:"platform,omitempty"`
+		Language string `json:"language,omitempty"`
+		Country  string `json:"country,omitempty"`
+		URL      string `json:"url"`
+	}
+
+	// Visitor holds the request attributes used to pick the destination.
+	Visitor struct {
+		UserAgent      string
+		AcceptLanguage string
+		IP             string
+		Country        string
+		// Variant is the A/B variant previously assigned to the visitor.
+		Variant string
+		// Query and Path are the raw query string and the trailing path
+		// segments after the hash, forwarded if the link allows it.
+		Query string
+		Path  string
+	}
+)
+
+var ErrInvalidRule = errors.New("rule must have a URL and at least one known condition")
+
+func (r *Rule) Validate() error {
+	if r.URL == "" || (r.Platform == "" && r.Language == "" && r.Country == "") {
+		return ErrInvalidRule
+	}
+
+	switch strings.ToLower(r.Platform) {
+	case "", PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux:
+		return nil
+	default:
+		return ErrInvalidRule
+	}
+}
+
+func (r *Rule) Matches(platform, language, country string) bool {
+	if r.Platform != "" && !strings.EqualFold(r.Platform, platform) {
+		return false
+	}
+
+	if r.Language != "" && !matchLanguage(r.Language, language) {
+		return false
+	}
+
+	if r.Country != "" && !strings.EqualFold(r.Country, country) {
+		return false
+	}
+
+	return true
+}
+
+// NeedsCountry reports whether any of the rules depends on the visitor country.
+func NeedsCountry(rules []Rule) bool {
+	for _, rule := range rules {
+		if rule.Country != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchRules returns the URL of the first rule matching the visitor.
+func MatchRules(rules []Rule, visitor *Visitor) (string, bool) {
+	if len(rules) == 0 || visitor == nil {
+		return "", false
+	}
+
+	platform := DetectPlatform(visitor.UserAgent)
+	language := PreferredLanguage(visitor.AcceptLanguage)
+
+	for _, rule := range rules {
+		if rule.Matches(platform, language, visitor.Country) {
+			return rule.URL, true
+		}
+	}
+
+	return "", false
+}
+
+// DetectPlatform guesses the visitor operating system from the User-Agent header.
+func DetectPlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return PlatformIOS
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	case strings.Contains(ua, "windows"):
+		return PlatformWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return PlatformMacOS
+	case strings.Contains(ua, "linux"):
+		return PlatformLinux
+	default:
+		return ""
+	}
+}
+
+// PreferredLanguage returns the lowercased language tag with the highest
+// weight from the Accept-Language header.
+func PreferredLanguage(acceptLanguage string) string {
+	type weightedTag struct {
+		tag    string
+		weight float64
+	}
+
+	tags := make([]weightedTag, 0)
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		weight := 1.0
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+
+			weight = parsed
+		}
+
+		tags = append(tags, weightedTag{tag: strings.ToLower(tag), weight: weight})
+	}
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].weight > tags[j].weight
+	})
+
+	return tags[0].tag
+}
+
+// matchLanguage matches "en" against both "en" and "en-us", while "en-gb"
+// matches only itself.
+func matchLanguage(ruleLanguage, language string) bool {
+	ruleLanguage = strings.ToLower(ruleLanguage)
+
+	return language == ruleLanguage || strings.HasPrefix(language, ruleLanguage+"-")
+}
@@ -0,0 +1,89 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRules(t *testing.T) {
+	t.Parallel()
+
+	rules := []model.Rule{
+		{Platform: "ios", URL: "https://apps.apple.com/app"},
+		{Platform: "android", URL: "https://play.google.com/store/apps"},
+		{Language: "de", Country: "AT", URL: "https://example.at"},
+		{Language: "de", URL: "https://example.de"},
+	}
+
+	tests := []struct {
+		name        string
+		visitor     *model.Visitor
+		expectedURL string
+		matched     bool
+	}{
+		{
+			name: "iPhone",
+			visitor: &model.Visitor{
+				UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15",
+			},
+			expectedURL: "https://apps.apple.com/app",
+			matched:     true,
+		},
+		{
+			name: "Android",
+			visitor: &model.Visitor{
+				UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36",
+			},
+			expectedURL: "https://play.google.com/store/apps",
+			matched:     true,
+		},
+		{
+			name: "German speaker in Austria",
+			visitor: &model.Visitor{
+				UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+				AcceptLanguage: "en;q=0.5, de-AT",
+				Country:        "AT",
+			},
+			expectedURL: "https://example.at",
+			matched:     true,
+		},
+		{
+			name: "German speaker elsewhere",
+			visitor: &model.Visitor{
+				AcceptLanguage: "de-DE,de;q=0.9,en;q=0.8",
+				Country:        "DE",
+			},
+			expectedURL: "https://example.de",
+			matched:     true,
+		},
+		{
+			name: "Fallback",
+			visitor: &model.Visitor{
+				UserAgent:      "Mozilla/5.0 (X11; Linux x86_64)",
+				AcceptLanguage: "en-US,de;q=0.5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			url, matched := model.MatchRules(rules, tt.visitor)
+
+			assert.Equal(t, tt.matched, matched)
+			assert.Equal(t, tt.expectedURL, url)
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, (&model.Rule{Platform: "ios", URL: "https://example.com"}).Validate())
+	assert.ErrorIs(t, (&model.Rule{Platform: "ios"}).Validate(), model.ErrInvalidRule)
+	assert.ErrorIs(t, (&model.Rule{URL: "https://example.com"}).Validate(), model.ErrInvalidRule)
+	assert.ErrorIs(t, (&model.Rule{Platform: "beos", URL: "https://example.com"}).Validate(), model.ErrInvalidRule)
+}
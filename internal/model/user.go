@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const MinPasswordLength = 8
+
+// User is a registered account. Anonymous visitors only have a random ID in
+// their session cookie and no User record. Accounts signed in through an
+// identity provider have no password hash and their ID is derived from the
+// issuer and the subject the provider knows them by.
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ExternalIdentity is a user authenticated by an identity provider.
+type ExternalIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+// UserID namespaces the subject by its issuer, so it can never be the ID
+// of a registered, anonymous or another provider's account.
+func (i *ExternalIdentity) UserID() string {
+	return "oidc:" + i.Issuer + ":" + i.Subject
+}
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters long")
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// NormalizeEmail lowercases the address and rejects anything that is not a
+// bare address, such as "Name <user@example.com>".
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// UTM holds campaign tracking parameters merged into the destination URL.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Apply sets the non-empty parameters on rawURL. Other query parameters are
+// preserved as they were, utm_* parameters already present are replaced in
+// place.
+func (u *UTM) Apply(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	query := splitQuery(parsedURL.RawQuery)
+
+	for _, param := range []struct {
+		key   string
+		value string
+	}{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	} {
+		if param.value != "" {
+			query = setQueryValue(query, param.key, param.value)
+		}
+	}
+
+	parsedURL.RawQuery = joinQuery(query)
+
+	return parsedURL.String(), nil
+}
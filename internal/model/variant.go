@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"regexp"
+)
+
+type (
+	// Variant is one of the weighted destinations of an A/B split link.
+	Variant struct {
+		Name   string `json:"name"`
+		URL    string `json:"url"`
+		Weight int    `json:"weight"`
+	}
+
+	LinkStats struct {
+		Clicks   int64            `json:"clicks"`
+		Variants map[string]int64 `json:"variants,omitempty"`
+	}
+)
+
+var ErrInvalidVariant = errors.New(
+	"variants must have unique names of 1 to 64 letters, digits, '-' or '_', URLs and weights from 1 to 10000",
+)
+
+// maxVariantWeight keeps the total weight far from overflowing.
+const maxVariantWeight = 10000
+
+// variantNamePattern keeps names safe to send as cookie values as they are.
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func validateVariants(variants []Variant) error {
+	names := make(map[string]struct{}, len(variants))
+	total := 0
+
+	for _, variant := range variants {
+		if !variantNamePattern.MatchString(variant.Name) || variant.URL == "" ||
+			variant.Weight <= 0 || variant.Weight > maxVariantWeight {
+			return ErrInvalidVariant
+		}
+
+		total += variant.Weight
+		if total > math.MaxInt32 {
+			return ErrInvalidVariant
+		}
+
+		if _, ok := names[variant.Name]; ok {
+			return ErrInvalidVariant
+		}
+
+		names[variant.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// Add accounts clicks attributed to the variant, or to no variant if it is empty.
+func (s *LinkStats) Add(variant string, clicks int64) {
+	s.Clicks += clicks
+
+	if variant == "" {
+		return
+	}
+
+	if s.Variants == nil {
+		s.Variants = make(map[string]int64)
+	}
+
+	s.Variants[variant] += clicks
+}
+
+// FindVariant returns the variant with the given name, if any.
+func FindVariant(variants []Variant, name string) (*Variant, bool) {
+	for i := range variants {
+		if variants[i].Name == name {
+			return &variants[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// PickVariant deterministically assigns a visitor identified by key to one of
+// the variants according to their weights, so repeat visits get the same one.
+func PickVariant(variants []Variant, key string) (*Variant, bool) {
+	var total uint64
+
+	for _, variant := range variants {
+		if variant.Weight > 0 {
+			total += uint64(variant.Weight)
+		}
+	}
+
+	if total == 0 {
+		return nil, false
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+
+	point := uint64(hasher.Sum32()) % total
+
+	for i := range variants {
+		if variants[i].Weight <= 0 {
+			continue
+		}
+
+		weight := uint64(variants[i].Weight)
+		if point < weight {
+			return &variants[i], true
+		}
+
+		point -= weight
+	}
+
+	return nil, false
+}
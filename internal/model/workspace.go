@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// Role of a workspace member. Every role includes the permissions of the
+// roles below it: owner > editor > viewer.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+type (
+	// Workspace shares link ownership between its members.
+	Workspace struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		// Role of the current user, set when listing their workspaces.
+		Role Role `json:"role,omitempty"`
+	}
+
+	Member struct {
+		WorkspaceID string    `json:"workspace_id"`
+		UserID      string    `json:"user_id"`
+		Role        Role      `json:"role"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+
+	// Invitation lets whoever holds the token join the workspace once.
+	Invitation struct {
+		Token       string     `json:"token"`
+		WorkspaceID string     `json:"workspace_id"`
+		Role        Role       `json:"role"`
+		InvitedBy   string     `json:"invited_by"`
+		CreatedAt   time.Time  `json:"created_at"`
+		ExpiresAt   time.Time  `json:"expires_at"`
+		AcceptedBy  string     `json:"accepted_by,omitempty"`
+		AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	}
+)
+
+var (
+	ErrForbidden          = errors.New("not allowed in this workspace")
+	ErrInvalidRole        = errors.New("role must be one of owner, editor or viewer")
+	ErrInvalidWorkspace   = errors.New("workspace name is required")
+	ErrInvitationInactive = errors.New("invitation is expired or already accepted")
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+func (r Role) Validate() error {
+	if _, ok := roleRanks[r]; !ok {
+		return ErrInvalidRole
+	}
+
+	return nil
+}
+
+// Allows reports whether the role grants the permissions of required.
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+
+	return ok && rank >= roleRanks[required]
+}
+
+// IsActive reports whether the invitation can still be accepted.
+func (i *Invitation) IsActive(now time.Time) bool {
+	return i.AcceptedBy == "" && now.Before(i.ExpiresAt)
+}
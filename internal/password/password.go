@@ -0,0 +1,82 @@
+// Package password hashes account passwords with argon2id.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters follow the second recommended option of RFC 9106 scaled down
+// to 64 MiB of memory.
+const (
+	memory      = 64 * 1024
+	iterations  = 3
+	parallelism = 2
+	saltLength  = 16
+	keyLength   = 32
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+var encoding = base64.RawStdEncoding
+
+// Hash returns the password hash in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, memory, iterations, parallelism,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the password matches the hash. Parameters are read
+// from the hash, so older hashes keep working when the defaults change.
+func Verify(hash string, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+
+	var (
+		m, t uint32
+		p    uint8
+	)
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return false, ErrInvalidHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, ErrInvalidHash
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, t, m, p, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, actual) == 1, nil
+}
@@ -0,0 +1,33 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxpain/shortener/internal/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	t.Parallel()
+
+	hash, err := password.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$"))
+
+	other, err := password.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+
+	ok, err := password.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = password.Verify(hash, "wrong password")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = password.Verify("$2a$10$bcrypt", "password")
+	require.ErrorIs(t, err, password.ErrInvalidHash)
+}
@@ -0,0 +1,159 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	DefaultSize   = 256
+	DefaultMargin = 4
+	DefaultLevel  = "M"
+
+	minSize   = 32
+	maxSize   = 2048
+	maxMargin = 32
+)
+
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+type Options struct {
+	Format string
+	Size   int
+	Level  string
+	Margin int
+}
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+func (o *Options) Validate() error {
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("%w: format must be %s or %s", ErrInvalidOptions, FormatPNG, FormatSVG)
+	}
+
+	if o.Size < minSize || o.Size > maxSize {
+		return fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, minSize, maxSize)
+	}
+
+	if _, ok := levels[strings.ToUpper(o.Level)]; !ok {
+		return fmt.Errorf("%w: level must be one of L, M, Q, H", ErrInvalidOptions)
+	}
+
+	if o.Margin < 0 || o.Margin > maxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, maxMargin)
+	}
+
+	return nil
+}
+
+// ContentType returns the MIME type of the rendered image.
+func (o *Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+
+	return "image/png"
+}
+
+// Render encodes content as a QR code image. Margin is measured in modules.
+// The size must leave at least one pixel per module, which depends on the
+// content, so it is only checked here.
+func Render(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, levels[strings.ToUpper(opts.Level)])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	code.DisableBorder = true
+	bitmap := addMargin(code.Bitmap(), opts.Margin)
+
+	// Smaller images would drop modules and be unscannable
+	if opts.Size < len(bitmap) {
+		return nil, fmt.Errorf("%w: size must be at least %d for this link and margin", ErrInvalidOptions, len(bitmap))
+	}
+
+	if opts.Format == FormatSVG {
+		return renderSVG(bitmap, opts.Size), nil
+	}
+
+	return renderPNG(bitmap, opts.Size)
+}
+
+func addMargin(bitmap [][]bool, margin int) [][]bool {
+	size := len(bitmap) + 2*margin
+	result := make([][]bool, size)
+
+	for y := range result {
+		result[y] = make([]bool, size)
+	}
+
+	for y, row := range bitmap {
+		copy(result[y+margin][margin:], row)
+	}
+
+	return result
+}
+
+func renderPNG(bitmap [][]bool, size int) ([]byte, error) {
+	modules := len(bitmap)
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+
+	for y := range size {
+		for x := range size {
+			if bitmap[y*modules/size][x*modules/size] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, size int) []byte {
+	modules := len(bitmap)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules,
+	)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
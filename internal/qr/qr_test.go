@@ -0,0 +1,97 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/maxpain/shortener/internal/qr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	t.Run("png", func(t *testing.T) {
+		t.Parallel()
+
+		data, err := qr.Render("http://localhost:8080/05046f", qr.Options{
+			Format: qr.FormatPNG,
+			Size:   300,
+			Level:  "H",
+			Margin: 2,
+		})
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 300, img.Bounds().Dx())
+		assert.Equal(t, 300, img.Bounds().Dy())
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		t.Parallel()
+
+		data, err := qr.Render("http://localhost:8080/05046f", qr.Options{
+			Format: qr.FormatSVG,
+			Size:   128,
+			Level:  "L",
+			Margin: 0,
+		})
+		require.NoError(t, err)
+
+		svg := string(data)
+		assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="128" height="128"`))
+		assert.True(t, strings.HasSuffix(svg, "</svg>"))
+	})
+}
+
+func TestRenderTooSmallForModules(t *testing.T) {
+	t.Parallel()
+
+	// The link takes 33 modules at level H, 41 with the margin
+	_, err := qr.Render("http://localhost:8080/05046f", qr.Options{
+		Format: qr.FormatPNG,
+		Size:   32,
+		Level:  "H",
+		Margin: 4,
+	})
+	require.ErrorIs(t, err, qr.ErrInvalidOptions)
+
+	data, err := qr.Render("http://localhost:8080/05046f", qr.Options{
+		Format: qr.FormatPNG,
+		Size:   32,
+		Level:  "L",
+		Margin: 0,
+	})
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 32, img.Bounds().Dx())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts qr.Options
+	}{
+		{name: "unknown format", opts: qr.Options{Format: "gif", Size: 256, Level: "M", Margin: 4}},
+		{name: "too small", opts: qr.Options{Format: "png", Size: 8, Level: "M", Margin: 4}},
+		{name: "too large", opts: qr.Options{Format: "png", Size: 100000, Level: "M", Margin: 4}},
+		{name: "unknown level", opts: qr.Options{Format: "png", Size: 256, Level: "X", Margin: 4}},
+		{name: "negative margin", opts: qr.Options{Format: "png", Size: 256, Level: "M", Margin: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.ErrorIs(t, tt.opts.Validate(), qr.ErrInvalidOptions)
+		})
+	}
+}
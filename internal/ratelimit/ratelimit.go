@@ -0,0 +1,142 @@
+// Package ratelimit limits how often a client may call a group of routes.
+// Clients are identified by their account when logged in or using an API
+// key, and by IP address otherwise.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/auth"
+)
+
+var errInvalidPolicy = errors.New(`rate limit must look like "100/1m"`)
+
+// Counter counts requests. Counters kept in a shared store make the limits
+// apply across instances.
+type Counter interface {
+	IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error)
+}
+
+// Policy allows Limit requests per Window.
+type Policy struct {
+	Name   string
+	Limit  int64
+	Window time.Duration
+}
+
+// ParsePolicy parses a limit like "100/1m". An empty spec disables the
+// policy and returns nil.
+func ParsePolicy(name string, spec string) (*Policy, error) {
+	if spec == "" {
+		return nil, nil //nolint:nilnil // a nil policy is a disabled one
+	}
+
+	limitSpec, windowSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("%w, got %q", errInvalidPolicy, spec)
+	}
+
+	limit, err := strconv.ParseInt(limitSpec, 10, 64)
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("%w, got %q", errInvalidPolicy, spec)
+	}
+
+	window, err := time.ParseDuration(windowSpec)
+	if err != nil || window < time.Second {
+		return nil, fmt.Errorf("%w, got %q", errInvalidPolicy, spec)
+	}
+
+	return &Policy{Name: name, Limit: limit, Window: window}, nil
+}
+
+type Limiter struct {
+	logger  *slog.Logger
+	counter Counter
+	clock   func() time.Time
+}
+
+type Option func(*Limiter)
+
+func New(counter Counter, logger *slog.Logger, opts ...Option) *Limiter {
+	l := &Limiter{
+		logger: logger.With(
+			slog.String("component", "ratelimit"),
+		),
+		counter: counter,
+		clock:   time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+func WithClock(clock func() time.Time) Option {
+	return func(l *Limiter) {
+		l.clock = clock
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Middleware enforces the policy with fixed windows and reports the quota
+// in RateLimit-* headers. A nil policy lets every request through.
+func (l *Limiter) Middleware(policy *Policy) fiber.Handler {
+	if policy == nil {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int64(policy.Window.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		now := l.clock()
+		windowStart := now.Truncate(policy.Window)
+		resetAt := windowStart.Add(policy.Window)
+		key := "ratelimit:" + policy.Name + ":" + client(c) + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+
+		count, err := l.counter.IncrementCounter(c.Context(), key, 1, resetAt)
+		if err != nil {
+			// Failing open keeps the service up when the counter store is not
+			l.logger.Error("Failed to count request", slog.Any("error", err))
+
+			return c.Next()
+		}
+
+		// Seconds until the window resets, rounded up
+		reset := strconv.FormatInt(int64((resetAt.Sub(now)+time.Second-1)/time.Second), 10)
+
+		c.Set("RateLimit-Policy", policyHeader)
+		c.Set("RateLimit-Limit", strconv.FormatInt(policy.Limit, 10))
+		c.Set("RateLimit-Remaining", strconv.FormatInt(max(policy.Limit-count, 0), 10))
+		c.Set("RateLimit-Reset", reset)
+
+		if count > policy.Limit {
+			c.Set(fiber.HeaderRetryAfter, reset)
+
+			return c.Status(fiber.StatusTooManyRequests).JSON(errorResponse{Error: "Rate limit exceeded"})
+		}
+
+		return c.Next()
+	}
+}
+
+func client(c *fiber.Ctx) string {
+	if userID, ok := auth.AccountID(c); ok {
+		return "user:" + userID
+	}
+
+	return "ip:" + c.IP()
+}
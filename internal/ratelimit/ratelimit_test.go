@@ -0,0 +1,81 @@
+package ratelimit_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxpain/shortener/internal/ratelimit"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := ratelimit.ParsePolicy("shorten", "100/1m")
+	require.NoError(t, err)
+	assert.Equal(t, &ratelimit.Policy{Name: "shorten", Limit: 100, Window: time.Minute}, policy)
+
+	policy, err = ratelimit.ParsePolicy("shorten", "")
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	for _, spec := range []string{"100", "0/1m", "x/1m", "100/1ms", "100/x"} {
+		_, err := ratelimit.ParsePolicy("shorten", spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Counters expire in real time, so the clock must not be in the past
+	now := time.Now().Truncate(time.Minute).Add(50 * time.Second)
+	limiter := ratelimit.New(memoryRepository.New(nil, logger), logger,
+		ratelimit.WithClock(func() time.Time { return now }),
+	)
+
+	app := fiber.New()
+	app.Use(limiter.Middleware(&ratelimit.Policy{Name: "test", Limit: 2, Window: time.Minute}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	do := func() *http.Response {
+		t.Helper()
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	resp := do()
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "2;w=60", resp.Header.Get("RateLimit-Policy"))
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", resp.Header.Get("RateLimit-Reset"))
+
+	resp = do()
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+
+	resp = do()
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get(fiber.HeaderRetryAfter))
+
+	now = now.Add(10 * time.Second)
+
+	resp = do()
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode, "the next window starts afresh")
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+}
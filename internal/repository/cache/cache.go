@@ -0,0 +1,483 @@
+// Package cache keeps recently resolved links and domains in memory in front
+// of another repository, so popular links are redirected without a database
+// round trip.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/usecase"
+)
+
+const (
+	defaultSize        = 10000
+	defaultTTL         = time.Minute
+	defaultNegativeTTL = 10 * time.Second
+)
+
+// Stats counts cache lookups since the cache was created.
+type Stats struct {
+	Hits uint64
+	// NegativeHits are hits on links known not to exist, also counted in Hits.
+	NegativeHits uint64
+	Misses       uint64
+	Evictions    uint64
+	Entries      int
+}
+
+type key struct {
+	domain string
+	hash   string
+}
+
+// domainHash keys domains among links, as no link has it for a hash.
+const domainHash = "/"
+
+// entry holds a link or a domain, neither of them when it does not exist.
+type entry struct {
+	key       key
+	link      *model.StoredLink
+	domain    *model.Domain
+	expiresAt time.Time
+}
+
+// load is a lookup in flight. Requests missing the same link wait for it
+// instead of all hitting the database.
+type load struct {
+	done chan struct{}
+	link *model.StoredLink
+	err  error
+	// stale is set when the link changes during the lookup, so its result
+	// is returned but not cached.
+	stale bool
+}
+
+// Repository caches GetLink and GetDomain of the wrapped repository with a
+// TTL, evicting the least recently used entries beyond its size. Unknown
+// links and domains are cached too, for a shorter time. Changes made
+// through the repository invalidate the cached links, changes made by other
+// instances show after the TTL unless they are passed to Invalidate.
+type Repository struct {
+	usecase.Repository
+
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	clock       func() time.Time
+
+	mu      sync.Mutex
+	entries map[key]*list.Element
+	lru     *list.List
+	loads   map[key]*load
+	// domainsVersion changes whenever domains do, so that domains loaded
+	// meanwhile are not cached.
+	domainsVersion uint64
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+	evictions    atomic.Uint64
+}
+
+type Option func(*Repository)
+
+func New(repo usecase.Repository, opts ...Option) *Repository {
+	r := &Repository{
+		Repository:  repo,
+		size:        defaultSize,
+		ttl:         defaultTTL,
+		negativeTTL: defaultNegativeTTL,
+		clock:       time.Now,
+		entries:     make(map[key]*list.Element),
+		lru:         list.New(),
+		loads:       make(map[key]*load),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithSize sets how many links are kept, found or not.
+func WithSize(size int) Option {
+	return func(r *Repository) {
+		r.size = size
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Repository) {
+		r.ttl = ttl
+	}
+}
+
+// WithNegativeTTL sets how long links are known not to exist. It bounds how
+// long links created by other instances stay unreachable from this one.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(r *Repository) {
+		r.negativeTTL = ttl
+	}
+}
+
+func WithClock(clock func() time.Time) Option {
+	return func(r *Repository) {
+		r.clock = clock
+	}
+}
+
+// GetLink returns the cached link, loading it on a miss. Cached links are
+// shared between callers and must not be modified.
+func (r *Repository) GetLink(ctx context.Context, domain string, hash string) (*model.StoredLink, error) {
+	k := key{domain: domain, hash: hash}
+
+	r.mu.Lock()
+
+	if e, ok := r.get(k); ok {
+		link := e.link
+		r.mu.Unlock()
+		r.hits.Add(1)
+
+		if link == nil {
+			r.negativeHits.Add(1)
+
+			return nil, model.ErrNotFound
+		}
+
+		return link, nil
+	}
+
+	r.misses.Add(1)
+
+	l, ok := r.loads[k]
+	if !ok {
+		l = &load{done: make(chan struct{})}
+		r.loads[k] = l
+
+		// The lookup is shared, so it must not fail because the caller that
+		// started it gave up
+		go r.load(context.WithoutCancel(ctx), k, l)
+	}
+
+	r.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.link, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err() //nolint:wrapcheck // the cache is transparent
+	}
+}
+
+// load looks up the link for everyone waiting for it.
+func (r *Repository) load(ctx context.Context, k key, l *load) {
+	l.link, l.err = r.Repository.GetLink(ctx, k.domain, k.hash)
+
+	r.mu.Lock()
+	delete(r.loads, k)
+
+	if !l.stale {
+		switch {
+		case l.err == nil:
+			r.put(k, &entry{link: l.link}, r.ttl)
+		case errors.Is(l.err, model.ErrNotFound):
+			r.put(k, &entry{}, r.negativeTTL)
+		}
+	}
+
+	r.mu.Unlock()
+	close(l.done)
+}
+
+// GetDomain returns the cached domain, loading it on a miss. Every redirect
+// looks up the domain of its host, registered or not.
+func (r *Repository) GetDomain(ctx context.Context, name string) (*model.Domain, error) {
+	k := key{domain: name, hash: domainHash}
+
+	r.mu.Lock()
+
+	if e, ok := r.get(k); ok {
+		domain := e.domain
+		r.mu.Unlock()
+
+		if domain == nil {
+			return nil, model.ErrNotFound
+		}
+
+		return domain, nil
+	}
+
+	version := r.domainsVersion
+	r.mu.Unlock()
+
+	domain, err := r.Repository.GetDomain(ctx, name)
+
+	r.mu.Lock()
+
+	if version == r.domainsVersion {
+		switch {
+		case err == nil:
+			r.put(k, &entry{domain: domain}, r.ttl)
+		case errors.Is(err, model.ErrNotFound):
+			r.put(k, &entry{}, r.negativeTTL)
+		}
+	}
+
+	r.mu.Unlock()
+
+	return domain, err //nolint:wrapcheck // the cache is transparent
+}
+
+func (r *Repository) SaveDomain(ctx context.Context, domain *model.Domain) (bool, error) {
+	saved, err := r.Repository.SaveDomain(ctx, domain)
+
+	r.invalidateDomain(domain.Name)
+
+	return saved, err //nolint:wrapcheck // the cache is transparent
+}
+
+func (r *Repository) VerifyDomain(ctx context.Context, name string, userID string, verifiedAt time.Time) (bool, error) {
+	verified, err := r.Repository.VerifyDomain(ctx, name, userID, verifiedAt)
+
+	r.invalidateDomain(name)
+
+	return verified, err //nolint:wrapcheck // the cache is transparent
+}
+
+func (r *Repository) SaveLinks(ctx context.Context, links []*model.StoredLink) ([]bool, error) {
+	saved, err := r.Repository.SaveLinks(ctx, links)
+
+	// New links may have been cached as unknown
+	r.mu.Lock()
+
+	for _, link := range links {
+		r.invalidate(key{domain: link.Domain, hash: link.Hash})
+	}
+
+	r.mu.Unlock()
+
+	return saved, err //nolint:wrapcheck // the cache is transparent
+}
+
+func (r *Repository) SaveLinkMetadata(ctx context.Context, domain string, hash string, metadata *model.Metadata) error {
+	err := r.Repository.SaveLinkMetadata(ctx, domain, hash, metadata)
+
+	r.mu.Lock()
+	r.invalidate(key{domain: domain, hash: hash})
+	r.mu.Unlock()
+
+	return err //nolint:wrapcheck // the cache is transparent
+}
+
+// MarkForDeletion marks the cached links deleted right away, as the wrapped
+// repository may delete them in the background.
+func (r *Repository) MarkForDeletion(domain string, hashes []string, userID string) error {
+	if err := r.Repository.MarkForDeletion(domain, hashes, userID); err != nil {
+		return err //nolint:wrapcheck // the cache is transparent
+	}
+
+	r.markDeleted(domain, hashes, func(link *model.StoredLink) bool {
+		return link.UserID == userID
+	})
+
+	return nil
+}
+
+func (r *Repository) MarkWorkspaceLinksForDeletion(domain string, hashes []string, workspaceID string) error {
+	if err := r.Repository.MarkWorkspaceLinksForDeletion(domain, hashes, workspaceID); err != nil {
+		return err //nolint:wrapcheck // the cache is transparent
+	}
+
+	r.markDeleted(domain, hashes, func(link *model.StoredLink) bool {
+		return link.WorkspaceID == workspaceID
+	})
+
+	return nil
+}
+
+func (r *Repository) ClaimLinks(ctx context.Context, fromUserID string, toUserID string) (int64, error) {
+	claimed, err := r.Repository.ClaimLinks(ctx, fromUserID, toUserID)
+
+	r.InvalidateFunc(func(link *model.StoredLink) bool {
+		return link.UserID == fromUserID
+	})
+
+	return claimed, err //nolint:wrapcheck // the cache is transparent
+}
+
+// ClaimWorkspacesAndDomains drops the cached domains of the previous owner.
+func (r *Repository) ClaimWorkspacesAndDomains(ctx context.Context, fromUserID string, toUserID string) error {
+	err := r.Repository.ClaimWorkspacesAndDomains(ctx, fromUserID, toUserID)
+
+	r.mu.Lock()
+
+	for _, element := range r.entries {
+		if domain := element.Value.(*entry).domain; domain != nil && domain.UserID == fromUserID { //nolint:forcetypeassert
+			r.drop(element)
+		}
+	}
+
+	r.domainsVersion++
+	r.mu.Unlock()
+
+	return err //nolint:wrapcheck // the cache is transparent
+}
+
+// Invalidate drops the link, so that it is loaded again on the next lookup.
+func (r *Repository) Invalidate(domain string, hash string) {
+	r.mu.Lock()
+	r.invalidate(key{domain: domain, hash: hash})
+	r.mu.Unlock()
+}
+
+// InvalidateFunc drops the cached links for which match returns true, and
+// any link being loaded.
+func (r *Repository) InvalidateFunc(match func(link *model.StoredLink) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, element := range r.entries {
+		if link := element.Value.(*entry).link; link != nil && match(link) { //nolint:forcetypeassert
+			r.drop(element)
+		}
+	}
+
+	for _, l := range r.loads {
+		l.stale = true
+	}
+}
+
+// Clear drops every cached link and domain, found or not, and any link
+// being loaded.
+func (r *Repository) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.entries)
+	r.lru.Init()
+	r.domainsVersion++
+
+	for _, l := range r.loads {
+		l.stale = true
+	}
+}
+
+// Stats returns the link lookup counters and the number of cached links
+// and domains.
+func (r *Repository) Stats() Stats {
+	r.mu.Lock()
+	entries := len(r.entries)
+	r.mu.Unlock()
+
+	return Stats{
+		Hits:         r.hits.Load(),
+		NegativeHits: r.negativeHits.Load(),
+		Misses:       r.misses.Load(),
+		Evictions:    r.evictions.Load(),
+		Entries:      entries,
+	}
+}
+
+func (r *Repository) markDeleted(domain string, hashes []string, owns func(link *model.StoredLink) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, hash := range hashes {
+		k := key{domain: domain, hash: hash}
+
+		if element, ok := r.entries[k]; ok {
+			e := element.Value.(*entry) //nolint:forcetypeassert
+
+			if e.link != nil && !e.link.IsDeleted && owns(e.link) {
+				deleted := *e.link
+				deleted.IsDeleted = true
+				e.link = &deleted
+			}
+		}
+
+		if l, ok := r.loads[k]; ok {
+			l.stale = true
+		}
+	}
+}
+
+func (r *Repository) invalidateDomain(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[key{domain: name, hash: domainHash}]; ok {
+		r.drop(element)
+	}
+
+	r.domainsVersion++
+}
+
+// get returns the entry if it is cached and fresh. It must be called with
+// the lock held.
+func (r *Repository) get(k key) (*entry, bool) {
+	element, ok := r.entries[k]
+	if !ok {
+		return nil, false
+	}
+
+	e := element.Value.(*entry) //nolint:forcetypeassert
+
+	if !r.clock().Before(e.expiresAt) {
+		r.drop(element)
+
+		return nil, false
+	}
+
+	r.lru.MoveToFront(element)
+
+	return e, true
+}
+
+// put caches the entry, evicting the least recently used one when full. It
+// must be called with the lock held.
+func (r *Repository) put(k key, e *entry, ttl time.Duration) {
+	if r.size <= 0 || ttl <= 0 {
+		return
+	}
+
+	e.key = k
+	e.expiresAt = r.clock().Add(ttl)
+
+	if element, ok := r.entries[k]; ok {
+		element.Value = e
+		r.lru.MoveToFront(element)
+
+		return
+	}
+
+	r.entries[k] = r.lru.PushFront(e)
+
+	for len(r.entries) > r.size {
+		r.drop(r.lru.Back())
+		r.evictions.Add(1)
+	}
+}
+
+// invalidate must be called with the lock held.
+func (r *Repository) invalidate(k key) {
+	if element, ok := r.entries[k]; ok {
+		r.drop(element)
+	}
+
+	if l, ok := r.loads[k]; ok {
+		l.stale = true
+	}
+}
+
+// drop must be called with the lock held.
+func (r *Repository) drop(element *list.Element) {
+	r.lru.Remove(element)
+	delete(r.entries, element.Value.(*entry).key) //nolint:forcetypeassert
+}
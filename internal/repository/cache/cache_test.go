@@ -0,0 +1,274 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/cache"
+	"github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/maxpain/shortener/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepository counts the lookups reaching the database, and can hold
+// them until released.
+type countingRepository struct {
+	usecase.Repository
+	lookups atomic.Int64
+	release chan struct{}
+}
+
+func (r *countingRepository) GetLink(ctx context.Context, domain string, hash string) (*model.StoredLink, error) {
+	r.lookups.Add(1)
+
+	if r.release != nil {
+		<-r.release
+	}
+
+	// Like the database, lookups fail once cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return r.Repository.GetLink(ctx, domain, hash) //nolint:wrapcheck
+}
+
+func newRepository(opts ...cache.Option) (*cache.Repository, *countingRepository) {
+	repo := &countingRepository{Repository: memory.New(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))}
+
+	return cache.New(repo, opts...), repo
+}
+
+func saveLink(t *testing.T, repo usecase.Repository, url string, userID string) *model.StoredLink {
+	t.Helper()
+
+	link := (&model.Link{OriginalURL: url}).GetStoredLink(userID)
+
+	saved, err := repo.SaveLinks(context.Background(), []*model.StoredLink{link})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, saved)
+
+	return link
+}
+
+func TestGetLink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	repo, db := newRepository(
+		cache.WithTTL(time.Minute),
+		cache.WithNegativeTTL(10*time.Second),
+		cache.WithClock(func() time.Time { return now }),
+	)
+
+	// Unknown links are cached until they are created
+	for range 2 {
+		_, err := repo.GetLink(ctx, "", "f2f978")
+		require.ErrorIs(t, err, model.ErrNotFound)
+	}
+
+	assert.Equal(t, int64(1), db.lookups.Load())
+
+	link := saveLink(t, repo, "https://example.com/1", "user")
+
+	for range 2 {
+		got, err := repo.GetLink(ctx, "", link.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, link.OriginalURL, got.OriginalURL)
+	}
+
+	assert.Equal(t, int64(2), db.lookups.Load())
+
+	require.NoError(t, repo.SaveLinkMetadata(ctx, "", link.Hash, &model.Metadata{Title: "Example"}))
+
+	got, err := repo.GetLink(ctx, "", link.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "Example", got.Metadata.Title)
+	assert.Equal(t, int64(3), db.lookups.Load())
+
+	now = now.Add(time.Minute)
+
+	_, err = repo.GetLink(ctx, "", link.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), db.lookups.Load(), "expired links are loaded again")
+
+	assert.Equal(t, cache.Stats{Hits: 2, NegativeHits: 1, Misses: 4, Entries: 1}, repo.Stats())
+}
+
+func TestDeletion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, _ := newRepository()
+	link := saveLink(t, repo, "https://example.com/1", "owner")
+
+	_, err := repo.GetLink(ctx, "", link.Hash)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.MarkForDeletion("", []string{link.Hash}, "someone else"))
+	require.NoError(t, repo.MarkForDeletion("go.brand.example", []string{link.Hash}, "owner"))
+
+	got, err := repo.GetLink(ctx, "", link.Hash)
+	require.NoError(t, err)
+	assert.False(t, got.IsDeleted, "only the owner may delete the link, on its own domain")
+
+	require.NoError(t, repo.MarkForDeletion("", []string{link.Hash}, "owner"))
+
+	got, err = repo.GetLink(ctx, "", link.Hash)
+	require.NoError(t, err)
+	assert.True(t, got.IsDeleted)
+}
+
+func TestEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, db := newRepository(cache.WithSize(2))
+	first := saveLink(t, repo, "https://example.com/1", "user")
+	second := saveLink(t, repo, "https://example.com/2", "user")
+	third := saveLink(t, repo, "https://example.com/3", "user")
+
+	for _, link := range []*model.StoredLink{first, second, first, third} {
+		_, err := repo.GetLink(ctx, "", link.Hash)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(3), db.lookups.Load())
+
+	// The second link was the least recently used
+	_, err := repo.GetLink(ctx, "", first.Hash)
+	require.NoError(t, err)
+	_, err = repo.GetLink(ctx, "", second.Hash)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), db.lookups.Load())
+	assert.Equal(t, uint64(2), repo.Stats().Evictions)
+}
+
+func TestConcurrentMisses(t *testing.T) {
+	t.Parallel()
+
+	repo, db := newRepository()
+	link := saveLink(t, repo, "https://example.com/1", "user")
+	db.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			got, err := repo.GetLink(context.Background(), "", link.Hash)
+			assert.NoError(t, err)
+			assert.Equal(t, link.OriginalURL, got.OriginalURL)
+		}()
+	}
+
+	// Let the waiting requests pile up behind the first lookup
+	require.Eventually(t, func() bool { return repo.Stats().Misses == 10 }, time.Second, time.Millisecond)
+	close(db.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), db.lookups.Load())
+}
+
+func TestCancelledLookup(t *testing.T) {
+	t.Parallel()
+
+	repo, db := newRepository()
+	link := saveLink(t, repo, "https://example.com/1", "user")
+	db.release = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error, 1)
+
+	go func() {
+		_, err := repo.GetLink(ctx, "", link.Hash)
+		started <- err
+	}()
+
+	require.Eventually(t, func() bool { return db.lookups.Load() == 1 }, time.Second, time.Millisecond)
+
+	waited := make(chan *model.StoredLink, 1)
+
+	go func() {
+		got, err := repo.GetLink(context.Background(), "", link.Hash)
+		assert.NoError(t, err)
+		waited <- got
+	}()
+
+	require.Eventually(t, func() bool { return repo.Stats().Misses == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-started, context.Canceled, "the caller that started the lookup may still give up")
+
+	close(db.release)
+
+	got := <-waited
+	require.NotNil(t, got, "the lookup must not fail for the callers still waiting")
+	assert.Equal(t, link.OriginalURL, got.OriginalURL)
+	assert.Equal(t, int64(1), db.lookups.Load())
+}
+
+func TestInvalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, db := newRepository()
+	first := saveLink(t, repo, "https://example.com/1", "user")
+	second := saveLink(t, repo, "https://example.com/2", "user")
+
+	for _, link := range []*model.StoredLink{first, second} {
+		_, err := repo.GetLink(ctx, "", link.Hash)
+		require.NoError(t, err)
+	}
+
+	// As told by another instance
+	repo.Invalidate("", first.Hash)
+
+	for _, link := range []*model.StoredLink{first, second} {
+		_, err := repo.GetLink(ctx, "", link.Hash)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(3), db.lookups.Load())
+
+	repo.Clear()
+
+	assert.Equal(t, 0, repo.Stats().Entries)
+}
+
+func TestGetDomain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, _ := newRepository()
+
+	_, err := repo.GetDomain(ctx, "go.brand.example")
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	saved, err := repo.SaveDomain(ctx, &model.Domain{Name: "go.brand.example", UserID: "user", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.True(t, saved)
+
+	_, err = repo.GetDomain(ctx, "go.brand.example")
+	require.ErrorIs(t, err, model.ErrNotFound, "unverified domains are not served")
+
+	verified, err := repo.VerifyDomain(ctx, "go.brand.example", "user", time.Now())
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	domain, err := repo.GetDomain(ctx, "go.brand.example")
+	require.NoError(t, err, "verifying a domain drops it from the unknown ones")
+	assert.True(t, domain.Verified())
+}
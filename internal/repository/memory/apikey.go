@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+// storedAPIKey is the journal form of an API key, including the hash and
+// owner that model.APIKey hides from JSON.
+type storedAPIKey struct {
+	ID         string        `json:"id"`
+	UserID     string        `json:"user_id"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	Hash       string        `json:"hash"`
+	Scopes     []model.Scope `json:"scopes"`
+	CreatedAt  time.Time     `json:"created_at"`
+	LastUsedAt *time.Time    `json:"last_used_at"`
+	Deleted    bool          `json:"deleted,omitempty"`
+}
+
+func (r *Repository) SaveAPIKey(_ context.Context, key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveAPIKeyToMemory(key)
+
+	if err := r.saveRecordToFile(recordAPIKey, newStoredAPIKey(key)); err != nil {
+		return fmt.Errorf("failed to save API key to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetAPIKeyByHash(_ context.Context, hash string) (*model.APIKey, error) {
+	r.apiKeysMu.RLock()
+	defer r.apiKeysMu.RUnlock()
+
+	key, ok := r.apiKeysByHash[hash]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return key, nil
+}
+
+func (r *Repository) GetUserAPIKeys(_ context.Context, userID string) ([]*model.APIKey, error) {
+	r.apiKeysMu.RLock()
+	defer r.apiKeysMu.RUnlock()
+
+	keys := make([]*model.APIKey, 0)
+
+	for _, key := range r.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b *model.APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (r *Repository) DeleteAPIKey(_ context.Context, id string, userID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.apiKeysMu.Lock()
+	key, ok := r.apiKeys[id]
+
+	if !ok || key.UserID != userID {
+		r.apiKeysMu.Unlock()
+
+		return false, nil
+	}
+
+	delete(r.apiKeys, id)
+	delete(r.apiKeysByHash, key.Hash)
+	r.apiKeysMu.Unlock()
+
+	stored := newStoredAPIKey(key)
+	stored.Deleted = true
+
+	if err := r.saveRecordToFile(recordAPIKey, stored); err != nil {
+		return false, fmt.Errorf("failed to save API key to file: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) UpdateAPIKeyLastUsed(_ context.Context, id string, lastUsedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.apiKeysMu.RLock()
+	key, ok := r.apiKeys[id]
+	r.apiKeysMu.RUnlock()
+
+	if !ok {
+		return model.ErrNotFound
+	}
+
+	updated := *key
+	updated.LastUsedAt = &lastUsedAt
+
+	r.saveAPIKeyToMemory(&updated)
+
+	if err := r.saveRecordToFile(recordAPIKey, newStoredAPIKey(&updated)); err != nil {
+		return fmt.Errorf("failed to save API key to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) replayAPIKeyRecord(rec record) error {
+	var stored storedAPIKey
+
+	if err := json.Unmarshal(rec.Data, &stored); err != nil {
+		return fmt.Errorf("failed to decode API key: %w", err)
+	}
+
+	if stored.Deleted {
+		r.apiKeysMu.Lock()
+		delete(r.apiKeys, stored.ID)
+		delete(r.apiKeysByHash, stored.Hash)
+		r.apiKeysMu.Unlock()
+
+		return nil
+	}
+
+	key := model.APIKey{
+		ID:         stored.ID,
+		UserID:     stored.UserID,
+		Name:       stored.Name,
+		Prefix:     stored.Prefix,
+		Hash:       stored.Hash,
+		Scopes:     stored.Scopes,
+		CreatedAt:  stored.CreatedAt,
+		LastUsedAt: stored.LastUsedAt,
+	}
+
+	r.saveAPIKeyToMemory(&key)
+
+	return nil
+}
+
+func (r *Repository) saveAPIKeyToMemory(key *model.APIKey) {
+	r.apiKeysMu.Lock()
+	defer r.apiKeysMu.Unlock()
+
+	r.apiKeys[key.ID] = key
+	r.apiKeysByHash[key.Hash] = key
+}
+
+func newStoredAPIKey(key *model.APIKey) storedAPIKey {
+	return storedAPIKey{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Hash:       key.Hash,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+// counterPurgeInterval bounds how often expired counters are looked for.
+const counterPurgeInterval = time.Minute
+
+type counter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// IncrementCounter keeps counters in memory only. They are short-lived, so
+// they are not worth journaling.
+func (r *Repository) IncrementCounter(_ context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	r.countersMu.Lock()
+	defer r.countersMu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(r.countersPurgedAt) > counterPurgeInterval {
+		for key, c := range r.counters {
+			if c.expiresAt.Before(now) {
+				delete(r.counters, key)
+			}
+		}
+
+		r.countersPurgedAt = now
+	}
+
+	c, ok := r.counters[key]
+	if !ok || c.expiresAt.Before(now) {
+		c = &counter{}
+		r.counters[key] = c
+	}
+
+	c.value += delta
+	c.expiresAt = expiresAt
+
+	return c.value, nil
+}
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,18 +9,70 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/maxpain/shortener/internal/model"
 )
 
-var errCastLink = errors.New("failed to cast link")
+var (
+	errCastLink      = errors.New("failed to cast link")
+	errUnknownRecord = errors.New("unknown journal record type")
+)
+
+// Journal lines without a type are links, which keeps old journals readable.
+const (
+	recordDomain     = "domain"
+	recordWorkspace  = "workspace"
+	recordMember     = "member"
+	recordInvitation = "invitation"
+	recordUser       = "user"
+	recordAPIKey     = "api_key"
+	recordRevocation = "revoked_token"
+	recordClaim      = "claim"
+)
+
+type record struct {
+	Type string          `json:"type,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
 
 type Repository struct {
 	logger    *slog.Logger
 	links     sync.Map
 	userLinks sync.Map
 	file      *os.File
+
+	domainsMu   sync.RWMutex
+	domains     map[string][]*model.Domain
+	userDomains map[string][]*model.Domain
+
+	workspacesMu sync.RWMutex
+	workspaces   map[string]*model.Workspace
+	members      map[string]map[string]*model.Member
+	invitations  map[string]*model.Invitation
+
+	usersMu      sync.RWMutex
+	users        map[string]*model.User
+	usersByEmail map[string]*model.User
+
+	apiKeysMu     sync.RWMutex
+	apiKeys       map[string]*model.APIKey
+	apiKeysByHash map[string]*model.APIKey
+
+	revokedMu sync.RWMutex
+	revoked   map[string]time.Time
+
+	countersMu       sync.Mutex
+	counters         map[string]*counter
+	countersPurgedAt time.Time
+
+	// mu serializes writes, reads go through the sync.Maps lock-free.
+	mu sync.Mutex
+
+	clicksMu sync.Mutex
+	clicks   map[string]map[string]int64
 }
 
 // Create a new memory repository with optional persistence to the file.
@@ -28,7 +81,19 @@ func New(file *os.File, logger *slog.Logger) *Repository {
 		logger: logger.With(
 			slog.String("repository", "memory"),
 		),
-		file: file,
+		file:          file,
+		clicks:        make(map[string]map[string]int64),
+		domains:       make(map[string][]*model.Domain),
+		userDomains:   make(map[string][]*model.Domain),
+		workspaces:    make(map[string]*model.Workspace),
+		members:       make(map[string]map[string]*model.Member),
+		invitations:   make(map[string]*model.Invitation),
+		users:         make(map[string]*model.User),
+		usersByEmail:  make(map[string]*model.User),
+		apiKeys:       make(map[string]*model.APIKey),
+		apiKeysByHash: make(map[string]*model.APIKey),
+		revoked:       make(map[string]time.Time),
+		counters:      make(map[string]*counter),
 	}
 }
 
@@ -40,27 +105,74 @@ func (r *Repository) Init(_ context.Context) error {
 	decoder := json.NewDecoder(r.file)
 
 	for {
-		var link model.StoredLink
+		var line json.RawMessage
 
-		if err := decoder.Decode(&link); err != nil {
+		if err := decoder.Decode(&line); err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
 
+			return fmt.Errorf("failed to decode journal record: %w", err)
+		}
+
+		if err := r.replay(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) replay(line json.RawMessage) error {
+	var rec record
+
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return fmt.Errorf("failed to decode journal record: %w", err)
+	}
+
+	switch rec.Type {
+	case "":
+		var link model.StoredLink
+
+		if err := json.Unmarshal(line, &link); err != nil {
 			return fmt.Errorf("failed to decode link: %w", err)
 		}
 
-		err := r.saveLinkToMemory(&link)
-		if err != nil {
+		if err := r.saveLinkToMemory(&link); err != nil {
 			return fmt.Errorf("failed to save link to memory: %w", err)
 		}
+	case recordDomain:
+		var domain model.Domain
+
+		if err := json.Unmarshal(rec.Data, &domain); err != nil {
+			return fmt.Errorf("failed to decode domain: %w", err)
+		}
+
+		r.saveDomainToMemory(&domain)
+	case recordWorkspace, recordMember, recordInvitation:
+		return r.replayWorkspaceRecord(rec)
+	case recordUser:
+		return r.replayUserRecord(rec)
+	case recordAPIKey:
+		return r.replayAPIKeyRecord(rec)
+	case recordRevocation:
+		return r.replayRevocationRecord(rec)
+	case recordClaim:
+		return r.replayClaimRecord(rec)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownRecord, rec.Type)
 	}
 
 	return nil
 }
 
-func (r *Repository) GetLink(_ context.Context, hash string) (*model.StoredLink, error) {
-	if l, ok := r.links.Load(hash); ok {
+// linkKey identifies a link, since the same hash may exist on several domains.
+func linkKey(domain string, hash string) string {
+	return domain + "/" + hash
+}
+
+func (r *Repository) GetLink(_ context.Context, domain string, hash string) (*model.StoredLink, error) {
+	if l, ok := r.links.Load(linkKey(domain, hash)); ok {
 		link, ok := l.(*model.StoredLink)
 
 		if !ok {
@@ -91,13 +203,43 @@ func (r *Repository) GetUserLinks(_ context.Context, userID string) ([]*model.St
 	return []*model.StoredLink{}, nil
 }
 
+func (r *Repository) GetUserLinksAfter(
+	ctx context.Context,
+	userID string,
+	afterDomain string,
+	afterHash string,
+	limit int,
+) ([]*model.StoredLink, error) {
+	links, err := r.GetUserLinks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := make([]*model.StoredLink, 0, limit)
+
+	for _, link := range links {
+		if link.Domain > afterDomain || (link.Domain == afterDomain && link.Hash > afterHash) {
+			page = append(page, link)
+		}
+	}
+
+	slices.SortFunc(page, func(a, b *model.StoredLink) int {
+		return cmp.Or(cmp.Compare(a.Domain, b.Domain), cmp.Compare(a.Hash, b.Hash))
+	})
+
+	return page[:min(limit, len(page))], nil
+}
+
 func (r *Repository) SaveLinks(ctx context.Context, linksToStore []*model.StoredLink) ([]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	results := make([]bool, 0, len(linksToStore))
 
 	for _, link := range linksToStore {
 		isExists := true
 
-		if _, err := r.GetLink(ctx, link.Hash); err != nil {
+		if _, err := r.GetLink(ctx, link.Domain, link.Hash); err != nil {
 			if errors.Is(err, model.ErrNotFound) {
 				isExists = false
 			} else {
@@ -121,10 +263,232 @@ func (r *Repository) SaveLinks(ctx context.Context, linksToStore []*model.Stored
 	return results, nil
 }
 
-func (r *Repository) MarkForDeletion(_ []string, _ string) error {
+func (r *Repository) MarkForDeletion(domain string, hashes []string, userID string) error {
+	return r.markDeleted(domain, hashes, func(link *model.StoredLink) bool {
+		return link.UserID == userID
+	})
+}
+
+// markDeleted flags the links of the domain with the given hashes, if they
+// match the ownership check.
+func (r *Repository) markDeleted(domain string, hashes []string, owned func(link *model.StoredLink) bool) error {
+	ctx := context.Background()
+
+	for _, hash := range hashes {
+		link, err := r.GetLink(ctx, domain, hash)
+		if err != nil || link.IsDeleted || !owned(link) {
+			continue
+		}
+
+		err = r.updateLink(ctx, domain, hash, func(link *model.StoredLink) {
+			link.IsDeleted = true
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark link as deleted: %w", err)
+		}
+	}
+
 	return nil
 }
 
+func (r *Repository) SaveLinkMetadata(
+	ctx context.Context,
+	domain string,
+	hash string,
+	metadata *model.Metadata,
+) error {
+	return r.updateLink(ctx, domain, hash, func(link *model.StoredLink) {
+		link.Metadata = metadata
+	})
+}
+
+// updateLink replaces the stored link with an updated copy, so concurrent
+// readers never observe a partially modified link, and journals the result.
+func (r *Repository) updateLink(
+	ctx context.Context,
+	domain string,
+	hash string,
+	update func(link *model.StoredLink),
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, err := r.GetLink(ctx, domain, hash)
+	if err != nil {
+		return err
+	}
+
+	updatedLink := *link
+	updatedOriginal := *link.Link
+	updatedLink.Link = &updatedOriginal
+
+	update(&updatedLink)
+
+	if err := r.saveLinkToMemory(&updatedLink); err != nil {
+		return fmt.Errorf("failed to save link to memory: %w", err)
+	}
+
+	if err := r.saveLinkToFile(&updatedLink); err != nil {
+		return fmt.Errorf("failed to save link to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) RecordClick(_ context.Context, domain string, hash string, variant string) error {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+
+	key := linkKey(domain, hash)
+
+	if r.clicks[key] == nil {
+		r.clicks[key] = make(map[string]int64)
+	}
+
+	r.clicks[key][variant]++
+
+	return nil
+}
+
+func (r *Repository) GetLinkStats(_ context.Context, domain string, hash string) (*model.LinkStats, error) {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+
+	stats := &model.LinkStats{}
+
+	for variant, clicks := range r.clicks[linkKey(domain, hash)] {
+		stats.Add(variant, clicks)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) SaveDomain(ctx context.Context, domain *model.Domain) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claims, err := r.GetDomainClaims(ctx, domain.Name)
+	if err != nil {
+		return false, err
+	}
+
+	for _, claim := range claims {
+		if claim.Verified() || claim.UserID == domain.UserID {
+			return false, nil
+		}
+	}
+
+	r.saveDomainToMemory(domain)
+
+	if err := r.saveRecordToFile(recordDomain, domain); err != nil {
+		return false, fmt.Errorf("failed to save domain to file: %w", err)
+	}
+
+	return true, nil
+}
+
+// saveDomainToMemory replaces the registration of the user if it was saved
+// before, as the journal holds every change to it. Once verified, it drops
+// the registrations of everyone else.
+func (r *Repository) saveDomainToMemory(domain *model.Domain) {
+	r.domainsMu.Lock()
+	defer r.domainsMu.Unlock()
+
+	claims := r.domains[domain.Name]
+
+	if domain.Verified() {
+		for _, claim := range claims {
+			if claim.UserID != domain.UserID {
+				r.dropUserDomain(claim)
+			}
+		}
+
+		claims = nil
+	}
+
+	r.dropUserDomain(domain)
+
+	claims = slices.DeleteFunc(claims, func(d *model.Domain) bool {
+		return d.UserID == domain.UserID
+	})
+
+	r.domains[domain.Name] = append(claims, domain)
+	r.userDomains[domain.UserID] = append(r.userDomains[domain.UserID], domain)
+}
+
+// dropUserDomain removes the registration from the domains of its user. It
+// must be called with domainsMu held.
+func (r *Repository) dropUserDomain(domain *model.Domain) {
+	r.userDomains[domain.UserID] = slices.DeleteFunc(r.userDomains[domain.UserID], func(d *model.Domain) bool {
+		return d.Name == domain.Name
+	})
+}
+
+func (r *Repository) VerifyDomain(ctx context.Context, name string, userID string, verifiedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claims, err := r.GetDomainClaims(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	var existing *model.Domain
+
+	for _, claim := range claims {
+		if claim.Verified() {
+			return false, nil
+		}
+
+		if claim.UserID == userID {
+			existing = claim
+		}
+	}
+
+	if existing == nil {
+		return false, nil
+	}
+
+	// Domains are shared with readers, so they are replaced rather than changed
+	domain := *existing
+	domain.VerifiedAt = &verifiedAt
+
+	r.saveDomainToMemory(&domain)
+
+	if err := r.saveRecordToFile(recordDomain, &domain); err != nil {
+		return false, fmt.Errorf("failed to save domain to file: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) GetDomain(_ context.Context, name string) (*model.Domain, error) {
+	r.domainsMu.RLock()
+	defer r.domainsMu.RUnlock()
+
+	for _, domain := range r.domains[name] {
+		if domain.Verified() {
+			return domain, nil
+		}
+	}
+
+	return nil, model.ErrNotFound
+}
+
+func (r *Repository) GetDomainClaims(_ context.Context, name string) ([]*model.Domain, error) {
+	r.domainsMu.RLock()
+	defer r.domainsMu.RUnlock()
+
+	return append([]*model.Domain{}, r.domains[name]...), nil
+}
+
+func (r *Repository) GetUserDomains(_ context.Context, userID string) ([]*model.Domain, error) {
+	r.domainsMu.RLock()
+	defer r.domainsMu.RUnlock()
+
+	return append([]*model.Domain{}, r.userDomains[userID]...), nil
+}
+
 func (r *Repository) saveLinkToMemory(link *model.StoredLink) error {
 	r.logger.Debug("saving link to memory",
 		slog.Group("link",
@@ -135,7 +499,15 @@ func (r *Repository) saveLinkToMemory(link *model.StoredLink) error {
 		),
 	)
 
-	r.links.Store(link.Hash, link)
+	key := linkKey(link.Domain, link.Hash)
+
+	if previous, ok := r.links.Load(key); ok {
+		if err := r.removeFromPreviousOwner(previous, link); err != nil {
+			return err
+		}
+	}
+
+	r.links.Store(key, link)
 	userLinks := []*model.StoredLink{link}
 
 	if l, ok := r.userLinks.Load(link.UserID); ok {
@@ -145,7 +517,22 @@ func (r *Repository) saveLinkToMemory(link *model.StoredLink) error {
 			return errCastLink
 		}
 
-		userLinks = append(links, userLinks...)
+		userLinks = make([]*model.StoredLink, 0, len(links)+1)
+		replaced := false
+
+		// Journal replay and updates store the same hash again
+		for _, existing := range links {
+			if existing.Hash == link.Hash && existing.Domain == link.Domain {
+				existing = link
+				replaced = true
+			}
+
+			userLinks = append(userLinks, existing)
+		}
+
+		if !replaced {
+			userLinks = append(userLinks, link)
+		}
 	}
 
 	r.userLinks.Store(link.UserID, userLinks)
@@ -153,6 +540,45 @@ func (r *Repository) saveLinkToMemory(link *model.StoredLink) error {
 	return nil
 }
 
+// removeFromPreviousOwner drops the link from the list of the user it
+// belonged to before being claimed by another user.
+func (r *Repository) removeFromPreviousOwner(previous any, link *model.StoredLink) error {
+	previousLink, ok := previous.(*model.StoredLink)
+	if !ok {
+		return errCastLink
+	}
+
+	if previousLink.UserID == link.UserID {
+		return nil
+	}
+
+	l, ok := r.userLinks.Load(previousLink.UserID)
+	if !ok {
+		return nil
+	}
+
+	links, ok := l.([]*model.StoredLink)
+	if !ok {
+		return errCastLink
+	}
+
+	remaining := make([]*model.StoredLink, 0, len(links))
+
+	for _, existing := range links {
+		if existing.Hash != link.Hash || existing.Domain != link.Domain {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == 0 {
+		r.userLinks.Delete(previousLink.UserID)
+	} else {
+		r.userLinks.Store(previousLink.UserID, remaining)
+	}
+
+	return nil
+}
+
 func (r *Repository) saveLinkToFile(link *model.StoredLink) error {
 	if r.file != nil {
 		err := json.NewEncoder(r.file).Encode(link)
@@ -164,10 +590,44 @@ func (r *Repository) saveLinkToFile(link *model.StoredLink) error {
 	return nil
 }
 
+// saveRecordToFile journals an entity other than a link.
+func (r *Repository) saveRecordToFile(recordType string, value any) error {
+	if r.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", recordType, err)
+	}
+
+	err = json.NewEncoder(r.file).Encode(record{Type: recordType, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	return nil
+}
+
 func (r *Repository) Ping(_ context.Context) error {
 	return nil
 }
 
+// JournalSize returns the size of the journal file in bytes, 0 without
+// persistence.
+func (r *Repository) JournalSize() (int64, error) {
+	if r.file == nil {
+		return 0, nil
+	}
+
+	info, err := r.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return info.Size(), nil
+}
+
 func (r *Repository) Close() error {
 	if r.file != nil {
 		err := r.file.Close()
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type revocation struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (r *Repository) RevokeToken(_ context.Context, id string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveRevocationToMemory(revocation{ID: id, ExpiresAt: expiresAt})
+
+	if err := r.saveRecordToFile(recordRevocation, revocation{ID: id, ExpiresAt: expiresAt}); err != nil {
+		return fmt.Errorf("failed to save revocation to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) IsTokenRevoked(_ context.Context, id string) (bool, error) {
+	r.revokedMu.RLock()
+	defer r.revokedMu.RUnlock()
+
+	_, ok := r.revoked[id]
+
+	return ok, nil
+}
+
+func (r *Repository) replayRevocationRecord(rec record) error {
+	var revoked revocation
+
+	if err := json.Unmarshal(rec.Data, &revoked); err != nil {
+		return fmt.Errorf("failed to decode revocation: %w", err)
+	}
+
+	r.saveRevocationToMemory(revoked)
+
+	return nil
+}
+
+// saveRevocationToMemory also forgets tokens that have expired since, as
+// they are rejected anyway.
+func (r *Repository) saveRevocationToMemory(revoked revocation) {
+	r.revokedMu.Lock()
+	defer r.revokedMu.Unlock()
+
+	now := time.Now()
+
+	for id, expiresAt := range r.revoked {
+		if expiresAt.Before(now) {
+			delete(r.revoked, id)
+		}
+	}
+
+	if revoked.ExpiresAt.After(now) {
+		r.revoked[revoked.ID] = revoked.ExpiresAt
+	}
+}
@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+// storedUser is the journal form of a user. model.User hides the password
+// hash from JSON, so it is spelled out here.
+type storedUser struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (r *Repository) SaveUser(_ context.Context, user *model.User) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.usersMu.RLock()
+	_, exists := r.usersByEmail[user.Email]
+	r.usersMu.RUnlock()
+
+	if exists {
+		return false, nil
+	}
+
+	r.saveUserToMemory(user)
+
+	if err := r.saveRecordToFile(recordUser, storedUser(*user)); err != nil {
+		return false, fmt.Errorf("failed to save user to file: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) SaveExternalUser(_ context.Context, user *model.User) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.usersMu.RLock()
+	existing, exists := r.users[user.ID]
+	r.usersMu.RUnlock()
+
+	if exists {
+		if existing.Email == user.Email {
+			return existing, nil
+		}
+
+		updated := *existing
+		updated.Email = user.Email
+		user = &updated
+	}
+
+	r.saveUserToMemory(user)
+
+	if err := r.saveRecordToFile(recordUser, storedUser(*user)); err != nil {
+		return nil, fmt.Errorf("failed to save user to file: %w", err)
+	}
+
+	return user, nil
+}
+
+func (r *Repository) GetUser(_ context.Context, id string) (*model.User, error) {
+	r.usersMu.RLock()
+	defer r.usersMu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Repository) GetUserByEmail(_ context.Context, email string) (*model.User, error) {
+	r.usersMu.RLock()
+	defer r.usersMu.RUnlock()
+
+	user, ok := r.usersByEmail[email]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Repository) ClaimLinks(_ context.Context, fromUserID string, toUserID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.userLinks.Load(fromUserID)
+	if !ok {
+		return 0, nil
+	}
+
+	links, ok := l.([]*model.StoredLink)
+	if !ok {
+		return 0, errCastLink
+	}
+
+	for _, link := range links {
+		claimed := *link
+		claimed.UserID = toUserID
+
+		if err := r.saveLinkToMemory(&claimed); err != nil {
+			return 0, fmt.Errorf("failed to save link to memory: %w", err)
+		}
+
+		if err := r.saveLinkToFile(&claimed); err != nil {
+			return 0, fmt.Errorf("failed to save link to file: %w", err)
+		}
+	}
+
+	return int64(len(links)), nil
+}
+
+// claimRecord is the journal form of a transfer of workspace memberships
+// and domains, which is replayed rather than journaling each of them.
+type claimRecord struct {
+	FromUserID string `json:"from_user_id"`
+	ToUserID   string `json:"to_user_id"`
+}
+
+func (r *Repository) ClaimWorkspacesAndDomains(_ context.Context, fromUserID string, toUserID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claim := claimRecord{FromUserID: fromUserID, ToUserID: toUserID}
+
+	r.claimToMemory(claim)
+
+	if err := r.saveRecordToFile(recordClaim, claim); err != nil {
+		return fmt.Errorf("failed to save claim to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) replayClaimRecord(rec record) error {
+	var claim claimRecord
+
+	if err := json.Unmarshal(rec.Data, &claim); err != nil {
+		return fmt.Errorf("failed to decode claim: %w", err)
+	}
+
+	r.claimToMemory(claim)
+
+	return nil
+}
+
+// claimToMemory replaces the moved members and domains, as they are shared
+// with readers.
+func (r *Repository) claimToMemory(claim claimRecord) {
+	r.workspacesMu.Lock()
+
+	for _, members := range r.members {
+		member, ok := members[claim.FromUserID]
+		if !ok {
+			continue
+		}
+
+		delete(members, claim.FromUserID)
+
+		if _, ok := members[claim.ToUserID]; !ok {
+			claimed := *member
+			claimed.UserID = claim.ToUserID
+			members[claim.ToUserID] = &claimed
+		}
+	}
+
+	r.workspacesMu.Unlock()
+
+	r.domainsMu.Lock()
+	defer r.domainsMu.Unlock()
+
+	unclaimed := make([]*model.Domain, 0)
+
+	for _, domain := range r.userDomains[claim.FromUserID] {
+		claims := r.domains[domain.Name]
+
+		// The other user registered the domain too
+		if slices.ContainsFunc(claims, func(d *model.Domain) bool { return d.UserID == claim.ToUserID }) {
+			unclaimed = append(unclaimed, domain)
+
+			continue
+		}
+
+		claimed := *domain
+		claimed.UserID = claim.ToUserID
+
+		claims[slices.Index(claims, domain)] = &claimed
+		r.userDomains[claim.ToUserID] = append(r.userDomains[claim.ToUserID], &claimed)
+	}
+
+	r.userDomains[claim.FromUserID] = unclaimed
+}
+
+func (r *Repository) replayUserRecord(rec record) error {
+	var user storedUser
+
+	if err := json.Unmarshal(rec.Data, &user); err != nil {
+		return fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	r.saveUserToMemory((*model.User)(&user))
+
+	return nil
+}
+
+func (r *Repository) saveUserToMemory(user *model.User) {
+	r.usersMu.Lock()
+	defer r.usersMu.Unlock()
+
+	r.users[user.ID] = user
+
+	// Only password accounts log in by email, identity provider accounts
+	// may share one
+	if user.PasswordHash != "" {
+		r.usersByEmail[user.Email] = user
+	}
+}
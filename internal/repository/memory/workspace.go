@@ -0,0 +1,237 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+func (r *Repository) CreateWorkspace(_ context.Context, workspace *model.Workspace, owner *model.Member) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *workspace
+	stored.Role = ""
+
+	r.saveWorkspaceToMemory(&stored)
+	r.saveMemberToMemory(owner)
+
+	if err := r.saveRecordToFile(recordWorkspace, &stored); err != nil {
+		return fmt.Errorf("failed to save workspace to file: %w", err)
+	}
+
+	if err := r.saveRecordToFile(recordMember, owner); err != nil {
+		return fmt.Errorf("failed to save member to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetWorkspace(_ context.Context, id string) (*model.Workspace, error) {
+	r.workspacesMu.RLock()
+	defer r.workspacesMu.RUnlock()
+
+	workspace, ok := r.workspaces[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return workspace, nil
+}
+
+func (r *Repository) GetUserWorkspaces(_ context.Context, userID string) ([]*model.Workspace, error) {
+	r.workspacesMu.RLock()
+	defer r.workspacesMu.RUnlock()
+
+	workspaces := make([]*model.Workspace, 0)
+
+	for workspaceID, members := range r.members {
+		member, ok := members[userID]
+		if !ok {
+			continue
+		}
+
+		workspace := *r.workspaces[workspaceID]
+		workspace.Role = member.Role
+		workspaces = append(workspaces, &workspace)
+	}
+
+	slices.SortFunc(workspaces, func(a, b *model.Workspace) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return workspaces, nil
+}
+
+func (r *Repository) GetMember(_ context.Context, workspaceID string, userID string) (*model.Member, error) {
+	r.workspacesMu.RLock()
+	defer r.workspacesMu.RUnlock()
+
+	member, ok := r.members[workspaceID][userID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return member, nil
+}
+
+func (r *Repository) GetMembers(_ context.Context, workspaceID string) ([]*model.Member, error) {
+	r.workspacesMu.RLock()
+	defer r.workspacesMu.RUnlock()
+
+	members := make([]*model.Member, 0, len(r.members[workspaceID]))
+
+	for _, member := range r.members[workspaceID] {
+		members = append(members, member)
+	}
+
+	slices.SortFunc(members, func(a, b *model.Member) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return members, nil
+}
+
+func (r *Repository) SaveInvitation(_ context.Context, invitation *model.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveInvitationToMemory(invitation)
+
+	if err := r.saveRecordToFile(recordInvitation, invitation); err != nil {
+		return fmt.Errorf("failed to save invitation to file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetInvitation(_ context.Context, token string) (*model.Invitation, error) {
+	r.workspacesMu.RLock()
+	defer r.workspacesMu.RUnlock()
+
+	invitation, ok := r.invitations[token]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return invitation, nil
+}
+
+func (r *Repository) AcceptInvitation(_ context.Context, token string, member *model.Member) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.workspacesMu.RLock()
+	invitation, ok := r.invitations[token]
+	r.workspacesMu.RUnlock()
+
+	if !ok || !invitation.IsActive(member.CreatedAt) {
+		return false, nil
+	}
+
+	accepted := *invitation
+	accepted.AcceptedBy = member.UserID
+	accepted.AcceptedAt = &member.CreatedAt
+
+	r.saveInvitationToMemory(&accepted)
+	r.saveMemberToMemory(member)
+
+	if err := r.saveRecordToFile(recordInvitation, &accepted); err != nil {
+		return false, fmt.Errorf("failed to save invitation to file: %w", err)
+	}
+
+	if err := r.saveRecordToFile(recordMember, member); err != nil {
+		return false, fmt.Errorf("failed to save member to file: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) GetWorkspaceLinks(_ context.Context, workspaceID string) ([]*model.StoredLink, error) {
+	links := make([]*model.StoredLink, 0)
+
+	r.links.Range(func(_, value any) bool {
+		link, ok := value.(*model.StoredLink)
+		if ok && link.WorkspaceID == workspaceID {
+			links = append(links, link)
+		}
+
+		return true
+	})
+
+	slices.SortFunc(links, func(a, b *model.StoredLink) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Hash, b.Hash)
+	})
+
+	return links, nil
+}
+
+func (r *Repository) MarkWorkspaceLinksForDeletion(domain string, hashes []string, workspaceID string) error {
+	return r.markDeleted(domain, hashes, func(link *model.StoredLink) bool {
+		return link.WorkspaceID == workspaceID
+	})
+}
+
+func (r *Repository) replayWorkspaceRecord(rec record) error {
+	switch rec.Type {
+	case recordWorkspace:
+		var workspace model.Workspace
+
+		if err := json.Unmarshal(rec.Data, &workspace); err != nil {
+			return fmt.Errorf("failed to decode workspace: %w", err)
+		}
+
+		r.saveWorkspaceToMemory(&workspace)
+	case recordMember:
+		var member model.Member
+
+		if err := json.Unmarshal(rec.Data, &member); err != nil {
+			return fmt.Errorf("failed to decode member: %w", err)
+		}
+
+		r.saveMemberToMemory(&member)
+	case recordInvitation:
+		var invitation model.Invitation
+
+		if err := json.Unmarshal(rec.Data, &invitation); err != nil {
+			return fmt.Errorf("failed to decode invitation: %w", err)
+		}
+
+		r.saveInvitationToMemory(&invitation)
+	}
+
+	return nil
+}
+
+func (r *Repository) saveWorkspaceToMemory(workspace *model.Workspace) {
+	r.workspacesMu.Lock()
+	defer r.workspacesMu.Unlock()
+
+	r.workspaces[workspace.ID] = workspace
+}
+
+func (r *Repository) saveMemberToMemory(member *model.Member) {
+	r.workspacesMu.Lock()
+	defer r.workspacesMu.Unlock()
+
+	if r.members[member.WorkspaceID] == nil {
+		r.members[member.WorkspaceID] = make(map[string]*model.Member)
+	}
+
+	r.members[member.WorkspaceID][member.UserID] = member
+}
+
+func (r *Repository) saveInvitationToMemory(invitation *model.Invitation) {
+	r.workspacesMu.Lock()
+	defer r.workspacesMu.Unlock()
+
+	r.invitations[invitation.Token] = invitation
+}
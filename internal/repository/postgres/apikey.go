@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+func (r *Repository) SaveAPIKey(ctx context.Context, key *model.APIKey) error {
+	scopes := make([]string, 0, len(key.Scopes))
+
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	err := r.queries.InsertAPIKey(ctx, queries.InsertAPIKeyParams{
+		ID:        key.ID,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		Scopes:    scopes,
+		CreatedAt: key.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	row, err := r.queries.SelectAPIKeyByHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select API key: %w", err)
+	}
+
+	return apiKeyFromRow(row), nil
+}
+
+func (r *Repository) GetUserAPIKeys(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	rows, err := r.queries.SelectUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select API keys: %w", err)
+	}
+
+	keys := make([]*model.APIKey, 0, len(rows))
+
+	for _, row := range rows {
+		keys = append(keys, apiKeyFromRow(row))
+	}
+
+	return keys, nil
+}
+
+func (r *Repository) DeleteAPIKey(ctx context.Context, id string, userID string) (bool, error) {
+	rowsAffected, err := r.queries.DeleteAPIKey(ctx, queries.DeleteAPIKeyParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *Repository) UpdateAPIKeyLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	err := r.queries.UpdateAPIKeyLastUsed(ctx, queries.UpdateAPIKeyLastUsedParams{
+		ID:         id,
+		LastUsedAt: &lastUsedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return nil
+}
+
+func apiKeyFromRow(row queries.ApiKey) *model.APIKey {
+	scopes := make([]model.Scope, 0, len(row.Scopes))
+
+	for _, scope := range row.Scopes {
+		scopes = append(scopes, model.Scope(scope))
+	}
+
+	return &model.APIKey{
+		ID:         row.ID,
+		UserID:     row.UserID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Hash:       row.Hash,
+		Scopes:     scopes,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+	}
+}
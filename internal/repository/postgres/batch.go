@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+// defaultCopyThreshold is about where COPY starts to beat a pipelined batch
+// of inserts, which saves creating the staging table. See BenchmarkSaveLinks.
+const defaultCopyThreshold = 100
+
+// createLinksImport stages links for COPY. The ordinal keeps the order of
+// the batch, so that of duplicate links the first one is inserted.
+const createLinksImport = `
+CREATE TEMP TABLE links_import (
+	ordinal INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	original_url TEXT NOT NULL,
+	correlation_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	not_before TIMESTAMPTZ,
+	not_after TIMESTAMPTZ,
+	rules JSONB NOT NULL,
+	variants JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	redirect_status INTEGER NOT NULL,
+	passthrough JSONB,
+	campaign TEXT NOT NULL,
+	domain TEXT NOT NULL,
+	workspace_id TEXT NOT NULL,
+	tags JSONB NOT NULL
+) ON COMMIT DROP
+`
+
+const insertLinksImport = `
+INSERT INTO links (hash, original_url, correlation_id, user_id, not_before, not_after, rules, variants, created_at, redirect_status, passthrough, campaign, domain, workspace_id, tags)
+SELECT hash, original_url, correlation_id, user_id, not_before, not_after, rules, variants, created_at, redirect_status, passthrough, campaign, domain, workspace_id, tags
+FROM links_import
+ORDER BY ordinal
+ON CONFLICT (domain, hash) DO NOTHING
+RETURNING domain, hash
+`
+
+var linksImportColumns = []string{
+	"ordinal", "hash", "original_url", "correlation_id", "user_id", "not_before", "not_after", "rules",
+	"variants", "created_at", "redirect_status", "passthrough", "campaign", "domain", "workspace_id",
+	"tags",
+}
+
+type Option func(*Repository)
+
+// WithCopyThreshold sets the batch size from which links are saved with
+// COPY instead of a pipelined batch of inserts.
+func WithCopyThreshold(size int) Option {
+	return func(r *Repository) {
+		r.copyThreshold = size
+	}
+}
+
+// SaveLinks stores the links in one transaction and reports for each
+// whether it was inserted, false when its hash is already taken on the
+// domain. Small batches are sent as pipelined inserts in a single round
+// trip, large ones are copied into a staging table and inserted from there.
+func (r *Repository) SaveLinks(ctx context.Context, linksToStore []*model.StoredLink) ([]bool, error) {
+	params := make([]queries.InsertLinksParams, 0, len(linksToStore))
+
+	for _, link := range linksToStore {
+		p, err := insertLinksParams(link)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, p)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var results []bool
+
+	if len(params) >= r.copyThreshold {
+		results, err = copyLinks(ctx, tx, params)
+	} else {
+		results, err = r.insertLinks(ctx, tx, params)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+func (r *Repository) insertLinks(ctx context.Context, tx pgx.Tx, params []queries.InsertLinksParams) ([]bool, error) {
+	results := make([]bool, len(params))
+
+	var batchErr error
+
+	r.queries.WithTx(tx).InsertLinks(ctx, params).QueryRow(func(i int, _ string, err error) {
+		switch {
+		case err == nil:
+			results[i] = true
+		case errors.Is(err, pgx.ErrNoRows):
+			// Nothing is returned on conflict
+		case batchErr == nil:
+			batchErr = err
+		}
+	})
+
+	if batchErr != nil {
+		return nil, fmt.Errorf("failed to insert links: %w", batchErr)
+	}
+
+	return results, nil
+}
+
+func copyLinks(ctx context.Context, tx pgx.Tx, params []queries.InsertLinksParams) ([]bool, error) {
+	if _, err := tx.Exec(ctx, createLinksImport); err != nil {
+		return nil, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"links_import"}, linksImportColumns,
+		pgx.CopyFromSlice(len(params), func(i int) ([]any, error) {
+			p := params[i]
+
+			return []any{
+				int32(i), p.Hash, p.OriginalUrl, p.CorrelationID, p.UserID, p.NotBefore, p.NotAfter, p.Rules,
+				p.Variants, p.CreatedAt, p.RedirectStatus, p.Passthrough, p.Campaign, p.Domain, p.WorkspaceID,
+				p.Tags,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy links: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, insertLinksImport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert links: %w", err)
+	}
+	defer rows.Close()
+
+	type key struct {
+		domain string
+		hash   string
+	}
+
+	inserted := make(map[key]bool)
+
+	for rows.Next() {
+		var k key
+
+		if err := rows.Scan(&k.domain, &k.hash); err != nil {
+			return nil, fmt.Errorf("failed to scan inserted link: %w", err)
+		}
+
+		inserted[k] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to insert links: %w", err)
+	}
+
+	results := make([]bool, len(params))
+
+	for i, p := range params {
+		k := key{domain: p.Domain, hash: p.Hash}
+
+		// Only the first of duplicates in the batch was inserted
+		if inserted[k] {
+			results[i] = true
+
+			delete(inserted, k)
+		}
+	}
+
+	return results, nil
+}
+
+func insertLinksParams(link *model.StoredLink) (queries.InsertLinksParams, error) {
+	rules, err := marshalList(link.Rules)
+	if err != nil {
+		return queries.InsertLinksParams{}, fmt.Errorf("failed to encode rules: %w", err)
+	}
+
+	variants, err := marshalList(link.Variants)
+	if err != nil {
+		return queries.InsertLinksParams{}, fmt.Errorf("failed to encode variants: %w", err)
+	}
+
+	tags, err := marshalList(link.Tags)
+	if err != nil {
+		return queries.InsertLinksParams{}, fmt.Errorf("failed to encode tags: %w", err)
+	}
+
+	var passthrough []byte
+
+	if link.Passthrough != nil {
+		passthrough, err = json.Marshal(link.Passthrough)
+		if err != nil {
+			return queries.InsertLinksParams{}, fmt.Errorf("failed to encode passthrough: %w", err)
+		}
+	}
+
+	return queries.InsertLinksParams{
+		Hash:           link.Hash,
+		OriginalUrl:    link.OriginalURL,
+		CorrelationID:  link.CorrelationID,
+		UserID:         link.UserID,
+		NotBefore:      link.NotBefore,
+		NotAfter:       link.NotAfter,
+		Rules:          rules,
+		Variants:       variants,
+		CreatedAt:      link.CreatedAt,
+		RedirectStatus: int32(link.RedirectStatus),
+		Passthrough:    passthrough,
+		Campaign:       link.Campaign,
+		Domain:         link.Domain,
+		WorkspaceID:    link.WorkspaceID,
+		Tags:           tags,
+	}, nil
+}
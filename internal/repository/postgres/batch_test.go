@@ -0,0 +1,125 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests need a database they may write to, e.g.
+//
+//	TEST_DATABASE_DSN=postgres://localhost/shortener_test go test -bench SaveLinks ./internal/repository/postgres/
+const dsnEnv = "TEST_DATABASE_DSN"
+
+var saveMethods = []struct {
+	name      string
+	threshold int
+}{
+	{name: "batch", threshold: math.MaxInt},
+	{name: "copy", threshold: 0},
+}
+
+// batchID makes every batch use its own domain, so hashes never clash
+// with the links of earlier batches.
+var batchID atomic.Int64
+
+func openDB(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		tb.Skip(dsnEnv + " is not set")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, dsn)
+	require.NoError(tb, err)
+
+	require.NoError(tb, postgres.New(db, slog.New(slog.NewTextHandler(io.Discard, nil))).Init(ctx))
+
+	tb.Cleanup(func() {
+		_, err := db.Exec(ctx, "DELETE FROM links WHERE domain LIKE 'batch-%.test'")
+		assert.NoError(tb, err)
+
+		db.Close()
+	})
+
+	return db
+}
+
+func newLinks(size int) []*model.StoredLink {
+	domain := fmt.Sprintf("batch-%d.test", batchID.Add(1))
+	links := make([]*model.StoredLink, 0, size)
+
+	for i := range size {
+		links = append(links, &model.StoredLink{
+			Link: &model.Link{
+				OriginalURL:   fmt.Sprintf("https://example.com/%d", i),
+				CorrelationID: fmt.Sprint(i),
+				Domain:        domain,
+			},
+			Hash:      fmt.Sprintf("%06x", i),
+			UserID:    "user",
+			CreatedAt: time.Now(),
+		})
+	}
+
+	return links
+}
+
+func TestSaveLinks(t *testing.T) {
+	t.Parallel()
+
+	db := openDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, method := range saveMethods {
+		t.Run(method.name, func(t *testing.T) {
+			repo := postgres.New(db, logger, postgres.WithCopyThreshold(method.threshold))
+			links := newLinks(3)
+
+			results, err := repo.SaveLinks(context.Background(), links[:2])
+			require.NoError(t, err)
+			assert.Equal(t, []bool{true, true}, results)
+
+			// An existing link, a new one and its duplicate
+			results, err = repo.SaveLinks(context.Background(), []*model.StoredLink{links[1], links[2], links[2]})
+			require.NoError(t, err)
+			assert.Equal(t, []bool{false, true, false}, results)
+		})
+	}
+}
+
+func BenchmarkSaveLinks(b *testing.B) {
+	db := openDB(b)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, size := range []int{10, 100, 1000, 10000} {
+		for _, method := range saveMethods {
+			repo := postgres.New(db, logger, postgres.WithCopyThreshold(method.threshold))
+
+			b.Run(fmt.Sprintf("%s/%d", method.name, size), func(b *testing.B) {
+				for range b.N {
+					b.StopTimer()
+					links := newLinks(size)
+					b.StartTimer()
+
+					_, err := repo.SaveLinks(context.Background(), links)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+// counterPurgeInterval bounds how often expired counters are deleted.
+const counterPurgeInterval = time.Minute
+
+func (r *Repository) IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	now := time.Now()
+
+	// Counters are keyed by their window, so rows of past windows are never
+	// read again
+	if last := r.countersPurgedAt.Load(); now.Unix()-last > int64(counterPurgeInterval.Seconds()) &&
+		r.countersPurgedAt.CompareAndSwap(last, now.Unix()) {
+		if err := r.queries.DeleteExpiredCounters(ctx, now); err != nil {
+			r.logger.Error("failed to delete expired counters", slog.Any("error", err))
+		}
+	}
+
+	count, err := r.queries.IncrementCounter(ctx, queries.IncrementCounterParams{
+		Key:       key,
+		Count:     delta,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+// linkChangesChannel carries LinkChange events, see the NotifyLinkChanges
+// query.
+const linkChangesChannel = "link_changes"
+
+const (
+	// maxNotifyPayload stays below the 8000 bytes Postgres allows.
+	maxNotifyPayload = 7900
+
+	defaultMinReconnectDelay = time.Second
+	defaultMaxReconnectDelay = 30 * time.Second
+)
+
+// Kinds of link changes.
+const (
+	LinkDeleted = "delete"
+	LinkEdited  = "edit"
+)
+
+var errPayloadTooLarge = errors.New("link change payload too large")
+
+// LinkChange tells the instances caching links which ones changed.
+type LinkChange struct {
+	Op    string    `json:"op"`
+	Links []LinkKey `json:"links"`
+}
+
+type LinkKey struct {
+	Domain string `json:"domain"`
+	Hash   string `json:"hash"`
+}
+
+// LinkChangeHandler evicts changed links from a local cache.
+type LinkChangeHandler interface {
+	Invalidate(domain string, hash string)
+	// Clear drops every link, for when changes may have been missed.
+	Clear()
+}
+
+// notifyLinkChanges publishes the changed links, split into as many
+// notifications as their size requires. Other instances keep serving stale
+// links until their cache expires if it fails, so failures are only logged.
+func (r *Repository) notifyLinkChanges(ctx context.Context, op string, links []LinkKey) {
+	for len(links) > 0 {
+		payload, n, err := linkChangePayload(op, links)
+		if err != nil {
+			r.logger.Error("Failed to encode link changes", slog.Any("error", err))
+
+			return
+		}
+
+		if err := r.queries.NotifyLinkChanges(ctx, payload); err != nil {
+			r.logger.Error("Failed to notify link changes", slog.Any("error", err))
+
+			return
+		}
+
+		links = links[n:]
+	}
+}
+
+// linkChangePayload encodes as many of the links as fit in a notification
+// and returns how many it took.
+func linkChangePayload(op string, links []LinkKey) (string, int, error) {
+	n := len(links)
+
+	for {
+		payload, err := json.Marshal(LinkChange{Op: op, Links: links[:n]})
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to encode link changes: %w", err)
+		}
+
+		if len(payload) <= maxNotifyPayload {
+			return string(payload), n, nil
+		}
+
+		if n == 1 {
+			return "", 0, errPayloadTooLarge
+		}
+
+		// Halving keeps the number of attempts logarithmic
+		n /= 2
+	}
+}
+
+// linkKeys converts the rows of the queries returning changed links.
+func linkKeys[T queries.ClaimLinksRow | queries.MarkLinksAsDeletedRow | queries.MarkWorkspaceLinksAsDeletedRow](
+	rows []T,
+) []LinkKey {
+	keys := make([]LinkKey, 0, len(rows))
+
+	for _, row := range rows {
+		key := queries.ClaimLinksRow(row)
+		keys = append(keys, LinkKey{Domain: key.Domain, Hash: key.Hash})
+	}
+
+	return keys
+}
+
+// Listener evicts links changed by any instance from the local cache. It
+// listens on a connection of its own, outside of the pool, and reconnects
+// when the connection is lost.
+type Listener struct {
+	logger            *slog.Logger
+	config            *pgx.ConnConfig
+	handler           LinkChangeHandler
+	minReconnectDelay time.Duration
+	maxReconnectDelay time.Duration
+	cancel            context.CancelFunc
+	wg                sync.WaitGroup
+}
+
+type ListenerOption func(*Listener)
+
+func NewListener(db *pgxpool.Pool, handler LinkChangeHandler, logger *slog.Logger, opts ...ListenerOption) *Listener {
+	l := &Listener{
+		logger: logger.With(
+			slog.String("component", "listener"),
+		),
+		config:            db.Config().ConnConfig,
+		handler:           handler,
+		minReconnectDelay: defaultMinReconnectDelay,
+		maxReconnectDelay: defaultMaxReconnectDelay,
+		cancel:            func() {},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// WithReconnectDelay sets the delay before reconnecting, doubled after each
+// failed attempt up to max.
+func WithReconnectDelay(minDelay time.Duration, maxDelay time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.minReconnectDelay = minDelay
+		l.maxReconnectDelay = maxDelay
+	}
+}
+
+func (l *Listener) Start(ctx context.Context) {
+	ctx, l.cancel = context.WithCancel(ctx)
+
+	l.wg.Add(1)
+
+	go l.run(ctx)
+}
+
+func (l *Listener) Close() {
+	l.cancel()
+	l.wg.Wait()
+}
+
+func (l *Listener) run(ctx context.Context) {
+	defer l.wg.Done()
+
+	delay := l.minReconnectDelay
+
+	for {
+		listened, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if listened {
+			delay = l.minReconnectDelay
+		}
+
+		l.logger.Error("Lost link changes connection, reconnecting",
+			slog.Any("error", err),
+			slog.Duration("delay", delay),
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		delay = min(delay*2, l.maxReconnectDelay)
+	}
+}
+
+// listen handles notifications until the connection fails. It reports
+// whether it got to listen, so that reconnecting starts over from the
+// shortest delay.
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.ConnectConfig(ctx, l.config)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	defer conn.Close(context.Background()) //nolint:errcheck
+
+	if _, err := conn.Exec(ctx, "LISTEN "+linkChangesChannel); err != nil {
+		return false, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	// Links may have changed while no connection was listening
+	l.handler.Clear()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		var change LinkChange
+
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			l.logger.Error("Failed to decode link change", slog.Any("error", err))
+
+			continue
+		}
+
+		for _, link := range change.Links {
+			l.handler.Invalidate(link.Domain, link.Hash)
+		}
+	}
+}
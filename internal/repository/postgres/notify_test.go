@@ -0,0 +1,89 @@
+package postgres_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changeRecorder passes on the invalidations of links on its domain.
+type changeRecorder struct {
+	domain  string
+	changes chan string
+	clears  chan struct{}
+}
+
+func (r *changeRecorder) Invalidate(domain string, hash string) {
+	if domain == r.domain {
+		r.changes <- hash
+	}
+}
+
+func (r *changeRecorder) Clear() {
+	r.clears <- struct{}{}
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for a notification")
+
+		var zero T
+
+		return zero
+	}
+}
+
+func TestListener(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := openDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	repo := postgres.New(db, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	links := newLinks(2)
+	_, err := repo.SaveLinks(ctx, links)
+	require.NoError(t, err)
+
+	recorder := &changeRecorder{
+		domain:  links[0].Domain,
+		changes: make(chan string, 10),
+		clears:  make(chan struct{}, 10),
+	}
+
+	listener := postgres.NewListener(db, recorder, logger, postgres.WithReconnectDelay(10*time.Millisecond, time.Second))
+	listener.Start(ctx)
+	t.Cleanup(listener.Close)
+
+	receive(t, recorder.clears)
+
+	require.NoError(t, repo.SaveLinkMetadata(ctx, links[0].Domain, links[0].Hash, &model.Metadata{Title: "Edited"}))
+	assert.Equal(t, links[0].Hash, receive(t, recorder.changes))
+
+	// The listener reconnects, and drops what it may have missed meanwhile
+	_, err = db.Exec(ctx, `
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE query = 'LISTEN link_changes'
+	`)
+	require.NoError(t, err)
+
+	receive(t, recorder.clears)
+
+	require.NoError(t, repo.MarkForDeletion(links[1].Domain, []string{links[1].Hash}, "user"))
+	assert.Equal(t, links[1].Hash, receive(t, recorder.changes))
+}
@@ -2,39 +2,61 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/maxpain/shortener/internal/model"
 	"github.com/maxpain/shortener/internal/repository/postgres/queries"
 )
 
+// uniqueViolation is the SQLSTATE of inserts and updates breaking a unique
+// constraint.
+const uniqueViolation = "23505"
+
 type Repository struct {
 	logger   *slog.Logger
 	db       *pgxpool.Pool
 	queries  *queries.Queries
 	deleteCh chan DeletionRequest
+	// copyThreshold is the batch size from which links are saved with COPY.
+	copyThreshold int
+	// countersPurgedAt is the Unix time expired counters were last deleted.
+	countersPurgedAt atomic.Int64
 }
 
+// DeletionRequest removes the links of the domain owned by the user or, when
+// WorkspaceID is set, by the workspace.
 type DeletionRequest struct {
-	Hashes []string
-	UserID string
+	Domain      string
+	Hashes      []string
+	UserID      string
+	WorkspaceID string
 }
 
 // Create a new memory repository with optional persistence to the file.
-func New(db *pgxpool.Pool, logger *slog.Logger) *Repository {
-	return &Repository{
+func New(db *pgxpool.Pool, logger *slog.Logger, opts ...Option) *Repository {
+	r := &Repository{
 		logger: logger.With(
 			slog.String("repository", "postgres"),
 		),
-		db:       db,
-		queries:  queries.New(db),
-		deleteCh: make(chan DeletionRequest, 1024),
+		db:            db,
+		queries:       queries.New(db),
+		deleteCh:      make(chan DeletionRequest, 1024),
+		copyThreshold: defaultCopyThreshold,
+	}
+
+	for _, opt := range opts {
+		opt(r)
 	}
+
+	return r
 }
 
 func (r *Repository) Init(ctx context.Context) error {
@@ -47,8 +69,167 @@ func (r *Repository) Init(ctx context.Context) error {
 			is_deleted BOOLEAN DEFAULT FALSE NOT NULL
 		);
 
+		ALTER TABLE links
+			ADD COLUMN IF NOT EXISTS not_before TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS not_after TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS rules JSONB DEFAULT '[]' NOT NULL,
+			ADD COLUMN IF NOT EXISTS variants JSONB DEFAULT '[]' NOT NULL,
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+			ADD COLUMN IF NOT EXISTS metadata JSONB,
+			ADD COLUMN IF NOT EXISTS redirect_status INTEGER DEFAULT 0 NOT NULL,
+			ADD COLUMN IF NOT EXISTS passthrough JSONB,
+			ADD COLUMN IF NOT EXISTS campaign TEXT DEFAULT '' NOT NULL,
+			ADD COLUMN IF NOT EXISTS domain TEXT DEFAULT '' NOT NULL,
+			ADD COLUMN IF NOT EXISTS workspace_id TEXT DEFAULT '' NOT NULL,
+			ADD COLUMN IF NOT EXISTS tags JSONB DEFAULT '[]' NOT NULL;
+
 		CREATE INDEX IF NOT EXISTS correlation_id_idx ON links (correlation_id);
 		CREATE INDEX IF NOT EXISTS user_id_idx ON links (user_id);
+		CREATE INDEX IF NOT EXISTS workspace_id_idx ON links (workspace_id) WHERE workspace_id <> '';
+
+		CREATE TABLE IF NOT EXISTS clicks (
+			hash VARCHAR(6) NOT NULL,
+			variant TEXT NOT NULL,
+			count BIGINT DEFAULT 0 NOT NULL,
+			PRIMARY KEY (hash, variant)
+		);
+
+		ALTER TABLE clicks ADD COLUMN IF NOT EXISTS domain TEXT DEFAULT '' NOT NULL;
+
+		-- Links are identified by domain and hash since custom domains were
+		-- added. The primary keys are only replaced once.
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT FROM information_schema.key_column_usage
+				WHERE table_name = 'links' AND constraint_name = 'links_pkey' AND column_name = 'domain'
+			) THEN
+				ALTER TABLE links DROP CONSTRAINT IF EXISTS links_pkey;
+				ALTER TABLE links ADD PRIMARY KEY (domain, hash);
+				DROP INDEX IF EXISTS links_domain_hash_idx;
+			END IF;
+
+			IF NOT EXISTS (
+				SELECT FROM information_schema.key_column_usage
+				WHERE table_name = 'clicks' AND constraint_name = 'clicks_pkey' AND column_name = 'domain'
+			) THEN
+				ALTER TABLE clicks DROP CONSTRAINT IF EXISTS clicks_pkey;
+				ALTER TABLE clicks ADD PRIMARY KEY (domain, hash, variant);
+				DROP INDEX IF EXISTS clicks_domain_hash_variant_idx;
+			END IF;
+		END $$;
+
+		CREATE TABLE IF NOT EXISTS domains (
+			name TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS domains_user_id_idx ON domains (user_id);
+
+		ALTER TABLE domains ADD COLUMN IF NOT EXISTS workspace_id TEXT DEFAULT '' NOT NULL;
+
+		-- Domains registered before verification get a token to verify with
+		ALTER TABLE domains
+			ADD COLUMN IF NOT EXISTS verification_token TEXT DEFAULT md5(random()::text) NOT NULL,
+			ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
+
+		-- Domains may be registered by several users until one of them verifies
+		-- it. The primary key is only replaced once.
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT FROM information_schema.key_column_usage
+				WHERE table_name = 'domains' AND constraint_name = 'domains_pkey' AND column_name = 'user_id'
+			) THEN
+				ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_pkey;
+				ALTER TABLE domains ADD PRIMARY KEY (name, user_id);
+			END IF;
+		END $$;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS domains_verified_name_idx ON domains (name) WHERE verified_at IS NOT NULL;
+
+		CREATE TABLE IF NOT EXISTS workspaces (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+			PRIMARY KEY (workspace_id, user_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+		CREATE TABLE IF NOT EXISTS workspace_invitations (
+			token TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+			role TEXT NOT NULL,
+			invited_by TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			accepted_by TEXT DEFAULT '' NOT NULL,
+			accepted_at TIMESTAMPTZ
+		);
+
+		CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			hash TEXT NOT NULL UNIQUE,
+			scopes TEXT[] NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+			last_used_at TIMESTAMPTZ
+		);
+
+		CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+		-- Identity provider accounts have no password and may share an email
+		ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email) WHERE password_hash <> '';
+
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+			id TEXT PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS counters (
+			key TEXT PRIMARY KEY,
+			count BIGINT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		-- Aliases are longer than generated hashes. The columns are only altered
+		-- once, as it locks the tables.
+		DO $$
+		BEGIN
+			IF EXISTS (
+				SELECT FROM information_schema.columns
+				WHERE table_name = 'links' AND column_name = 'hash' AND data_type <> 'text'
+			) THEN
+				ALTER TABLE links ALTER COLUMN hash TYPE TEXT;
+			END IF;
+
+			IF EXISTS (
+				SELECT FROM information_schema.columns
+				WHERE table_name = 'clicks' AND column_name = 'hash' AND data_type <> 'text'
+			) THEN
+				ALTER TABLE clicks ALTER COLUMN hash TYPE TEXT;
+			END IF;
+		END $$;
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
@@ -59,8 +240,11 @@ func (r *Repository) Init(ctx context.Context) error {
 	return nil
 }
 
-func (r *Repository) GetLink(ctx context.Context, hash string) (*model.StoredLink, error) {
-	row, err := r.queries.SelectLink(ctx, hash)
+func (r *Repository) GetLink(ctx context.Context, domain string, hash string) (*model.StoredLink, error) {
+	row, err := r.queries.SelectLink(ctx, queries.SelectLinkParams{
+		Domain: domain,
+		Hash:   hash,
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, model.ErrNotFound
@@ -69,15 +253,7 @@ func (r *Repository) GetLink(ctx context.Context, hash string) (*model.StoredLin
 		return nil, fmt.Errorf("failed to select link: %w", err)
 	}
 
-	return &model.StoredLink{
-		Hash:      row.Hash,
-		UserID:    row.UserID,
-		IsDeleted: row.IsDeleted,
-		Link: &model.Link{
-			OriginalURL:   row.OriginalUrl,
-			CorrelationID: row.CorrelationID,
-		},
-	}, nil
+	return linkFromRow(row)
 }
 
 func (r *Repository) GetUserLinks(ctx context.Context, userID string) ([]*model.StoredLink, error) {
@@ -89,55 +265,120 @@ func (r *Repository) GetUserLinks(ctx context.Context, userID string) ([]*model.
 	links := make([]*model.StoredLink, 0, len(rows))
 
 	for _, row := range rows {
-		links = append(links, &model.StoredLink{
-			Hash:      row.Hash,
-			UserID:    row.UserID,
-			IsDeleted: row.IsDeleted,
-			Link: &model.Link{
-				OriginalURL:   row.OriginalUrl,
-				CorrelationID: row.CorrelationID,
-			},
-		})
+		link, err := linkFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, link)
 	}
 
 	return links, nil
 }
 
-func (r *Repository) SaveLinks(ctx context.Context, linksToStore []*model.StoredLink) ([]bool, error) {
-	results := make([]bool, 0, len(linksToStore))
-
-	tx, err := r.db.Begin(ctx)
+func (r *Repository) GetUserLinksAfter(
+	ctx context.Context,
+	userID string,
+	afterDomain string,
+	afterHash string,
+	limit int,
+) ([]*model.StoredLink, error) {
+	rows, err := r.queries.SelectUserLinksPage(ctx, queries.SelectUserLinksPageParams{
+		UserID:      userID,
+		AfterDomain: afterDomain,
+		AfterHash:   afterHash,
+		Limit:       int32(limit),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", err)
+		return nil, fmt.Errorf("failed to select links: %w", err)
 	}
 
-	defer tx.Rollback(ctx) //nolint:errcheck
+	links := make([]*model.StoredLink, 0, len(rows))
 
-	for _, link := range linksToStore {
-		rowsAffected, err := r.queries.WithTx(tx).InsertLink(ctx, queries.InsertLinkParams{
-			Hash:          link.Hash,
-			OriginalUrl:   link.OriginalURL,
-			CorrelationID: link.CorrelationID,
-			UserID:        link.UserID,
-		})
+	for _, row := range rows {
+		link, err := linkFromRow(row)
 		if err != nil {
-			return nil, fmt.Errorf("failed to insert link: %w", err)
+			return nil, err
 		}
 
-		isExists := rowsAffected == 0
-		results = append(results, !isExists)
+		links = append(links, link)
 	}
 
-	err = tx.Commit(ctx)
+	return links, nil
+}
+
+func linkFromRow(row queries.Link) (*model.StoredLink, error) {
+	var (
+		rules       []model.Rule
+		variants    []model.Variant
+		metadata    *model.Metadata
+		passthrough *model.Passthrough
+		tags        []string
+	)
+
+	if err := json.Unmarshal(row.Rules, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode rules of link %s: %w", row.Hash, err)
+	}
+
+	if err := json.Unmarshal(row.Variants, &variants); err != nil {
+		return nil, fmt.Errorf("failed to decode variants of link %s: %w", row.Hash, err)
+	}
+
+	if row.Metadata != nil {
+		if err := json.Unmarshal(row.Metadata, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata of link %s: %w", row.Hash, err)
+		}
+	}
+
+	if row.Passthrough != nil {
+		if err := json.Unmarshal(row.Passthrough, &passthrough); err != nil {
+			return nil, fmt.Errorf("failed to decode passthrough of link %s: %w", row.Hash, err)
+		}
+	}
+
+	if err := json.Unmarshal(row.Tags, &tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags of link %s: %w", row.Hash, err)
+	}
+
+	return &model.StoredLink{
+		Hash:      row.Hash,
+		UserID:    row.UserID,
+		IsDeleted: row.IsDeleted,
+		CreatedAt: row.CreatedAt,
+		Metadata:  metadata,
+		Link: &model.Link{
+			OriginalURL:    row.OriginalUrl,
+			CorrelationID:  row.CorrelationID,
+			NotBefore:      row.NotBefore,
+			NotAfter:       row.NotAfter,
+			Rules:          rules,
+			Variants:       variants,
+			RedirectStatus: int(row.RedirectStatus),
+			Passthrough:    passthrough,
+			Campaign:       row.Campaign,
+			Domain:         row.Domain,
+			WorkspaceID:    row.WorkspaceID,
+			Tags:           tags,
+		},
+	}, nil
+}
+
+func marshalList[T any](items []T) ([]byte, error) {
+	if items == nil {
+		items = []T{}
+	}
+
+	data, err := json.Marshal(items)
 	if err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to marshal: %w", err)
 	}
 
-	return results, nil
+	return data, nil
 }
 
-func (r *Repository) MarkForDeletion(hashes []string, userID string) error {
+func (r *Repository) MarkForDeletion(domain string, hashes []string, userID string) error {
 	r.deleteCh <- DeletionRequest{
+		Domain: domain,
 		Hashes: hashes,
 		UserID: userID,
 	}
@@ -145,17 +386,16 @@ func (r *Repository) MarkForDeletion(hashes []string, userID string) error {
 	return nil
 }
 
+// DeletionQueueLength is how many deletion requests wait to be applied.
+func (r *Repository) DeletionQueueLength() int {
+	return len(r.deleteCh)
+}
+
 func (r *Repository) deleteLoop(ctx context.Context) {
 	for {
 		select {
 		case req := <-r.deleteCh:
-			timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
-
-			err := r.queries.MarkLinksAsDeleted(timeoutCtx, queries.MarkLinksAsDeletedParams{
-				Hashes: req.Hashes,
-				UserID: req.UserID,
-			})
+			err := r.deleteLinks(ctx, req)
 			if err != nil {
 				if errors.Is(err, context.DeadlineExceeded) {
 					r.logger.Error("deletion request to DB timed out", slog.Any("error", err))
@@ -171,6 +411,209 @@ func (r *Repository) deleteLoop(ctx context.Context) {
 	}
 }
 
+// deleteLinks marks the links deleted and tells the other instances.
+func (r *Repository) deleteLinks(ctx context.Context, req DeletionRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var deleted []LinkKey
+
+	if req.WorkspaceID != "" {
+		rows, err := r.queries.MarkWorkspaceLinksAsDeleted(ctx, queries.MarkWorkspaceLinksAsDeletedParams{
+			Domain:      req.Domain,
+			Hashes:      req.Hashes,
+			WorkspaceID: req.WorkspaceID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark workspace links as deleted: %w", err)
+		}
+
+		deleted = linkKeys(rows)
+	} else {
+		rows, err := r.queries.MarkLinksAsDeleted(ctx, queries.MarkLinksAsDeletedParams{
+			Domain: req.Domain,
+			Hashes: req.Hashes,
+			UserID: req.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark links as deleted: %w", err)
+		}
+
+		deleted = linkKeys(rows)
+	}
+
+	r.notifyLinkChanges(ctx, LinkDeleted, deleted)
+
+	return nil
+}
+
+func (r *Repository) SaveLinkMetadata(
+	ctx context.Context,
+	domain string,
+	hash string,
+	metadata *model.Metadata,
+) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	err = r.queries.UpdateLinkMetadata(ctx, queries.UpdateLinkMetadataParams{
+		Domain:   domain,
+		Hash:     hash,
+		Metadata: data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update link metadata: %w", err)
+	}
+
+	r.notifyLinkChanges(ctx, LinkEdited, []LinkKey{{Domain: domain, Hash: hash}})
+
+	return nil
+}
+
+func (r *Repository) RecordClick(ctx context.Context, domain string, hash string, variant string) error {
+	err := r.queries.IncrementClicks(ctx, queries.IncrementClicksParams{
+		Domain:  domain,
+		Hash:    hash,
+		Variant: variant,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to increment clicks: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetLinkStats(ctx context.Context, domain string, hash string) (*model.LinkStats, error) {
+	rows, err := r.queries.SelectClicks(ctx, queries.SelectClicksParams{
+		Domain: domain,
+		Hash:   hash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select clicks: %w", err)
+	}
+
+	stats := &model.LinkStats{}
+
+	for _, row := range rows {
+		stats.Add(row.Variant, row.Count)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) SaveDomain(ctx context.Context, domain *model.Domain) (bool, error) {
+	rowsAffected, err := r.queries.InsertDomain(ctx, queries.InsertDomainParams{
+		Name:              domain.Name,
+		UserID:            domain.UserID,
+		CreatedAt:         domain.CreatedAt,
+		WorkspaceID:       domain.WorkspaceID,
+		VerificationToken: domain.VerificationToken,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert domain: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *Repository) GetDomain(ctx context.Context, name string) (*model.Domain, error) {
+	row, err := r.queries.SelectDomain(ctx, name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select domain: %w", err)
+	}
+
+	return domainFromRow(row), nil
+}
+
+func (r *Repository) GetDomainClaims(ctx context.Context, name string) ([]*model.Domain, error) {
+	rows, err := r.queries.SelectDomainClaims(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select domain claims: %w", err)
+	}
+
+	domains := make([]*model.Domain, 0, len(rows))
+
+	for _, row := range rows {
+		domains = append(domains, domainFromRow(row))
+	}
+
+	return domains, nil
+}
+
+func (r *Repository) GetUserDomains(ctx context.Context, userID string) ([]*model.Domain, error) {
+	rows, err := r.queries.SelectUserDomains(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select domains: %w", err)
+	}
+
+	domains := make([]*model.Domain, 0, len(rows))
+
+	for _, row := range rows {
+		domains = append(domains, domainFromRow(row))
+	}
+
+	return domains, nil
+}
+
+func (r *Repository) VerifyDomain(ctx context.Context, name string, userID string, verifiedAt time.Time) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	qtx := r.queries.WithTx(tx)
+
+	rowsAffected, err := qtx.UpdateDomainVerified(ctx, queries.UpdateDomainVerifiedParams{
+		Name:       name,
+		UserID:     userID,
+		VerifiedAt: &verifiedAt,
+	})
+	if err != nil {
+		// Another registration was verified meanwhile
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to update domain: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	err = qtx.DeleteDomainClaims(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete domain claims: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func domainFromRow(row queries.Domain) *model.Domain {
+	return &model.Domain{
+		Name:              row.Name,
+		UserID:            row.UserID,
+		CreatedAt:         row.CreatedAt,
+		WorkspaceID:       row.WorkspaceID,
+		VerificationToken: row.VerificationToken,
+		VerifiedAt:        row.VerifiedAt,
+	}
+}
+
 func (r *Repository) Ping(ctx context.Context) error {
 	err := r.db.Ping(ctx)
 	if err != nil {
@@ -1,19 +1,240 @@
 -- name: SelectLink :one
 SELECT *
 FROM links
-WHERE hash = $1;
+WHERE domain = $1 AND hash = $2;
 
 -- name: SelectUserLinks :many
 SELECT *
 FROM links
 WHERE user_id = $1;
 
--- name: InsertLink :execrows
-INSERT INTO links (hash, original_url, correlation_id, user_id)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (hash) DO NOTHING;
+-- name: SelectUserLinksPage :many
+SELECT *
+FROM links
+WHERE user_id = sqlc.arg('user_id') AND (domain, hash) > (sqlc.arg('after_domain')::text, sqlc.arg('after_hash')::text)
+ORDER BY domain, hash
+LIMIT sqlc.arg('limit');
+
+-- name: InsertLinks :batchone
+INSERT INTO links (hash, original_url, correlation_id, user_id, not_before, not_after, rules, variants, created_at, redirect_status, passthrough, campaign, domain, workspace_id, tags)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+ON CONFLICT (domain, hash) DO NOTHING
+RETURNING hash;
+
+-- name: MarkLinksAsDeleted :many
+UPDATE links
+SET is_deleted = true
+WHERE user_id = $1 AND domain = $2 AND hash = ANY(sqlc.arg('hashes')::text[]) AND NOT is_deleted
+RETURNING domain, hash;
 
--- name: MarkLinksAsDeleted :exec
+-- name: MarkWorkspaceLinksAsDeleted :many
 UPDATE links
 SET is_deleted = true
-WHERE user_id = $1 AND hash = ANY(sqlc.arg('hashes')::text[]);
\ No newline at end of file
+WHERE workspace_id = $1 AND domain = $2 AND hash = ANY(sqlc.arg('hashes')::text[]) AND NOT is_deleted
+RETURNING domain, hash;
+
+-- name: SelectWorkspaceLinks :many
+SELECT *
+FROM links
+WHERE workspace_id = $1
+ORDER BY created_at, hash;
+
+-- name: UpdateLinkMetadata :exec
+UPDATE links
+SET metadata = $3
+WHERE domain = $1 AND hash = $2;
+
+-- name: IncrementClicks :exec
+INSERT INTO clicks (domain, hash, variant, count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (domain, hash, variant) DO UPDATE SET count = clicks.count + 1;
+
+-- name: SelectClicks :many
+SELECT variant, count
+FROM clicks
+WHERE domain = $1 AND hash = $2;
+
+-- name: InsertDomain :execrows
+INSERT INTO domains (name, user_id, created_at, workspace_id, verification_token)
+SELECT sqlc.arg('name')::text, sqlc.arg('user_id')::text, sqlc.arg('created_at')::timestamptz,
+    sqlc.arg('workspace_id')::text, sqlc.arg('verification_token')::text
+WHERE NOT EXISTS (
+    SELECT FROM domains
+    WHERE name = sqlc.arg('name') AND verified_at IS NOT NULL
+)
+ON CONFLICT (name, user_id) DO NOTHING;
+
+-- name: UpdateDomainVerified :execrows
+UPDATE domains
+SET verified_at = $3
+WHERE name = $1 AND user_id = $2 AND NOT EXISTS (
+    SELECT FROM domains verified
+    WHERE verified.name = $1 AND verified.verified_at IS NOT NULL
+);
+
+-- name: DeleteDomainClaims :exec
+DELETE FROM domains
+WHERE name = $1 AND verified_at IS NULL;
+
+-- name: SelectDomain :one
+SELECT *
+FROM domains
+WHERE name = $1 AND verified_at IS NOT NULL;
+
+-- name: SelectDomainClaims :many
+SELECT *
+FROM domains
+WHERE name = $1
+ORDER BY created_at;
+
+-- name: SelectUserDomains :many
+SELECT *
+FROM domains
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: InsertWorkspace :exec
+INSERT INTO workspaces (id, name, created_at)
+VALUES ($1, $2, $3);
+
+-- name: SelectWorkspace :one
+SELECT *
+FROM workspaces
+WHERE id = $1;
+
+-- name: SelectUserWorkspaces :many
+SELECT w.id, w.name, w.created_at, m.role
+FROM workspaces w
+JOIN workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1
+ORDER BY w.created_at;
+
+-- name: InsertWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+
+-- name: SelectWorkspaceMember :one
+SELECT *
+FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: SelectWorkspaceMembers :many
+SELECT *
+FROM workspace_members
+WHERE workspace_id = $1
+ORDER BY created_at;
+
+-- name: InsertInvitation :exec
+INSERT INTO workspace_invitations (token, workspace_id, role, invited_by, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: SelectInvitation :one
+SELECT *
+FROM workspace_invitations
+WHERE token = $1;
+
+-- name: AcceptInvitation :execrows
+UPDATE workspace_invitations
+SET accepted_by = $2, accepted_at = $3
+WHERE token = $1 AND accepted_by = '' AND expires_at > $3;
+
+-- name: InsertUser :execrows
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (email) WHERE password_hash <> '' DO NOTHING;
+
+-- name: SelectUser :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: SelectUserByEmail :one
+SELECT *
+FROM users
+WHERE email = $1 AND password_hash <> '';
+
+-- name: ClaimLinks :many
+UPDATE links
+SET user_id = sqlc.arg('to_user_id')
+WHERE user_id = sqlc.arg('from_user_id')
+RETURNING domain, hash;
+
+-- name: ClaimMemberships :exec
+WITH moved AS (
+    DELETE FROM workspace_members
+    WHERE user_id = sqlc.arg('from_user_id')
+    RETURNING workspace_id, role, created_at
+)
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+SELECT workspace_id, sqlc.arg('to_user_id')::text, role, created_at
+FROM moved
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+
+-- name: ClaimDomains :exec
+UPDATE domains
+SET user_id = sqlc.arg('to_user_id')
+WHERE user_id = sqlc.arg('from_user_id') AND NOT EXISTS (
+    SELECT FROM domains claimed
+    WHERE claimed.name = domains.name AND claimed.user_id = sqlc.arg('to_user_id')
+);
+
+-- name: InsertAPIKey :exec
+INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: SelectAPIKeyByHash :one
+SELECT *
+FROM api_keys
+WHERE hash = $1;
+
+-- name: SelectUserAPIKeys :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateAPIKeyLastUsed :exec
+UPDATE api_keys
+SET last_used_at = $2
+WHERE id = $1;
+
+-- name: UpsertExternalUser :one
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, '', $3)
+ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email
+RETURNING *;
+
+-- name: InsertRevokedToken :exec
+INSERT INTO revoked_tokens (id, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at < $1;
+
+-- name: SelectTokenRevoked :one
+SELECT EXISTS (
+	SELECT 1
+	FROM revoked_tokens
+	WHERE id = $1 AND expires_at > now()
+);
+
+-- name: IncrementCounter :one
+INSERT INTO counters (key, count, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE
+SET count = counters.count + EXCLUDED.count, expires_at = EXCLUDED.expires_at
+RETURNING count;
+
+-- name: DeleteExpiredCounters :exec
+DELETE FROM counters
+WHERE expires_at < $1;
+
+-- name: NotifyLinkChanges :exec
+SELECT pg_notify('link_changes', sqlc.arg('payload')::text);
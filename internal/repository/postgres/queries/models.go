@@ -4,10 +4,95 @@
 
 package queries
 
+import (
+	"time"
+)
+
+type ApiKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type Click struct {
+	Hash    string
+	Variant string
+	Count   int64
+	Domain  string
+}
+
+type Counter struct {
+	Key       string
+	Count     int64
+	ExpiresAt time.Time
+}
+
+type Domain struct {
+	Name              string
+	UserID            string
+	CreatedAt         time.Time
+	WorkspaceID       string
+	VerificationToken string
+	VerifiedAt        *time.Time
+}
+
 type Link struct {
-	Hash          string
-	OriginalUrl   string
-	CorrelationID string
-	UserID        string
-	IsDeleted     bool
+	Hash           string
+	OriginalUrl    string
+	CorrelationID  string
+	UserID         string
+	IsDeleted      bool
+	NotBefore      *time.Time
+	NotAfter       *time.Time
+	Rules          []byte
+	Variants       []byte
+	CreatedAt      time.Time
+	Metadata       []byte
+	RedirectStatus int32
+	Passthrough    []byte
+	Campaign       string
+	Domain         string
+	WorkspaceID    string
+	Tags           []byte
+}
+
+type RevokedToken struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+type User struct {
+	ID           string
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+type Workspace struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+type WorkspaceInvitation struct {
+	Token       string
+	WorkspaceID string
+	Role        string
+	InvitedBy   string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	AcceptedBy  string
+	AcceptedAt  *time.Time
+}
+
+type WorkspaceMember struct {
+	WorkspaceID string
+	UserID      string
+	Role        string
+	CreatedAt   time.Time
 }
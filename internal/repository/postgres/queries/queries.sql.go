@@ -7,73 +7,734 @@ package queries
 
 import (
 	"context"
+	"time"
 )
 
-const insertLink = `-- name: InsertLink :execrows
-INSERT INTO links (hash, original_url, correlation_id, user_id)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (hash) DO NOTHING
+const acceptInvitation = `-- name: AcceptInvitation :execrows
+UPDATE workspace_invitations
+SET accepted_by = $2, accepted_at = $3
+WHERE token = $1 AND accepted_by = '' AND expires_at > $3
 `
 
-type InsertLinkParams struct {
-	Hash          string
-	OriginalUrl   string
-	CorrelationID string
-	UserID        string
+type AcceptInvitationParams struct {
+	Token      string
+	AcceptedBy string
+	AcceptedAt *time.Time
 }
 
-// InsertLink
+// AcceptInvitation
 //
-//	INSERT INTO links (hash, original_url, correlation_id, user_id)
-//	VALUES ($1, $2, $3, $4)
-//	ON CONFLICT (hash) DO NOTHING
-func (q *Queries) InsertLink(ctx context.Context, arg InsertLinkParams) (int64, error) {
-	result, err := q.db.Exec(ctx, insertLink,
+//	UPDATE workspace_invitations
+//	SET accepted_by = $2, accepted_at = $3
+//	WHERE token = $1 AND accepted_by = '' AND expires_at > $3
+func (q *Queries) AcceptInvitation(ctx context.Context, arg AcceptInvitationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, acceptInvitation, arg.Token, arg.AcceptedBy, arg.AcceptedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const claimDomains = `-- name: ClaimDomains :exec
+UPDATE domains
+SET user_id = $1
+WHERE user_id = $2 AND NOT EXISTS (
+    SELECT FROM domains claimed
+    WHERE claimed.name = domains.name AND claimed.user_id = $1
+)
+`
+
+type ClaimDomainsParams struct {
+	ToUserID   string
+	FromUserID string
+}
+
+// ClaimDomains
+//
+//	UPDATE domains
+//	SET user_id = $1
+//	WHERE user_id = $2 AND NOT EXISTS (
+//	    SELECT FROM domains claimed
+//	    WHERE claimed.name = domains.name AND claimed.user_id = $1
+//	)
+func (q *Queries) ClaimDomains(ctx context.Context, arg ClaimDomainsParams) error {
+	_, err := q.db.Exec(ctx, claimDomains, arg.ToUserID, arg.FromUserID)
+	return err
+}
+
+const claimLinks = `-- name: ClaimLinks :many
+UPDATE links
+SET user_id = $1
+WHERE user_id = $2
+RETURNING domain, hash
+`
+
+type ClaimLinksParams struct {
+	ToUserID   string
+	FromUserID string
+}
+
+type ClaimLinksRow struct {
+	Domain string
+	Hash   string
+}
+
+// ClaimLinks
+//
+//	UPDATE links
+//	SET user_id = $1
+//	WHERE user_id = $2
+//	RETURNING domain, hash
+func (q *Queries) ClaimLinks(ctx context.Context, arg ClaimLinksParams) ([]ClaimLinksRow, error) {
+	rows, err := q.db.Query(ctx, claimLinks, arg.ToUserID, arg.FromUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ClaimLinksRow{}
+	for rows.Next() {
+		var i ClaimLinksRow
+		if err := rows.Scan(&i.Domain, &i.Hash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimMemberships = `-- name: ClaimMemberships :exec
+WITH moved AS (
+    DELETE FROM workspace_members
+    WHERE user_id = $1
+    RETURNING workspace_id, role, created_at
+)
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+SELECT workspace_id, $2::text, role, created_at
+FROM moved
+ON CONFLICT (workspace_id, user_id) DO NOTHING
+`
+
+type ClaimMembershipsParams struct {
+	FromUserID string
+	ToUserID   string
+}
+
+// ClaimMemberships
+//
+//	WITH moved AS (
+//	    DELETE FROM workspace_members
+//	    WHERE user_id = $1
+//	    RETURNING workspace_id, role, created_at
+//	)
+//	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+//	SELECT workspace_id, $2::text, role, created_at
+//	FROM moved
+//	ON CONFLICT (workspace_id, user_id) DO NOTHING
+func (q *Queries) ClaimMemberships(ctx context.Context, arg ClaimMembershipsParams) error {
+	_, err := q.db.Exec(ctx, claimMemberships, arg.FromUserID, arg.ToUserID)
+	return err
+}
+
+const deleteAPIKey = `-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteAPIKeyParams struct {
+	ID     string
+	UserID string
+}
+
+// DeleteAPIKey
+//
+//	DELETE FROM api_keys
+//	WHERE id = $1 AND user_id = $2
+func (q *Queries) DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAPIKey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteDomainClaims = `-- name: DeleteDomainClaims :exec
+DELETE FROM domains
+WHERE name = $1 AND verified_at IS NULL
+`
+
+// DeleteDomainClaims
+//
+//	DELETE FROM domains
+//	WHERE name = $1 AND verified_at IS NULL
+func (q *Queries) DeleteDomainClaims(ctx context.Context, name string) error {
+	_, err := q.db.Exec(ctx, deleteDomainClaims, name)
+	return err
+}
+
+const deleteExpiredCounters = `-- name: DeleteExpiredCounters :exec
+DELETE FROM counters
+WHERE expires_at < $1
+`
+
+// DeleteExpiredCounters
+//
+//	DELETE FROM counters
+//	WHERE expires_at < $1
+func (q *Queries) DeleteExpiredCounters(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.Exec(ctx, deleteExpiredCounters, expiresAt)
+	return err
+}
+
+const deleteExpiredRevokedTokens = `-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at < $1
+`
+
+// DeleteExpiredRevokedTokens
+//
+//	DELETE FROM revoked_tokens
+//	WHERE expires_at < $1
+func (q *Queries) DeleteExpiredRevokedTokens(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.Exec(ctx, deleteExpiredRevokedTokens, expiresAt)
+	return err
+}
+
+const incrementClicks = `-- name: IncrementClicks :exec
+INSERT INTO clicks (domain, hash, variant, count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (domain, hash, variant) DO UPDATE SET count = clicks.count + 1
+`
+
+type IncrementClicksParams struct {
+	Domain  string
+	Hash    string
+	Variant string
+}
+
+// IncrementClicks
+//
+//	INSERT INTO clicks (domain, hash, variant, count)
+//	VALUES ($1, $2, $3, 1)
+//	ON CONFLICT (domain, hash, variant) DO UPDATE SET count = clicks.count + 1
+func (q *Queries) IncrementClicks(ctx context.Context, arg IncrementClicksParams) error {
+	_, err := q.db.Exec(ctx, incrementClicks, arg.Domain, arg.Hash, arg.Variant)
+	return err
+}
+
+const incrementCounter = `-- name: IncrementCounter :one
+INSERT INTO counters (key, count, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE
+SET count = counters.count + EXCLUDED.count, expires_at = EXCLUDED.expires_at
+RETURNING count
+`
+
+type IncrementCounterParams struct {
+	Key       string
+	Count     int64
+	ExpiresAt time.Time
+}
+
+// IncrementCounter
+//
+//	INSERT INTO counters (key, count, expires_at)
+//	VALUES ($1, $2, $3)
+//	ON CONFLICT (key) DO UPDATE
+//	SET count = counters.count + EXCLUDED.count, expires_at = EXCLUDED.expires_at
+//	RETURNING count
+func (q *Queries) IncrementCounter(ctx context.Context, arg IncrementCounterParams) (int64, error) {
+	row := q.db.QueryRow(ctx, incrementCounter, arg.Key, arg.Count, arg.ExpiresAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const insertAPIKey = `-- name: InsertAPIKey :exec
+INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type InsertAPIKeyParams struct {
+	ID        string
+	UserID    string
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// InsertAPIKey
+//
+//	INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at)
+//	VALUES ($1, $2, $3, $4, $5, $6, $7)
+func (q *Queries) InsertAPIKey(ctx context.Context, arg InsertAPIKeyParams) error {
+	_, err := q.db.Exec(ctx, insertAPIKey,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.Prefix,
 		arg.Hash,
-		arg.OriginalUrl,
-		arg.CorrelationID,
+		arg.Scopes,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const insertDomain = `-- name: InsertDomain :execrows
+INSERT INTO domains (name, user_id, created_at, workspace_id, verification_token)
+SELECT $1::text, $2::text, $3::timestamptz,
+    $4::text, $5::text
+WHERE NOT EXISTS (
+    SELECT FROM domains
+    WHERE name = $1 AND verified_at IS NOT NULL
+)
+ON CONFLICT (name, user_id) DO NOTHING
+`
+
+type InsertDomainParams struct {
+	Name              string
+	UserID            string
+	CreatedAt         time.Time
+	WorkspaceID       string
+	VerificationToken string
+}
+
+// InsertDomain
+//
+//	INSERT INTO domains (name, user_id, created_at, workspace_id, verification_token)
+//	SELECT $1::text, $2::text, $3::timestamptz,
+//	    $4::text, $5::text
+//	WHERE NOT EXISTS (
+//	    SELECT FROM domains
+//	    WHERE name = $1 AND verified_at IS NOT NULL
+//	)
+//	ON CONFLICT (name, user_id) DO NOTHING
+func (q *Queries) InsertDomain(ctx context.Context, arg InsertDomainParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertDomain,
+		arg.Name,
 		arg.UserID,
+		arg.CreatedAt,
+		arg.WorkspaceID,
+		arg.VerificationToken,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertInvitation = `-- name: InsertInvitation :exec
+INSERT INTO workspace_invitations (token, workspace_id, role, invited_by, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type InsertInvitationParams struct {
+	Token       string
+	WorkspaceID string
+	Role        string
+	InvitedBy   string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// InsertInvitation
+//
+//	INSERT INTO workspace_invitations (token, workspace_id, role, invited_by, created_at, expires_at)
+//	VALUES ($1, $2, $3, $4, $5, $6)
+func (q *Queries) InsertInvitation(ctx context.Context, arg InsertInvitationParams) error {
+	_, err := q.db.Exec(ctx, insertInvitation,
+		arg.Token,
+		arg.WorkspaceID,
+		arg.Role,
+		arg.InvitedBy,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const insertRevokedToken = `-- name: InsertRevokedToken :exec
+INSERT INTO revoked_tokens (id, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (id) DO NOTHING
+`
+
+type InsertRevokedTokenParams struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// InsertRevokedToken
+//
+//	INSERT INTO revoked_tokens (id, expires_at)
+//	VALUES ($1, $2)
+//	ON CONFLICT (id) DO NOTHING
+func (q *Queries) InsertRevokedToken(ctx context.Context, arg InsertRevokedTokenParams) error {
+	_, err := q.db.Exec(ctx, insertRevokedToken, arg.ID, arg.ExpiresAt)
+	return err
+}
+
+const insertUser = `-- name: InsertUser :execrows
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (email) WHERE password_hash <> '' DO NOTHING
+`
+
+type InsertUserParams struct {
+	ID           string
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+// InsertUser
+//
+//	INSERT INTO users (id, email, password_hash, created_at)
+//	VALUES ($1, $2, $3, $4)
+//	ON CONFLICT (email) WHERE password_hash <> '' DO NOTHING
+func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertUser,
+		arg.ID,
+		arg.Email,
+		arg.PasswordHash,
+		arg.CreatedAt,
 	)
 	if err != nil {
 		return 0, err
 	}
-	return result.RowsAffected(), nil
+	return result.RowsAffected(), nil
+}
+
+const insertWorkspace = `-- name: InsertWorkspace :exec
+INSERT INTO workspaces (id, name, created_at)
+VALUES ($1, $2, $3)
+`
+
+type InsertWorkspaceParams struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// InsertWorkspace
+//
+//	INSERT INTO workspaces (id, name, created_at)
+//	VALUES ($1, $2, $3)
+func (q *Queries) InsertWorkspace(ctx context.Context, arg InsertWorkspaceParams) error {
+	_, err := q.db.Exec(ctx, insertWorkspace, arg.ID, arg.Name, arg.CreatedAt)
+	return err
+}
+
+const insertWorkspaceMember = `-- name: InsertWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (workspace_id, user_id) DO NOTHING
+`
+
+type InsertWorkspaceMemberParams struct {
+	WorkspaceID string
+	UserID      string
+	Role        string
+	CreatedAt   time.Time
+}
+
+// InsertWorkspaceMember
+//
+//	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+//	VALUES ($1, $2, $3, $4)
+//	ON CONFLICT (workspace_id, user_id) DO NOTHING
+func (q *Queries) InsertWorkspaceMember(ctx context.Context, arg InsertWorkspaceMemberParams) error {
+	_, err := q.db.Exec(ctx, insertWorkspaceMember,
+		arg.WorkspaceID,
+		arg.UserID,
+		arg.Role,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const markLinksAsDeleted = `-- name: MarkLinksAsDeleted :many
+UPDATE links
+SET is_deleted = true
+WHERE user_id = $1 AND domain = $2 AND hash = ANY($3::text[]) AND NOT is_deleted
+RETURNING domain, hash
+`
+
+type MarkLinksAsDeletedParams struct {
+	UserID string
+	Domain string
+	Hashes []string
+}
+
+type MarkLinksAsDeletedRow struct {
+	Domain string
+	Hash   string
+}
+
+// MarkLinksAsDeleted
+//
+//	UPDATE links
+//	SET is_deleted = true
+//	WHERE user_id = $1 AND domain = $2 AND hash = ANY($3::text[]) AND NOT is_deleted
+//	RETURNING domain, hash
+func (q *Queries) MarkLinksAsDeleted(ctx context.Context, arg MarkLinksAsDeletedParams) ([]MarkLinksAsDeletedRow, error) {
+	rows, err := q.db.Query(ctx, markLinksAsDeleted, arg.UserID, arg.Domain, arg.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MarkLinksAsDeletedRow{}
+	for rows.Next() {
+		var i MarkLinksAsDeletedRow
+		if err := rows.Scan(&i.Domain, &i.Hash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markWorkspaceLinksAsDeleted = `-- name: MarkWorkspaceLinksAsDeleted :many
+UPDATE links
+SET is_deleted = true
+WHERE workspace_id = $1 AND domain = $2 AND hash = ANY($3::text[]) AND NOT is_deleted
+RETURNING domain, hash
+`
+
+type MarkWorkspaceLinksAsDeletedParams struct {
+	WorkspaceID string
+	Domain      string
+	Hashes      []string
+}
+
+type MarkWorkspaceLinksAsDeletedRow struct {
+	Domain string
+	Hash   string
+}
+
+// MarkWorkspaceLinksAsDeleted
+//
+//	UPDATE links
+//	SET is_deleted = true
+//	WHERE workspace_id = $1 AND domain = $2 AND hash = ANY($3::text[]) AND NOT is_deleted
+//	RETURNING domain, hash
+func (q *Queries) MarkWorkspaceLinksAsDeleted(ctx context.Context, arg MarkWorkspaceLinksAsDeletedParams) ([]MarkWorkspaceLinksAsDeletedRow, error) {
+	rows, err := q.db.Query(ctx, markWorkspaceLinksAsDeleted, arg.WorkspaceID, arg.Domain, arg.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MarkWorkspaceLinksAsDeletedRow{}
+	for rows.Next() {
+		var i MarkWorkspaceLinksAsDeletedRow
+		if err := rows.Scan(&i.Domain, &i.Hash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const notifyLinkChanges = `-- name: NotifyLinkChanges :exec
+SELECT pg_notify('link_changes', $1::text)
+`
+
+// NotifyLinkChanges
+//
+//	SELECT pg_notify('link_changes', $1::text)
+func (q *Queries) NotifyLinkChanges(ctx context.Context, payload string) error {
+	_, err := q.db.Exec(ctx, notifyLinkChanges, payload)
+	return err
+}
+
+const selectAPIKeyByHash = `-- name: SelectAPIKeyByHash :one
+SELECT id, user_id, name, prefix, hash, scopes, created_at, last_used_at
+FROM api_keys
+WHERE hash = $1
+`
+
+// SelectAPIKeyByHash
+//
+//	SELECT id, user_id, name, prefix, hash, scopes, created_at, last_used_at
+//	FROM api_keys
+//	WHERE hash = $1
+func (q *Queries) SelectAPIKeyByHash(ctx context.Context, hash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, selectAPIKeyByHash, hash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const selectClicks = `-- name: SelectClicks :many
+SELECT variant, count
+FROM clicks
+WHERE domain = $1 AND hash = $2
+`
+
+type SelectClicksParams struct {
+	Domain string
+	Hash   string
+}
+
+type SelectClicksRow struct {
+	Variant string
+	Count   int64
+}
+
+// SelectClicks
+//
+//	SELECT variant, count
+//	FROM clicks
+//	WHERE domain = $1 AND hash = $2
+func (q *Queries) SelectClicks(ctx context.Context, arg SelectClicksParams) ([]SelectClicksRow, error) {
+	rows, err := q.db.Query(ctx, selectClicks, arg.Domain, arg.Hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SelectClicksRow{}
+	for rows.Next() {
+		var i SelectClicksRow
+		if err := rows.Scan(&i.Variant, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectDomain = `-- name: SelectDomain :one
+SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+FROM domains
+WHERE name = $1 AND verified_at IS NOT NULL
+`
+
+// SelectDomain
+//
+//	SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+//	FROM domains
+//	WHERE name = $1 AND verified_at IS NOT NULL
+func (q *Queries) SelectDomain(ctx context.Context, name string) (Domain, error) {
+	row := q.db.QueryRow(ctx, selectDomain, name)
+	var i Domain
+	err := row.Scan(
+		&i.Name,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+		&i.VerificationToken,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const selectDomainClaims = `-- name: SelectDomainClaims :many
+SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+FROM domains
+WHERE name = $1
+ORDER BY created_at
+`
+
+// SelectDomainClaims
+//
+//	SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+//	FROM domains
+//	WHERE name = $1
+//	ORDER BY created_at
+func (q *Queries) SelectDomainClaims(ctx context.Context, name string) ([]Domain, error) {
+	rows, err := q.db.Query(ctx, selectDomainClaims, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Domain{}
+	for rows.Next() {
+		var i Domain
+		if err := rows.Scan(
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.WorkspaceID,
+			&i.VerificationToken,
+			&i.VerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const markLinksAsDeleted = `-- name: MarkLinksAsDeleted :exec
-UPDATE links
-SET is_deleted = true
-WHERE user_id = $1 AND hash = ANY($2::text[])
+const selectInvitation = `-- name: SelectInvitation :one
+SELECT token, workspace_id, role, invited_by, created_at, expires_at, accepted_by, accepted_at
+FROM workspace_invitations
+WHERE token = $1
 `
 
-type MarkLinksAsDeletedParams struct {
-	UserID string
-	Hashes []string
-}
-
-// MarkLinksAsDeleted
+// SelectInvitation
 //
-//	UPDATE links
-//	SET is_deleted = true
-//	WHERE user_id = $1 AND hash = ANY($2::text[])
-func (q *Queries) MarkLinksAsDeleted(ctx context.Context, arg MarkLinksAsDeletedParams) error {
-	_, err := q.db.Exec(ctx, markLinksAsDeleted, arg.UserID, arg.Hashes)
-	return err
+//	SELECT token, workspace_id, role, invited_by, created_at, expires_at, accepted_by, accepted_at
+//	FROM workspace_invitations
+//	WHERE token = $1
+func (q *Queries) SelectInvitation(ctx context.Context, token string) (WorkspaceInvitation, error) {
+	row := q.db.QueryRow(ctx, selectInvitation, token)
+	var i WorkspaceInvitation
+	err := row.Scan(
+		&i.Token,
+		&i.WorkspaceID,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.AcceptedBy,
+		&i.AcceptedAt,
+	)
+	return i, err
 }
 
 const selectLink = `-- name: SelectLink :one
-SELECT hash, original_url, correlation_id, user_id, is_deleted
+SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
 FROM links
-WHERE hash = $1
+WHERE domain = $1 AND hash = $2
 `
 
+type SelectLinkParams struct {
+	Domain string
+	Hash   string
+}
+
 // SelectLink
 //
-//	SELECT hash, original_url, correlation_id, user_id, is_deleted
+//	SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
 //	FROM links
-//	WHERE hash = $1
-func (q *Queries) SelectLink(ctx context.Context, hash string) (Link, error) {
-	row := q.db.QueryRow(ctx, selectLink, hash)
+//	WHERE domain = $1 AND hash = $2
+func (q *Queries) SelectLink(ctx context.Context, arg SelectLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, selectLink, arg.Domain, arg.Hash)
 	var i Link
 	err := row.Scan(
 		&i.Hash,
@@ -81,19 +742,181 @@ func (q *Queries) SelectLink(ctx context.Context, hash string) (Link, error) {
 		&i.CorrelationID,
 		&i.UserID,
 		&i.IsDeleted,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.Rules,
+		&i.Variants,
+		&i.CreatedAt,
+		&i.Metadata,
+		&i.RedirectStatus,
+		&i.Passthrough,
+		&i.Campaign,
+		&i.Domain,
+		&i.WorkspaceID,
+		&i.Tags,
+	)
+	return i, err
+}
+
+const selectTokenRevoked = `-- name: SelectTokenRevoked :one
+SELECT EXISTS (
+	SELECT 1
+	FROM revoked_tokens
+	WHERE id = $1 AND expires_at > now()
+)
+`
+
+// SelectTokenRevoked
+//
+//	SELECT EXISTS (
+//		SELECT 1
+//		FROM revoked_tokens
+//		WHERE id = $1 AND expires_at > now()
+//	)
+func (q *Queries) SelectTokenRevoked(ctx context.Context, id string) (bool, error) {
+	row := q.db.QueryRow(ctx, selectTokenRevoked, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const selectUser = `-- name: SelectUser :one
+SELECT id, email, password_hash, created_at
+FROM users
+WHERE id = $1
+`
+
+// SelectUser
+//
+//	SELECT id, email, password_hash, created_at
+//	FROM users
+//	WHERE id = $1
+func (q *Queries) SelectUser(ctx context.Context, id string) (User, error) {
+	row := q.db.QueryRow(ctx, selectUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const selectUserAPIKeys = `-- name: SelectUserAPIKeys :many
+SELECT id, user_id, name, prefix, hash, scopes, created_at, last_used_at
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+// SelectUserAPIKeys
+//
+//	SELECT id, user_id, name, prefix, hash, scopes, created_at, last_used_at
+//	FROM api_keys
+//	WHERE user_id = $1
+//	ORDER BY created_at
+func (q *Queries) SelectUserAPIKeys(ctx context.Context, userID string) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, selectUserAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ApiKey{}
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.Prefix,
+			&i.Hash,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectUserByEmail = `-- name: SelectUserByEmail :one
+SELECT id, email, password_hash, created_at
+FROM users
+WHERE email = $1 AND password_hash <> ''
+`
+
+// SelectUserByEmail
+//
+//	SELECT id, email, password_hash, created_at
+//	FROM users
+//	WHERE email = $1 AND password_hash <> ''
+func (q *Queries) SelectUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, selectUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const selectUserDomains = `-- name: SelectUserDomains :many
+SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+FROM domains
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+// SelectUserDomains
+//
+//	SELECT name, user_id, created_at, workspace_id, verification_token, verified_at
+//	FROM domains
+//	WHERE user_id = $1
+//	ORDER BY created_at
+func (q *Queries) SelectUserDomains(ctx context.Context, userID string) ([]Domain, error) {
+	rows, err := q.db.Query(ctx, selectUserDomains, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Domain{}
+	for rows.Next() {
+		var i Domain
+		if err := rows.Scan(
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.WorkspaceID,
+			&i.VerificationToken,
+			&i.VerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const selectUserLinks = `-- name: SelectUserLinks :many
-SELECT hash, original_url, correlation_id, user_id, is_deleted
+SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
 FROM links
 WHERE user_id = $1
 `
 
 // SelectUserLinks
 //
-//	SELECT hash, original_url, correlation_id, user_id, is_deleted
+//	SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
 //	FROM links
 //	WHERE user_id = $1
 func (q *Queries) SelectUserLinks(ctx context.Context, userID string) ([]Link, error) {
@@ -111,6 +934,265 @@ func (q *Queries) SelectUserLinks(ctx context.Context, userID string) ([]Link, e
 			&i.CorrelationID,
 			&i.UserID,
 			&i.IsDeleted,
+			&i.NotBefore,
+			&i.NotAfter,
+			&i.Rules,
+			&i.Variants,
+			&i.CreatedAt,
+			&i.Metadata,
+			&i.RedirectStatus,
+			&i.Passthrough,
+			&i.Campaign,
+			&i.Domain,
+			&i.WorkspaceID,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectUserLinksPage = `-- name: SelectUserLinksPage :many
+SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
+FROM links
+WHERE user_id = $1 AND (domain, hash) > ($2::text, $3::text)
+ORDER BY domain, hash
+LIMIT $4
+`
+
+type SelectUserLinksPageParams struct {
+	UserID      string
+	AfterDomain string
+	AfterHash   string
+	Limit       int32
+}
+
+// SelectUserLinksPage
+//
+//	SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
+//	FROM links
+//	WHERE user_id = $1 AND (domain, hash) > ($2::text, $3::text)
+//	ORDER BY domain, hash
+//	LIMIT $4
+func (q *Queries) SelectUserLinksPage(ctx context.Context, arg SelectUserLinksPageParams) ([]Link, error) {
+	rows, err := q.db.Query(ctx, selectUserLinksPage,
+		arg.UserID,
+		arg.AfterDomain,
+		arg.AfterHash,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Link{}
+	for rows.Next() {
+		var i Link
+		if err := rows.Scan(
+			&i.Hash,
+			&i.OriginalUrl,
+			&i.CorrelationID,
+			&i.UserID,
+			&i.IsDeleted,
+			&i.NotBefore,
+			&i.NotAfter,
+			&i.Rules,
+			&i.Variants,
+			&i.CreatedAt,
+			&i.Metadata,
+			&i.RedirectStatus,
+			&i.Passthrough,
+			&i.Campaign,
+			&i.Domain,
+			&i.WorkspaceID,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectUserWorkspaces = `-- name: SelectUserWorkspaces :many
+SELECT w.id, w.name, w.created_at, m.role
+FROM workspaces w
+JOIN workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1
+ORDER BY w.created_at
+`
+
+type SelectUserWorkspacesRow struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	Role      string
+}
+
+// SelectUserWorkspaces
+//
+//	SELECT w.id, w.name, w.created_at, m.role
+//	FROM workspaces w
+//	JOIN workspace_members m ON m.workspace_id = w.id
+//	WHERE m.user_id = $1
+//	ORDER BY w.created_at
+func (q *Queries) SelectUserWorkspaces(ctx context.Context, userID string) ([]SelectUserWorkspacesRow, error) {
+	rows, err := q.db.Query(ctx, selectUserWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SelectUserWorkspacesRow{}
+	for rows.Next() {
+		var i SelectUserWorkspacesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectWorkspace = `-- name: SelectWorkspace :one
+SELECT id, name, created_at
+FROM workspaces
+WHERE id = $1
+`
+
+// SelectWorkspace
+//
+//	SELECT id, name, created_at
+//	FROM workspaces
+//	WHERE id = $1
+func (q *Queries) SelectWorkspace(ctx context.Context, id string) (Workspace, error) {
+	row := q.db.QueryRow(ctx, selectWorkspace, id)
+	var i Workspace
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const selectWorkspaceLinks = `-- name: SelectWorkspaceLinks :many
+SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
+FROM links
+WHERE workspace_id = $1
+ORDER BY created_at, hash
+`
+
+// SelectWorkspaceLinks
+//
+//	SELECT hash, original_url, correlation_id, user_id, is_deleted, not_before, not_after, rules, variants, created_at, metadata, redirect_status, passthrough, campaign, domain, workspace_id, tags
+//	FROM links
+//	WHERE workspace_id = $1
+//	ORDER BY created_at, hash
+func (q *Queries) SelectWorkspaceLinks(ctx context.Context, workspaceID string) ([]Link, error) {
+	rows, err := q.db.Query(ctx, selectWorkspaceLinks, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Link{}
+	for rows.Next() {
+		var i Link
+		if err := rows.Scan(
+			&i.Hash,
+			&i.OriginalUrl,
+			&i.CorrelationID,
+			&i.UserID,
+			&i.IsDeleted,
+			&i.NotBefore,
+			&i.NotAfter,
+			&i.Rules,
+			&i.Variants,
+			&i.CreatedAt,
+			&i.Metadata,
+			&i.RedirectStatus,
+			&i.Passthrough,
+			&i.Campaign,
+			&i.Domain,
+			&i.WorkspaceID,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectWorkspaceMember = `-- name: SelectWorkspaceMember :one
+SELECT workspace_id, user_id, role, created_at
+FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2
+`
+
+type SelectWorkspaceMemberParams struct {
+	WorkspaceID string
+	UserID      string
+}
+
+// SelectWorkspaceMember
+//
+//	SELECT workspace_id, user_id, role, created_at
+//	FROM workspace_members
+//	WHERE workspace_id = $1 AND user_id = $2
+func (q *Queries) SelectWorkspaceMember(ctx context.Context, arg SelectWorkspaceMemberParams) (WorkspaceMember, error) {
+	row := q.db.QueryRow(ctx, selectWorkspaceMember, arg.WorkspaceID, arg.UserID)
+	var i WorkspaceMember
+	err := row.Scan(
+		&i.WorkspaceID,
+		&i.UserID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const selectWorkspaceMembers = `-- name: SelectWorkspaceMembers :many
+SELECT workspace_id, user_id, role, created_at
+FROM workspace_members
+WHERE workspace_id = $1
+ORDER BY created_at
+`
+
+// SelectWorkspaceMembers
+//
+//	SELECT workspace_id, user_id, role, created_at
+//	FROM workspace_members
+//	WHERE workspace_id = $1
+//	ORDER BY created_at
+func (q *Queries) SelectWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error) {
+	rows, err := q.db.Query(ctx, selectWorkspaceMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WorkspaceMember{}
+	for rows.Next() {
+		var i WorkspaceMember
+		if err := rows.Scan(
+			&i.WorkspaceID,
+			&i.UserID,
+			&i.Role,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -121,3 +1203,108 @@ func (q *Queries) SelectUserLinks(ctx context.Context, userID string) ([]Link, e
 	}
 	return items, nil
 }
+
+const updateAPIKeyLastUsed = `-- name: UpdateAPIKeyLastUsed :exec
+UPDATE api_keys
+SET last_used_at = $2
+WHERE id = $1
+`
+
+type UpdateAPIKeyLastUsedParams struct {
+	ID         string
+	LastUsedAt *time.Time
+}
+
+// UpdateAPIKeyLastUsed
+//
+//	UPDATE api_keys
+//	SET last_used_at = $2
+//	WHERE id = $1
+func (q *Queries) UpdateAPIKeyLastUsed(ctx context.Context, arg UpdateAPIKeyLastUsedParams) error {
+	_, err := q.db.Exec(ctx, updateAPIKeyLastUsed, arg.ID, arg.LastUsedAt)
+	return err
+}
+
+const updateDomainVerified = `-- name: UpdateDomainVerified :execrows
+UPDATE domains
+SET verified_at = $3
+WHERE name = $1 AND user_id = $2 AND NOT EXISTS (
+    SELECT FROM domains verified
+    WHERE verified.name = $1 AND verified.verified_at IS NOT NULL
+)
+`
+
+type UpdateDomainVerifiedParams struct {
+	Name       string
+	UserID     string
+	VerifiedAt *time.Time
+}
+
+// UpdateDomainVerified
+//
+//	UPDATE domains
+//	SET verified_at = $3
+//	WHERE name = $1 AND user_id = $2 AND NOT EXISTS (
+//	    SELECT FROM domains verified
+//	    WHERE verified.name = $1 AND verified.verified_at IS NOT NULL
+//	)
+func (q *Queries) UpdateDomainVerified(ctx context.Context, arg UpdateDomainVerifiedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateDomainVerified, arg.Name, arg.UserID, arg.VerifiedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateLinkMetadata = `-- name: UpdateLinkMetadata :exec
+UPDATE links
+SET metadata = $3
+WHERE domain = $1 AND hash = $2
+`
+
+type UpdateLinkMetadataParams struct {
+	Domain   string
+	Hash     string
+	Metadata []byte
+}
+
+// UpdateLinkMetadata
+//
+//	UPDATE links
+//	SET metadata = $3
+//	WHERE domain = $1 AND hash = $2
+func (q *Queries) UpdateLinkMetadata(ctx context.Context, arg UpdateLinkMetadataParams) error {
+	_, err := q.db.Exec(ctx, updateLinkMetadata, arg.Domain, arg.Hash, arg.Metadata)
+	return err
+}
+
+const upsertExternalUser = `-- name: UpsertExternalUser :one
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, '', $3)
+ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email
+RETURNING id, email, password_hash, created_at
+`
+
+type UpsertExternalUserParams struct {
+	ID        string
+	Email     string
+	CreatedAt time.Time
+}
+
+// UpsertExternalUser
+//
+//	INSERT INTO users (id, email, password_hash, created_at)
+//	VALUES ($1, $2, '', $3)
+//	ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email
+//	RETURNING id, email, password_hash, created_at
+func (q *Queries) UpsertExternalUser(ctx context.Context, arg UpsertExternalUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, upsertExternalUser, arg.ID, arg.Email, arg.CreatedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
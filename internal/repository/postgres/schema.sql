@@ -6,5 +6,164 @@ CREATE TABLE IF NOT EXISTS links (
 	is_deleted BOOLEAN DEFAULT FALSE NOT NULL
 );
 
+ALTER TABLE links
+	ADD COLUMN IF NOT EXISTS not_before TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS not_after TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS rules JSONB DEFAULT '[]' NOT NULL,
+	ADD COLUMN IF NOT EXISTS variants JSONB DEFAULT '[]' NOT NULL,
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+	ADD COLUMN IF NOT EXISTS metadata JSONB,
+	ADD COLUMN IF NOT EXISTS redirect_status INTEGER DEFAULT 0 NOT NULL,
+	ADD COLUMN IF NOT EXISTS passthrough JSONB,
+	ADD COLUMN IF NOT EXISTS campaign TEXT DEFAULT '' NOT NULL,
+	ADD COLUMN IF NOT EXISTS domain TEXT DEFAULT '' NOT NULL,
+	ADD COLUMN IF NOT EXISTS workspace_id TEXT DEFAULT '' NOT NULL,
+	ADD COLUMN IF NOT EXISTS tags JSONB DEFAULT '[]' NOT NULL;
+
 CREATE INDEX IF NOT EXISTS correlation_id_idx ON links (correlation_id);
-CREATE INDEX IF NOT EXISTS user_id_idx ON links (user_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS user_id_idx ON links (user_id);
+CREATE INDEX IF NOT EXISTS workspace_id_idx ON links (workspace_id) WHERE workspace_id <> '';
+
+CREATE TABLE IF NOT EXISTS clicks (
+	hash VARCHAR(6) NOT NULL,
+	variant TEXT NOT NULL,
+	count BIGINT DEFAULT 0 NOT NULL,
+	PRIMARY KEY (hash, variant)
+);
+
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS domain TEXT DEFAULT '' NOT NULL;
+
+-- Links are identified by domain and hash since custom domains were
+-- added. The primary keys are only replaced once.
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT FROM information_schema.key_column_usage
+		WHERE table_name = 'links' AND constraint_name = 'links_pkey' AND column_name = 'domain'
+	) THEN
+		ALTER TABLE links DROP CONSTRAINT IF EXISTS links_pkey;
+		ALTER TABLE links ADD PRIMARY KEY (domain, hash);
+		DROP INDEX IF EXISTS links_domain_hash_idx;
+	END IF;
+
+	IF NOT EXISTS (
+		SELECT FROM information_schema.key_column_usage
+		WHERE table_name = 'clicks' AND constraint_name = 'clicks_pkey' AND column_name = 'domain'
+	) THEN
+		ALTER TABLE clicks DROP CONSTRAINT IF EXISTS clicks_pkey;
+		ALTER TABLE clicks ADD PRIMARY KEY (domain, hash, variant);
+		DROP INDEX IF EXISTS clicks_domain_hash_variant_idx;
+	END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS domains (
+	name TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS domains_user_id_idx ON domains (user_id);
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS workspace_id TEXT DEFAULT '' NOT NULL;
+
+-- Domains registered before verification get a token to verify with
+ALTER TABLE domains
+	ADD COLUMN IF NOT EXISTS verification_token TEXT DEFAULT md5(random()::text) NOT NULL,
+	ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
+
+-- Domains may be registered by several users until one of them verifies
+-- it. The primary key is only replaced once.
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT FROM information_schema.key_column_usage
+		WHERE table_name = 'domains' AND constraint_name = 'domains_pkey' AND column_name = 'user_id'
+	) THEN
+		ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_pkey;
+		ALTER TABLE domains ADD PRIMARY KEY (name, user_id);
+	END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS domains_verified_name_idx ON domains (name) WHERE verified_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS workspaces (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+	workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+	PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+	token TEXT PRIMARY KEY,
+	workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	invited_by TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	accepted_by TEXT DEFAULT '' NOT NULL,
+	accepted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+	last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+-- Identity provider accounts have no password and may share an email
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email) WHERE password_hash <> '';
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	id TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS counters (
+	key TEXT PRIMARY KEY,
+	count BIGINT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Aliases are longer than generated hashes. The columns are only altered
+-- once, as it locks the tables.
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT FROM information_schema.columns
+		WHERE table_name = 'links' AND column_name = 'hash' AND data_type <> 'text'
+	) THEN
+		ALTER TABLE links ALTER COLUMN hash TYPE TEXT;
+	END IF;
+
+	IF EXISTS (
+		SELECT FROM information_schema.columns
+		WHERE table_name = 'clicks' AND column_name = 'hash' AND data_type <> 'text'
+	) THEN
+		ALTER TABLE clicks ALTER COLUMN hash TYPE TEXT;
+	END IF;
+END $$;
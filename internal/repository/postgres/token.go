@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+func (r *Repository) RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	// Expired tokens are rejected anyway, so their revocations can go
+	if err := r.queries.DeleteExpiredRevokedTokens(ctx, time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired revocations: %w", err)
+	}
+
+	err := r.queries.InsertRevokedToken(ctx, queries.InsertRevokedTokenParams{
+		ID:        id,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert revocation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	revoked, err := r.queries.SelectTokenRevoked(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to select revocation: %w", err)
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+func (r *Repository) SaveUser(ctx context.Context, user *model.User) (bool, error) {
+	rowsAffected, err := r.queries.InsertUser(ctx, queries.InsertUserParams{
+		ID:           user.ID,
+		Email:        user.Email,
+		PasswordHash: user.PasswordHash,
+		CreatedAt:    user.CreatedAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *Repository) SaveExternalUser(ctx context.Context, user *model.User) (*model.User, error) {
+	row, err := r.queries.UpsertExternalUser(ctx, queries.UpsertExternalUserParams{
+		ID:        user.ID,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert user: %w", err)
+	}
+
+	return userFromRow(row), nil
+}
+
+func (r *Repository) GetUser(ctx context.Context, id string) (*model.User, error) {
+	row, err := r.queries.SelectUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select user: %w", err)
+	}
+
+	return userFromRow(row), nil
+}
+
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	row, err := r.queries.SelectUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select user: %w", err)
+	}
+
+	return userFromRow(row), nil
+}
+
+func (r *Repository) ClaimLinks(ctx context.Context, fromUserID string, toUserID string) (int64, error) {
+	rows, err := r.queries.ClaimLinks(ctx, queries.ClaimLinksParams{
+		ToUserID:   toUserID,
+		FromUserID: fromUserID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim links: %w", err)
+	}
+
+	r.notifyLinkChanges(ctx, LinkEdited, linkKeys(rows))
+
+	return int64(len(rows)), nil
+}
+
+func (r *Repository) ClaimWorkspacesAndDomains(ctx context.Context, fromUserID string, toUserID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	qtx := r.queries.WithTx(tx)
+
+	err = qtx.ClaimMemberships(ctx, queries.ClaimMembershipsParams{
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to claim memberships: %w", err)
+	}
+
+	err = qtx.ClaimDomains(ctx, queries.ClaimDomainsParams{
+		ToUserID:   toUserID,
+		FromUserID: fromUserID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to claim domains: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func userFromRow(row queries.User) *model.User {
+	return &model.User{
+		ID:           row.ID,
+		Email:        row.Email,
+		PasswordHash: row.PasswordHash,
+		CreatedAt:    row.CreatedAt,
+	}
+}
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/repository/postgres/queries"
+)
+
+func (r *Repository) CreateWorkspace(ctx context.Context, workspace *model.Workspace, owner *model.Member) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	qtx := r.queries.WithTx(tx)
+
+	err = qtx.InsertWorkspace(ctx, queries.InsertWorkspaceParams{
+		ID:        workspace.ID,
+		Name:      workspace.Name,
+		CreatedAt: workspace.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert workspace: %w", err)
+	}
+
+	err = qtx.InsertWorkspaceMember(ctx, memberParams(owner))
+	if err != nil {
+		return fmt.Errorf("failed to insert member: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetWorkspace(ctx context.Context, id string) (*model.Workspace, error) {
+	row, err := r.queries.SelectWorkspace(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select workspace: %w", err)
+	}
+
+	return &model.Workspace{
+		ID:        row.ID,
+		Name:      row.Name,
+		CreatedAt: row.CreatedAt,
+	}, nil
+}
+
+func (r *Repository) GetUserWorkspaces(ctx context.Context, userID string) ([]*model.Workspace, error) {
+	rows, err := r.queries.SelectUserWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select workspaces: %w", err)
+	}
+
+	workspaces := make([]*model.Workspace, 0, len(rows))
+
+	for _, row := range rows {
+		workspaces = append(workspaces, &model.Workspace{
+			ID:        row.ID,
+			Name:      row.Name,
+			CreatedAt: row.CreatedAt,
+			Role:      model.Role(row.Role),
+		})
+	}
+
+	return workspaces, nil
+}
+
+func (r *Repository) GetMember(ctx context.Context, workspaceID string, userID string) (*model.Member, error) {
+	row, err := r.queries.SelectWorkspaceMember(ctx, queries.SelectWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select member: %w", err)
+	}
+
+	return memberFromRow(row), nil
+}
+
+func (r *Repository) GetMembers(ctx context.Context, workspaceID string) ([]*model.Member, error) {
+	rows, err := r.queries.SelectWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select members: %w", err)
+	}
+
+	members := make([]*model.Member, 0, len(rows))
+
+	for _, row := range rows {
+		members = append(members, memberFromRow(row))
+	}
+
+	return members, nil
+}
+
+func (r *Repository) SaveInvitation(ctx context.Context, invitation *model.Invitation) error {
+	err := r.queries.InsertInvitation(ctx, queries.InsertInvitationParams{
+		Token:       invitation.Token,
+		WorkspaceID: invitation.WorkspaceID,
+		Role:        string(invitation.Role),
+		InvitedBy:   invitation.InvitedBy,
+		CreatedAt:   invitation.CreatedAt,
+		ExpiresAt:   invitation.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetInvitation(ctx context.Context, token string) (*model.Invitation, error) {
+	row, err := r.queries.SelectInvitation(ctx, token)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to select invitation: %w", err)
+	}
+
+	return &model.Invitation{
+		Token:       row.Token,
+		WorkspaceID: row.WorkspaceID,
+		Role:        model.Role(row.Role),
+		InvitedBy:   row.InvitedBy,
+		CreatedAt:   row.CreatedAt,
+		ExpiresAt:   row.ExpiresAt,
+		AcceptedBy:  row.AcceptedBy,
+		AcceptedAt:  row.AcceptedAt,
+	}, nil
+}
+
+func (r *Repository) AcceptInvitation(ctx context.Context, token string, member *model.Member) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	qtx := r.queries.WithTx(tx)
+
+	rowsAffected, err := qtx.AcceptInvitation(ctx, queries.AcceptInvitationParams{
+		Token:      token,
+		AcceptedBy: member.UserID,
+		AcceptedAt: &member.CreatedAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	err = qtx.InsertWorkspaceMember(ctx, memberParams(member))
+	if err != nil {
+		return false, fmt.Errorf("failed to insert member: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) GetWorkspaceLinks(ctx context.Context, workspaceID string) ([]*model.StoredLink, error) {
+	rows, err := r.queries.SelectWorkspaceLinks(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select links: %w", err)
+	}
+
+	links := make([]*model.StoredLink, 0, len(rows))
+
+	for _, row := range rows {
+		link, err := linkFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+func (r *Repository) MarkWorkspaceLinksForDeletion(domain string, hashes []string, workspaceID string) error {
+	r.deleteCh <- DeletionRequest{
+		Domain:      domain,
+		Hashes:      hashes,
+		WorkspaceID: workspaceID,
+	}
+
+	return nil
+}
+
+func memberParams(member *model.Member) queries.InsertWorkspaceMemberParams {
+	return queries.InsertWorkspaceMemberParams{
+		WorkspaceID: member.WorkspaceID,
+		UserID:      member.UserID,
+		Role:        string(member.Role),
+		CreatedAt:   member.CreatedAt,
+	}
+}
+
+func memberFromRow(row queries.WorkspaceMember) *model.Member {
+	return &model.Member{
+		WorkspaceID: row.WorkspaceID,
+		UserID:      row.UserID,
+		Role:        model.Role(row.Role),
+		CreatedAt:   row.CreatedAt,
+	}
+}
@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+const (
+	apiKeyPrefix      = "sk_"
+	apiKeyLength      = 32
+	apiKeyShownPrefix = len(apiKeyPrefix) + 8
+
+	// lastUsedResolution bounds how often the last used timestamp of a key
+	// is written, so busy scripts do not turn every request into a write.
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyRepository interface {
+	SaveAPIKey(ctx context.Context, key *model.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userID string) ([]*model.APIKey, error)
+	// DeleteAPIKey returns false if the user has no key with the ID.
+	DeleteAPIKey(ctx context.Context, id string, userID string) (bool, error)
+	UpdateAPIKeyLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error
+}
+
+type APIKeyUseCase struct {
+	logger *slog.Logger
+	repo   Repository
+	clock  func() time.Time
+}
+
+func NewAPIKeyUseCase(repo Repository, logger *slog.Logger) *APIKeyUseCase {
+	return &APIKeyUseCase{
+		logger: logger.With(
+			slog.String("usecase", "apikey"),
+		),
+		repo:  repo,
+		clock: time.Now,
+	}
+}
+
+// Create issues a new key for a registered user and returns it together with
+// the plaintext key, which cannot be recovered later.
+func (u *APIKeyUseCase) Create(
+	ctx context.Context,
+	name string,
+	scopes []model.Scope,
+	userID string,
+) (*model.APIKey, string, error) {
+	if err := model.ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := u.repo.GetUser(ctx, userID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, "", model.ErrAccountRequired
+		}
+
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := generateToken(apiKeyLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+
+	plaintext := apiKeyPrefix + token
+	key := &model.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    plaintext[:apiKeyShownPrefix],
+		Hash:      hashAPIKey(plaintext),
+		Scopes:    slices.Compact(scopes),
+		CreatedAt: u.clock(),
+	}
+
+	if err := u.repo.SaveAPIKey(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("failed to save API key: %w", err)
+	}
+
+	return key, plaintext, nil
+}
+
+func (u *APIKeyUseCase) GetUserAPIKeys(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	keys, err := u.repo.GetUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (u *APIKeyUseCase) Revoke(ctx context.Context, id string, userID string) error {
+	deleted, err := u.repo.DeleteAPIKey(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	if !deleted {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// Authenticate looks the key up and records its use.
+func (u *APIKeyUseCase) Authenticate(ctx context.Context, plaintext string) (*model.APIKey, error) {
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) {
+		return nil, model.ErrInvalidAPIKey
+	}
+
+	key, err := u.repo.GetAPIKeyByHash(ctx, hashAPIKey(plaintext))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, model.ErrInvalidAPIKey
+		}
+
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	now := u.clock()
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := u.repo.UpdateAPIKeyLastUsed(ctx, key.ID, now); err != nil {
+			u.logger.Error("failed to update API key last used time", slog.Any("error", err))
+		}
+	}
+
+	return key, nil
+}
+
+// hashAPIKey uses a fast hash: keys are long random strings, so unlike
+// passwords they cannot be brute-forced from the hash.
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package usecase_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/maxpain/shortener/internal/model"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/maxpain/shortener/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	apiKeyUseCase := usecase.NewAPIKeyUseCase(repo, logger)
+	user, err := usecase.NewUserUseCase(repo, logger).SignUp(ctx, "ci@example.com", "long enough", "")
+	require.NoError(t, err)
+
+	_, _, err = apiKeyUseCase.Create(ctx, "ci", []model.Scope{model.ScopeRead}, "anonymous-id")
+	require.ErrorIs(t, err, model.ErrAccountRequired)
+
+	_, _, err = apiKeyUseCase.Create(ctx, "ci", nil, user.ID)
+	require.ErrorIs(t, err, model.ErrInvalidScope)
+
+	key, plaintext, err := apiKeyUseCase.Create(ctx, " ci ", []model.Scope{
+		model.ScopeShorten, model.ScopeRead, model.ScopeShorten,
+	}, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", key.Name)
+	assert.Equal(t, []model.Scope{model.ScopeRead, model.ScopeShorten}, key.Scopes)
+	assert.Equal(t, plaintext[:len(key.Prefix)], key.Prefix)
+	assert.NotContains(t, key.Hash, plaintext)
+	assert.Nil(t, key.LastUsedAt)
+
+	authenticated, err := apiKeyUseCase.Authenticate(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, authenticated.UserID)
+
+	keys, err := apiKeyUseCase.GetUserAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsedAt, "authentication must record the last use")
+
+	_, err = apiKeyUseCase.Authenticate(ctx, plaintext+"x")
+	require.ErrorIs(t, err, model.ErrInvalidAPIKey)
+
+	require.ErrorIs(t, apiKeyUseCase.Revoke(ctx, key.ID, "another-user-id"), model.ErrNotFound)
+	require.NoError(t, apiKeyUseCase.Revoke(ctx, key.ID, user.ID))
+
+	_, err = apiKeyUseCase.Authenticate(ctx, plaintext)
+	require.ErrorIs(t, err, model.ErrInvalidAPIKey)
+}
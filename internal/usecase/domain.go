@@ -0,0 +1,311 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+const domainTokenLength = 16
+
+// DomainRepository keeps the registrations of domains. A domain may be
+// registered by several users until one of them verifies it.
+type DomainRepository interface {
+	// SaveDomain returns false if the domain is verified, or if the user
+	// already registered it.
+	SaveDomain(ctx context.Context, domain *model.Domain) (bool, error)
+	// GetDomain returns the verified registration of the domain.
+	GetDomain(ctx context.Context, name string) (*model.Domain, error)
+	// GetDomainClaims returns every registration of the domain.
+	GetDomainClaims(ctx context.Context, name string) ([]*model.Domain, error)
+	GetUserDomains(ctx context.Context, userID string) ([]*model.Domain, error)
+	// VerifyDomain marks the registration of the user verified and drops the
+	// others. It returns false if another one was verified first.
+	VerifyDomain(ctx context.Context, name string, userID string, verifiedAt time.Time) (bool, error)
+}
+
+// TXTResolver looks up the TXT records of a name, like
+// net.Resolver.LookupTXT.
+type TXTResolver func(ctx context.Context, name string) ([]string, error)
+
+type DomainUseCase struct {
+	logger   *slog.Logger
+	repo     Repository
+	clock    func() time.Time
+	resolver TXTResolver
+	reserved map[string]bool
+}
+
+type DomainOption func(*DomainUseCase)
+
+func NewDomainUseCase(repo Repository, logger *slog.Logger, opts ...DomainOption) *DomainUseCase {
+	u := &DomainUseCase{
+		logger: logger.With(
+			slog.String("usecase", "domain"),
+		),
+		repo:     repo,
+		clock:    time.Now,
+		resolver: net.DefaultResolver.LookupTXT,
+		reserved: make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
+}
+
+// WithReservedDomains keeps the hosts serving the default domain, such as
+// the one of the base URL, from being registered.
+func WithReservedDomains(names ...string) DomainOption {
+	return func(u *DomainUseCase) {
+		for _, name := range names {
+			if name, err := model.NormalizeDomain(name); err == nil {
+				u.reserved[name] = true
+			}
+		}
+	}
+}
+
+func WithTXTResolver(resolver TXTResolver) DomainOption {
+	return func(u *DomainUseCase) {
+		u.resolver = resolver
+	}
+}
+
+// Register binds a custom domain to the user, or to the workspace if
+// workspaceID is set and the user owns it. The domain serves links once
+// verified, and can no longer be registered by anyone else then.
+func (u *DomainUseCase) Register(
+	ctx context.Context,
+	name string,
+	userID string,
+	workspaceID string,
+) (*model.Domain, error) {
+	name, err := model.NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.reserved[name] {
+		return nil, model.ErrDomainReserved
+	}
+
+	if workspaceID != "" {
+		if _, err := authorize(ctx, u.repo, workspaceID, userID, model.RoleOwner); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := generateToken(domainTokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := &model.Domain{
+		Name:              name,
+		UserID:            userID,
+		WorkspaceID:       workspaceID,
+		CreatedAt:         u.clock(),
+		VerificationToken: token,
+	}
+
+	saved, err := u.repo.SaveDomain(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save domain: %w", err)
+	}
+
+	if !saved {
+		return nil, model.ErrDomainTaken
+	}
+
+	return domain, nil
+}
+
+// Verify marks the registration of the domain verified if the verification
+// record holds its token. Only whoever may register the domain may verify
+// the registration, and only the first registration verified counts.
+func (u *DomainUseCase) Verify(ctx context.Context, name string, userID string) (*model.Domain, error) {
+	name, err := model.NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := u.repo.GetDomainClaims(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain claims: %w", err)
+	}
+
+	claims, err = u.ownedClaims(ctx, claims, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, domain := range claims {
+		if domain.Verified() {
+			return domain, nil
+		}
+	}
+
+	records, err := u.resolver(ctx, claims[0].VerificationRecord())
+	if err != nil {
+		u.logger.Info("Failed to look up domain verification record",
+			slog.String("domain", name),
+			slog.Any("error", err),
+		)
+
+		return nil, model.ErrDomainNotVerified
+	}
+
+	for _, domain := range claims {
+		if !slices.Contains(records, domain.VerificationToken) {
+			continue
+		}
+
+		now := u.clock()
+
+		verified, err := u.repo.VerifyDomain(ctx, name, domain.UserID, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify domain: %w", err)
+		}
+
+		if !verified {
+			return nil, model.ErrDomainTaken
+		}
+
+		domain := *domain
+		domain.VerifiedAt = &now
+
+		return &domain, nil
+	}
+
+	return nil, model.ErrDomainNotVerified
+}
+
+// ownedClaims keeps the registrations of the user, and those of workspaces
+// the user owns.
+func (u *DomainUseCase) ownedClaims(ctx context.Context, claims []*model.Domain, userID string) ([]*model.Domain, error) {
+	owned := make([]*model.Domain, 0, len(claims))
+	forbidden := false
+
+	for _, domain := range claims {
+		if domain.UserID != userID {
+			if domain.WorkspaceID == "" {
+				continue
+			}
+
+			if _, err := authorize(ctx, u.repo, domain.WorkspaceID, userID, model.RoleOwner); err != nil {
+				if errors.Is(err, model.ErrForbidden) {
+					forbidden = true
+
+					continue
+				}
+
+				return nil, err
+			}
+		}
+
+		owned = append(owned, domain)
+	}
+
+	if len(owned) == 0 {
+		if forbidden {
+			return nil, model.ErrForbidden
+		}
+
+		return nil, model.ErrUnknownDomain
+	}
+
+	return owned, nil
+}
+
+func (u *DomainUseCase) GetUserDomains(ctx context.Context, userID string) ([]*model.Domain, error) {
+	domains, err := u.repo.GetUserDomains(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user domains: %w", err)
+	}
+
+	return domains, nil
+}
+
+// linkDomain maps the request host to the domain links are scoped by. Hosts
+// that are not verified custom domains serve the default domain.
+func (u *LinkUseCase) linkDomain(ctx context.Context, host string) (string, error) {
+	if host == "" {
+		return "", nil
+	}
+
+	if _, err := u.repo.GetDomain(ctx, host); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("failed to get domain: %w", err)
+	}
+
+	return host, nil
+}
+
+// checkDomain verifies that the user may create links on the domain.
+func (u *LinkUseCase) checkDomain(ctx context.Context, name string, userID string) error {
+	if name == "" {
+		return nil
+	}
+
+	domain, err := u.repo.GetDomain(ctx, name)
+	if err == nil {
+		return u.checkDomainUser(ctx, domain, userID)
+	}
+
+	if !errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("failed to get domain: %w", err)
+	}
+
+	claims, err := u.repo.GetDomainClaims(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get domain claims: %w", err)
+	}
+
+	for _, domain := range claims {
+		err := u.checkDomainUser(ctx, domain, userID)
+		if err == nil {
+			// Its links would not be served
+			return model.ErrDomainNotVerified
+		}
+
+		if !errors.Is(err, model.ErrUnknownDomain) {
+			return err
+		}
+	}
+
+	return model.ErrUnknownDomain
+}
+
+// checkDomainUser verifies that the user registered the domain, or edits
+// the workspace it was registered for.
+func (u *LinkUseCase) checkDomainUser(ctx context.Context, domain *model.Domain, userID string) error {
+	if domain.UserID == userID {
+		return nil
+	}
+
+	if domain.WorkspaceID == "" {
+		return model.ErrUnknownDomain
+	}
+
+	if _, err := authorize(ctx, u.repo, domain.WorkspaceID, userID, model.RoleEditor); err != nil {
+		if errors.Is(err, model.ErrForbidden) {
+			return model.ErrUnknownDomain
+		}
+
+		return err
+	}
+
+	return nil
+}
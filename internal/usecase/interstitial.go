@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+// interstitialPolicy decides whether visitors should see a warning page
+// before being sent to a destination.
+type interstitialPolicy struct {
+	allowedDomains []string
+	trustedRole    model.Role
+}
+
+// WithInterstitial asks visitors to confirm redirects to destinations outside
+// of allowedDomains. Subdomains of an allowed domain are allowed too. Links
+// of a workspace never show the warning while their creator holds at least
+// trustedRole in it. An empty trustedRole trusts no one.
+func WithInterstitial(allowedDomains []string, trustedRole model.Role) Option {
+	return func(u *LinkUseCase) {
+		policy := &interstitialPolicy{
+			allowedDomains: make([]string, 0, len(allowedDomains)),
+			trustedRole:    trustedRole,
+		}
+
+		for _, domain := range allowedDomains {
+			policy.allowedDomains = append(policy.allowedDomains, strings.ToLower(strings.TrimPrefix(domain, ".")))
+		}
+
+		u.interstitial = policy
+	}
+}
+
+func (p *interstitialPolicy) allowed(destination string) bool {
+	destinationURL, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(destinationURL.Hostname())
+
+	for _, domain := range p.allowedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requiresInterstitial checks the destination first, so that the role of
+// the creator is only looked up for links that would show the warning. The
+// role is checked on every visit, so it no longer counts once revoked.
+func (u *LinkUseCase) requiresInterstitial(ctx context.Context, storedLink *model.StoredLink, destination string) bool {
+	policy := u.interstitial
+
+	if policy.allowed(destination) {
+		return false
+	}
+
+	if policy.trustedRole == "" || storedLink.WorkspaceID == "" {
+		return true
+	}
+
+	member, err := u.repo.GetMember(ctx, storedLink.WorkspaceID, storedLink.UserID)
+	if err != nil {
+		if !errors.Is(err, model.ErrNotFound) {
+			u.logger.Error("Failed to get link creator role", slog.String("hash", storedLink.Hash), slog.Any("error", err))
+		}
+
+		return true
+	}
+
+	return !member.Role.Allows(policy.trustedRole)
+}
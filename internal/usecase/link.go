@@ -2,50 +2,183 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/maxpain/shortener/internal/model"
 )
 
+// exportPageSize is how many links an export loads at a time.
+const exportPageSize = 1000
+
 type Repository interface {
 	io.Closer
+	DomainRepository
+	WorkspaceRepository
+	UserRepository
+	TokenRepository
+	APIKeyRepository
+	CounterRepository
 
-	GetLink(ctx context.Context, hash string) (*model.StoredLink, error)
+	GetLink(ctx context.Context, domain string, hash string) (*model.StoredLink, error)
 	GetUserLinks(ctx context.Context, userID string) ([]*model.StoredLink, error)
+	// GetUserLinksAfter pages through the links of the user ordered by
+	// domain and hash, returning up to limit links after the given ones.
+	GetUserLinksAfter(ctx context.Context, userID string, afterDomain string, afterHash string, limit int) ([]*model.StoredLink, error)
 	SaveLinks(ctx context.Context, links []*model.StoredLink) ([]bool, error)
-	MarkForDeletion(hashes []string, userID string) error
+	MarkForDeletion(domain string, hashes []string, userID string) error
+	SaveLinkMetadata(ctx context.Context, domain string, hash string, metadata *model.Metadata) error
+	RecordClick(ctx context.Context, domain string, hash string, variant string) error
+	GetLinkStats(ctx context.Context, domain string, hash string) (*model.LinkStats, error)
 
 	Init(ctx context.Context) error
 	Ping(ctx context.Context) error
 }
 
+// GeoResolver maps client IP addresses to ISO country codes.
+type GeoResolver interface {
+	Country(ip string) (string, error)
+}
+
+// MetadataFetcher collects destination page metadata in the background.
+type MetadataFetcher interface {
+	Enqueue(domain string, hash string, url string)
+}
+
+// Metrics records how links are used. Resolve reports each redirect by
+// its outcome.
+type Metrics interface {
+	LinkResolved(outcome string)
+	LinksConflicted(count int)
+}
+
+// Redirect outcomes.
+const (
+	ResolveFound    = "found"
+	ResolveNotFound = "not_found"
+	ResolveGone     = "gone"
+	ResolveError    = "error"
+)
+
 type LinkUseCase struct {
-	logger *slog.Logger
-	repo   Repository
+	logger         *slog.Logger
+	repo           Repository
+	geo            GeoResolver
+	clock          func() time.Time
+	analytics      bool
+	metadata       MetadataFetcher
+	interstitial   *interstitialPolicy
+	redirectStatus int
+	dailyQuota     int64
+	metrics        Metrics
 }
 
-func New(repo Repository, logger *slog.Logger) *LinkUseCase {
-	return &LinkUseCase{
+type Option func(*LinkUseCase)
+
+func New(repo Repository, logger *slog.Logger, opts ...Option) *LinkUseCase {
+	u := &LinkUseCase{
 		logger: logger.With(
 			slog.String("usecase", "link"),
 		),
-		repo: repo,
+		repo:           repo,
+		clock:          time.Now,
+		redirectStatus: http.StatusTemporaryRedirect,
+	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
+}
+
+// WithClock overrides the time source used for activation window checks.
+func WithClock(clock func() time.Time) Option {
+	return func(u *LinkUseCase) {
+		u.clock = clock
+	}
+}
+
+// WithGeoResolver enables country conditions in redirect rules.
+func WithGeoResolver(geo GeoResolver) Option {
+	return func(u *LinkUseCase) {
+		u.geo = geo
+	}
+}
+
+// WithAnalytics enables click counting on every resolved redirect.
+func WithAnalytics(enabled bool) Option {
+	return func(u *LinkUseCase) {
+		u.analytics = enabled
+	}
+}
+
+// WithMetadataFetcher enables fetching metadata of newly shortened links.
+func WithMetadataFetcher(fetcher MetadataFetcher) Option {
+	return func(u *LinkUseCase) {
+		u.metadata = fetcher
+	}
+}
+
+func WithMetrics(metrics Metrics) Option {
+	return func(u *LinkUseCase) {
+		u.metrics = metrics
 	}
 }
 
+// WithDefaultRedirectStatus sets the status code of links created without one.
+func WithDefaultRedirectStatus(status int) Option {
+	return func(u *LinkUseCase) {
+		u.redirectStatus = status
+	}
+}
+
+// Shorten stores the links of the user. quotaKey identifies whom they count
+// against the daily quota, as anonymous user IDs are free to mint.
 func (u *LinkUseCase) Shorten(
 	ctx context.Context,
 	linksToShorten []*model.Link,
 	baseURL string,
 	userID string,
+	quotaKey string,
 ) ([]*model.ShortenedLink, error) {
 	linksToStore := make([]*model.StoredLink, 0, len(linksToShorten))
 	shortenedLinks := make([]*model.ShortenedLink, 0, len(linksToShorten))
 
 	for _, linkToShorten := range linksToShorten {
+		if err := linkToShorten.Validate(); err != nil {
+			return nil, fmt.Errorf("%w %s: %w", model.ErrInvalidLink, linkToShorten.OriginalURL, err)
+		}
+
+		if err := linkToShorten.ApplyUTM(); err != nil {
+			return nil, fmt.Errorf("%w %s: %w", model.ErrInvalidLink, linkToShorten.OriginalURL, err)
+		}
+
+		if err := linkToShorten.ValidateAlias(); err != nil {
+			return nil, fmt.Errorf("%w %s: %w", model.ErrInvalidLink, linkToShorten.OriginalURL, err)
+		}
+
+		if err := u.checkDomain(ctx, linkToShorten.Domain, userID); err != nil {
+			if errors.Is(err, model.ErrUnknownDomain) || errors.Is(err, model.ErrDomainNotVerified) {
+				return nil, fmt.Errorf("%w %s: %w", model.ErrInvalidLink, linkToShorten.OriginalURL, err)
+			}
+
+			return nil, err
+		}
+
+		if linkToShorten.WorkspaceID != "" {
+			if _, err := authorize(ctx, u.repo, linkToShorten.WorkspaceID, userID, model.RoleEditor); err != nil {
+				return nil, err
+			}
+		}
+
 		storedLink := linkToShorten.GetStoredLink(userID)
+		storedLink.CreatedAt = u.clock()
 		linksToStore = append(linksToStore, storedLink)
 
 		shortenedLink, err := storedLink.GetShortenedLink(baseURL)
@@ -56,20 +189,258 @@ func (u *LinkUseCase) Shorten(
 		shortenedLinks = append(shortenedLinks, shortenedLink)
 	}
 
+	release, err := u.reserveQuota(ctx, quotaKey, int64(len(linksToStore)))
+	if err != nil {
+		return nil, err
+	}
+
 	results, err := u.repo.SaveLinks(ctx, linksToStore)
 	if err != nil {
+		release(int64(len(linksToStore)))
+
 		return nil, fmt.Errorf("failed to save links: %w", err)
 	}
 
+	conflicts := 0
+
 	for i, isSaved := range results {
 		shortenedLinks[i].Saved = isSaved
+
+		if !isSaved {
+			conflicts++
+		}
+
+		if isSaved && u.metadata != nil {
+			u.metadata.Enqueue(linksToStore[i].Domain, linksToStore[i].Hash, linksToStore[i].OriginalURL)
+		}
+	}
+
+	// Links that already existed were not created
+	release(int64(conflicts))
+
+	if conflicts > 0 && u.metrics != nil {
+		u.metrics.LinksConflicted(conflicts)
 	}
 
 	return shortenedLinks, nil
 }
 
-func (u *LinkUseCase) Resolve(ctx context.Context, hash string) (string, error) {
-	storedLink, err := u.repo.GetLink(ctx, hash)
+// getActiveLink returns the link only if it can currently be followed.
+func (u *LinkUseCase) getActiveLink(ctx context.Context, host string, hash string) (*model.StoredLink, error) {
+	domain, err := u.linkDomain(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	storedLink, err := u.repo.GetLink(ctx, domain, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link from repo: %w", err)
+	}
+
+	if storedLink.IsDeleted {
+		return nil, model.ErrDeleted
+	}
+
+	if err := storedLink.CheckActive(u.clock()); err != nil {
+		return nil, err
+	}
+
+	return storedLink, nil
+}
+
+// Resolve picks the destination of the link with the hash on the domain
+// requested by host.
+func (u *LinkUseCase) Resolve(
+	ctx context.Context,
+	host string,
+	hash string,
+	visitor *model.Visitor,
+) (*model.Destination, error) {
+	destination, err := u.resolve(ctx, host, hash, visitor)
+
+	if u.metrics != nil {
+		u.metrics.LinkResolved(resolveOutcome(err))
+	}
+
+	return destination, err
+}
+
+func resolveOutcome(err error) string {
+	switch {
+	case err == nil:
+		return ResolveFound
+	case errors.Is(err, model.ErrNotFound), errors.Is(err, model.ErrNotActive):
+		return ResolveNotFound
+	case errors.Is(err, model.ErrDeleted), errors.Is(err, model.ErrExpired):
+		return ResolveGone
+	default:
+		return ResolveError
+	}
+}
+
+func (u *LinkUseCase) resolve(
+	ctx context.Context,
+	host string,
+	hash string,
+	visitor *model.Visitor,
+) (*model.Destination, error) {
+	storedLink, err := u.getActiveLink(ctx, host, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if visitor == nil {
+		visitor = &model.Visitor{}
+	}
+
+	if visitor.Path != "" && (storedLink.Passthrough == nil || !storedLink.Passthrough.Path) {
+		return nil, model.ErrNotFound
+	}
+
+	destination := u.pickDestination(storedLink, visitor)
+
+	if storedLink.Passthrough != nil {
+		destination.URL, err = storedLink.Passthrough.Apply(destination.URL, visitor.Query, visitor.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pass request through: %w", err)
+		}
+	}
+
+	destination.StatusCode = storedLink.RedirectStatus
+	destination.Cacheable = !u.analytics && len(storedLink.Rules) == 0 && len(storedLink.Variants) == 0
+	destination.NotAfter = storedLink.NotAfter
+
+	if destination.StatusCode == 0 {
+		destination.StatusCode = u.redirectStatus
+	}
+
+	if u.interstitial != nil {
+		destination.Interstitial = u.requiresInterstitial(ctx, storedLink, destination.URL)
+	}
+
+	if u.analytics {
+		err := u.repo.RecordClick(ctx, storedLink.Domain, storedLink.Hash, destination.Variant)
+		if err != nil {
+			u.logger.Error("Failed to record click", slog.String("hash", storedLink.Hash), slog.Any("error", err))
+		}
+	}
+
+	return destination, nil
+}
+
+// pickDestination applies the link rules first, then the A/B split and
+// falls back to the original URL.
+func (u *LinkUseCase) pickDestination(storedLink *model.StoredLink, visitor *model.Visitor) *model.Destination {
+	if model.NeedsCountry(storedLink.Rules) {
+		visitor.Country = u.lookupCountry(visitor.IP)
+	}
+
+	if url, ok := model.MatchRules(storedLink.Rules, visitor); ok {
+		return &model.Destination{URL: url}
+	}
+
+	variant, ok := model.FindVariant(storedLink.Variants, visitor.Variant)
+	if !ok {
+		variant, ok = model.PickVariant(storedLink.Variants, visitor.IP+"/"+storedLink.Hash)
+	}
+
+	if ok {
+		return &model.Destination{URL: variant.URL, Variant: variant.Name}
+	}
+
+	return &model.Destination{URL: storedLink.OriginalURL}
+}
+
+func (u *LinkUseCase) lookupCountry(ip string) string {
+	if u.geo == nil {
+		return ""
+	}
+
+	country, err := u.geo.Country(ip)
+	if err != nil {
+		u.logger.Debug("Failed to resolve country", slog.String("ip", ip), slog.Any("error", err))
+
+		return ""
+	}
+
+	return country
+}
+
+// Preview describes the link without following it. Click count is included
+// only when analytics are enabled.
+func (u *LinkUseCase) Preview(ctx context.Context, host string, hash string, baseURL string) (*model.LinkPreview, error) {
+	storedLink, err := u.getActiveLink(ctx, host, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	shortenedLink, err := storedLink.GetShortenedLink(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shortened link: %w", err)
+	}
+
+	createdBy, err := u.creatorLabel(ctx, storedLink)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &model.LinkPreview{
+		ShortURL:    shortenedLink.ShortURL,
+		OriginalURL: storedLink.OriginalURL,
+		CreatedBy:   createdBy,
+		CreatedAt:   storedLink.CreatedAt,
+	}
+
+	if u.analytics {
+		stats, err := u.repo.GetLinkStats(ctx, storedLink.Domain, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get link stats: %w", err)
+		}
+
+		preview.Clicks = &stats.Clicks
+	}
+
+	return preview, nil
+}
+
+// creatorLabel names the workspace of the link, or else the email domain of
+// the account that created it, as the preview is public.
+func (u *LinkUseCase) creatorLabel(ctx context.Context, storedLink *model.StoredLink) (string, error) {
+	if storedLink.WorkspaceID != "" {
+		workspace, err := u.repo.GetWorkspace(ctx, storedLink.WorkspaceID)
+		if err == nil {
+			return workspace.Name, nil
+		}
+
+		if !errors.Is(err, model.ErrNotFound) {
+			return "", fmt.Errorf("failed to get workspace: %w", err)
+		}
+	}
+
+	user, err := u.repo.GetUser(ctx, storedLink.UserID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return "anonymous", nil
+		}
+
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, domain, ok := strings.Cut(user.Email, "@"); ok {
+		return "a user at " + domain, nil
+	}
+
+	return "a registered user", nil
+}
+
+// GetShortURL returns the full short URL of an existing link.
+func (u *LinkUseCase) GetShortURL(ctx context.Context, host string, hash string, baseURL string) (string, error) {
+	domain, err := u.linkDomain(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	storedLink, err := u.repo.GetLink(ctx, domain, hash)
 	if err != nil {
 		return "", fmt.Errorf("failed to get link from repo: %w", err)
 	}
@@ -78,19 +449,29 @@ func (u *LinkUseCase) Resolve(ctx context.Context, hash string) (string, error)
 		return "", model.ErrDeleted
 	}
 
-	return storedLink.OriginalURL, nil
+	shortenedLink, err := storedLink.GetShortenedLink(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get shortened link: %w", err)
+	}
+
+	return shortenedLink.ShortURL, nil
 }
 
-func (u *LinkUseCase) GetUserLinks(ctx context.Context, baseURL string, userID string) ([]*model.UserLink, error) {
-	links, err := u.repo.GetUserLinks(ctx, userID)
+func (u *LinkUseCase) GetUserLinks(
+	ctx context.Context,
+	baseURL string,
+	userID string,
+	filter model.LinkFilter,
+) ([]*model.UserLink, error) {
+	links, err := u.getLinks(ctx, userID, filter.WorkspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user links: %w", err)
+		return nil, err
 	}
 
 	userLinks := make([]*model.UserLink, 0, len(links))
 
 	for _, link := range links {
-		if link.IsDeleted {
+		if link.IsDeleted || !filter.Matches(link) {
 			continue
 		}
 
@@ -100,16 +481,165 @@ func (u *LinkUseCase) GetUserLinks(ctx context.Context, baseURL string, userID s
 		}
 
 		userLinks = append(userLinks, &model.UserLink{
-			OriginalURL: link.OriginalURL,
-			ShortURL:    shortenedLink.ShortURL,
+			OriginalURL:    link.OriginalURL,
+			ShortURL:       shortenedLink.ShortURL,
+			NotBefore:      link.NotBefore,
+			NotAfter:       link.NotAfter,
+			Rules:          link.Rules,
+			Variants:       link.Variants,
+			Metadata:       link.Metadata,
+			RedirectStatus: link.RedirectStatus,
+			Passthrough:    link.Passthrough,
+			Campaign:       link.Campaign,
+			Domain:         link.Domain,
+			WorkspaceID:    link.WorkspaceID,
+			Tags:           link.Tags,
 		})
 	}
 
 	return userLinks, nil
 }
 
-func (u *LinkUseCase) DeleteUserLinks(hashes []string, userID string) error {
-	err := u.repo.MarkForDeletion(hashes, userID)
+// ExportUserLinks passes the links of the user to yield. Links are loaded
+// a page at a time, so exporting large accounts takes little memory.
+func (u *LinkUseCase) ExportUserLinks(
+	ctx context.Context,
+	baseURL string,
+	userID string,
+	yield func(*model.ExportedLink) error,
+) error {
+	var afterDomain, afterHash string
+
+	for {
+		links, err := u.repo.GetUserLinksAfter(ctx, userID, afterDomain, afterHash, exportPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to get user links: %w", err)
+		}
+
+		for _, link := range links {
+			if link.IsDeleted {
+				continue
+			}
+
+			shortenedLink, err := link.GetShortenedLink(baseURL)
+			if err != nil {
+				return fmt.Errorf("failed to get shortened link: %w", err)
+			}
+
+			err = yield(&model.ExportedLink{
+				OriginalURL:   link.OriginalURL,
+				ShortURL:      shortenedLink.ShortURL,
+				Alias:         link.Hash,
+				Tags:          link.Tags,
+				CorrelationID: link.CorrelationID,
+				Domain:        link.Domain,
+				CreatedAt:     link.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(links) < exportPageSize {
+			return nil
+		}
+
+		last := links[len(links)-1]
+		afterDomain, afterHash = last.Domain, last.Hash
+	}
+}
+
+func (u *LinkUseCase) GetLinkStats(ctx context.Context, host string, hash string, userID string) (*model.LinkStats, error) {
+	domain, err := u.linkDomain(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	storedLink, err := u.repo.GetLink(ctx, domain, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link from repo: %w", err)
+	}
+
+	if storedLink.IsDeleted || !u.canAccess(ctx, storedLink, userID, model.RoleViewer) {
+		return nil, model.ErrNotFound
+	}
+
+	stats, err := u.repo.GetLinkStats(ctx, domain, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// getLinks returns the links created by the user, or the links of the
+// workspace if the user may view them.
+func (u *LinkUseCase) getLinks(ctx context.Context, userID string, workspaceID string) ([]*model.StoredLink, error) {
+	if workspaceID == "" {
+		links, err := u.repo.GetUserLinks(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user links: %w", err)
+		}
+
+		return links, nil
+	}
+
+	if _, err := authorize(ctx, u.repo, workspaceID, userID, model.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	links, err := u.repo.GetWorkspaceLinks(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace links: %w", err)
+	}
+
+	return links, nil
+}
+
+// canAccess reports whether the user created the link or has at least the
+// required role in the workspace the link belongs to.
+func (u *LinkUseCase) canAccess(ctx context.Context, link *model.StoredLink, userID string, required model.Role) bool {
+	if link.UserID == userID {
+		return true
+	}
+
+	if link.WorkspaceID == "" {
+		return false
+	}
+
+	_, err := authorize(ctx, u.repo, link.WorkspaceID, userID, required)
+
+	return err == nil
+}
+
+// DeleteUserLinks deletes links on the domain of the host created by the
+// user, or links of the workspace if workspaceID is set and the user is at
+// least an editor there.
+func (u *LinkUseCase) DeleteUserLinks(
+	ctx context.Context,
+	host string,
+	hashes []string,
+	userID string,
+	workspaceID string,
+) error {
+	domain, err := u.linkDomain(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	if workspaceID != "" {
+		if _, err := authorize(ctx, u.repo, workspaceID, userID, model.RoleEditor); err != nil {
+			return err
+		}
+
+		if err := u.repo.MarkWorkspaceLinksForDeletion(domain, hashes, workspaceID); err != nil {
+			return fmt.Errorf("failed to mark workspace links for deletion: %w", err)
+		}
+
+		return nil
+	}
+
+	err = u.repo.MarkForDeletion(domain, hashes, userID)
 	if err != nil {
 		return fmt.Errorf("failed to mark links for deletion: %w", err)
 	}
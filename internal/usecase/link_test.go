@@ -0,0 +1,444 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/maxpain/shortener/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveActivationWindow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	now := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+	notBefore := now.Add(time.Hour)
+	notAfter := now.Add(2 * time.Hour)
+
+	useCase := usecase.New(repo, logger, usecase.WithClock(func() time.Time { return now }))
+
+	shortenedLinks, err := useCase.Shorten(ctx, []*model.Link{{
+		OriginalURL: "https://example.com/campaign",
+		NotBefore:   &notBefore,
+		NotAfter:    &notAfter,
+	}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err)
+	require.Len(t, shortenedLinks, 1)
+
+	hash := shortenedLinks[0].ShortURL[len("http://localhost:8080/"):]
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		expectedErr error
+	}{
+		{name: "before activation", now: now, expectedErr: model.ErrNotActive},
+		{name: "at activation", now: notBefore},
+		{name: "inside window", now: notBefore.Add(time.Minute)},
+		{name: "at expiration", now: notAfter, expectedErr: model.ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := usecase.New(repo, logger, usecase.WithClock(func() time.Time { return tt.now }))
+
+			destination, err := useCase.Resolve(ctx, "", hash, &model.Visitor{})
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/campaign", destination.URL)
+		})
+	}
+}
+
+func TestShortenInvalidActivationWindow(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	useCase := usecase.New(memoryRepository.New(nil, logger), logger)
+
+	notBefore := time.Now()
+	notAfter := notBefore.Add(-time.Hour)
+
+	_, err := useCase.Shorten(context.Background(), []*model.Link{{
+		OriginalURL: "https://example.com",
+		NotBefore:   &notBefore,
+		NotAfter:    &notAfter,
+	}}, "http://localhost:8080", "test-user-id", "test-user-id")
+
+	require.ErrorIs(t, err, model.ErrInvalidActivationWindow)
+}
+
+func TestDailyQuota(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	// Counters expire in real time, so the clock must not be in the past
+	now := model.QuotaDay(time.Now()).Add(23 * time.Hour)
+	useCase := usecase.New(repo, logger,
+		usecase.WithDailyQuota(2),
+		usecase.WithClock(func() time.Time { return now }),
+	)
+
+	_, err := useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/1"},
+		{OriginalURL: "https://example.com/2"},
+		{OriginalURL: "https://example.com/3"},
+	}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.ErrorIs(t, err, model.ErrQuotaExceeded, "batches over the quota are rejected as a whole")
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/1"}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err, "rejected batches do not use up the quota")
+
+	shortenedLinks, err := useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/1"}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err)
+	assert.False(t, shortenedLinks[0].Saved)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/2"}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err, "links that already existed do not use up the quota")
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/3"}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.ErrorIs(t, err, model.ErrQuotaExceeded)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/3"}}, "http://localhost:8080", "other-user-id", "other-user-id")
+	require.NoError(t, err, "quotas are per key")
+
+	now = now.Add(time.Hour)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{OriginalURL: "https://example.com/3"}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err, "quotas reset at midnight UTC")
+}
+
+type staticGeoResolver map[string]string
+
+func (g staticGeoResolver) Country(ip string) (string, error) {
+	return g[ip], nil
+}
+
+func TestResolveRules(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	useCase := usecase.New(repo, logger, usecase.WithGeoResolver(staticGeoResolver{
+		"81.2.69.142": "GB",
+	}))
+
+	_, err := useCase.Shorten(ctx, []*model.Link{{
+		OriginalURL: "https://example.com",
+		Rules: []model.Rule{
+			{Platform: "ios", URL: "https://apps.apple.com/app"},
+			{Country: "GB", URL: "https://example.co.uk"},
+		},
+	}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err)
+
+	hash := (&model.Link{OriginalURL: "https://example.com"}).GetStoredLink("").Hash
+
+	tests := []struct {
+		name        string
+		visitor     *model.Visitor
+		expectedURL string
+	}{
+		{
+			name:        "platform rule",
+			visitor:     &model.Visitor{UserAgent: "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X)", IP: "81.2.69.142"},
+			expectedURL: "https://apps.apple.com/app",
+		},
+		{
+			name:        "country rule",
+			visitor:     &model.Visitor{IP: "81.2.69.142"},
+			expectedURL: "https://example.co.uk",
+		},
+		{
+			name:        "fallback destination",
+			visitor:     &model.Visitor{IP: "192.0.2.1"},
+			expectedURL: "https://example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := useCase.Resolve(ctx, "", hash, tt.visitor)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, destination.URL)
+		})
+	}
+}
+
+func TestResolveVariants(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	useCase := usecase.New(repo, logger, usecase.WithAnalytics(true))
+
+	link := &model.Link{
+		OriginalURL: "https://example.com/landing",
+		Variants: []model.Variant{
+			{Name: "a", URL: "https://example.com/landing-a", Weight: 1},
+			{Name: "b", URL: "https://example.com/landing-b", Weight: 3},
+		},
+	}
+
+	_, err := useCase.Shorten(ctx, []*model.Link{link}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err)
+
+	hash := link.GetStoredLink("").Hash
+
+	first, err := useCase.Resolve(ctx, "", hash, &model.Visitor{IP: "192.0.2.10"})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.Variant)
+
+	repeated, err := useCase.Resolve(ctx, "", hash, &model.Visitor{IP: "192.0.2.10"})
+	require.NoError(t, err)
+	assert.Equal(t, first, repeated, "assignment by IP must be sticky")
+
+	sticky, err := useCase.Resolve(ctx, "", hash, &model.Visitor{IP: "192.0.2.99", Variant: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, &model.Destination{
+		URL:        "https://example.com/landing-a",
+		Variant:    "a",
+		StatusCode: http.StatusTemporaryRedirect,
+	}, sticky)
+
+	stats, err := useCase.GetLinkStats(ctx, "", hash, "test-user-id")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Clicks)
+	assert.Equal(t, int64(3), stats.Variants["a"]+stats.Variants["b"])
+	assert.GreaterOrEqual(t, stats.Variants[first.Variant], int64(2))
+
+	_, err = useCase.GetLinkStats(ctx, "", hash, "another-user-id")
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestResolveInterstitial(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	useCase := usecase.New(repo, logger,
+		usecase.WithInterstitial([]string{"example.com"}, model.RoleOwner),
+	)
+	workspaceUseCase := usecase.NewWorkspaceUseCase(repo, logger)
+
+	workspace, err := workspaceUseCase.Create(ctx, "Security", "owner-id")
+	require.NoError(t, err)
+
+	invitation, err := workspaceUseCase.Invite(ctx, workspace.ID, model.RoleEditor, "owner-id")
+	require.NoError(t, err)
+
+	_, err = workspaceUseCase.Accept(ctx, invitation.Token, "editor-id")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		url          string
+		userID       string
+		workspaceID  string
+		interstitial bool
+	}{
+		{name: "allowed domain", url: "https://example.com/page", userID: "test-user-id"},
+		{name: "allowed subdomain", url: "https://docs.example.com/page", userID: "test-user-id"},
+		{name: "lookalike domain", url: "https://badexample.com/page", userID: "test-user-id", interstitial: true},
+		{name: "external domain", url: "https://external.org/page", userID: "test-user-id", interstitial: true},
+		{name: "trusted role", url: "https://external.org/trusted", userID: "owner-id", workspaceID: workspace.ID},
+		{name: "untrusted role", url: "https://external.org/untrusted", userID: "editor-id", workspaceID: workspace.ID, interstitial: true},
+		{name: "personal link of trusted member", url: "https://external.org/personal", userID: "owner-id", interstitial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			link := &model.Link{OriginalURL: tt.url, WorkspaceID: tt.workspaceID}
+
+			_, err := useCase.Shorten(ctx, []*model.Link{link}, "http://localhost:8080", tt.userID, tt.userID)
+			require.NoError(t, err)
+
+			destination, err := useCase.Resolve(ctx, "", link.GetStoredLink("").Hash, &model.Visitor{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.url, destination.URL)
+			assert.Equal(t, tt.interstitial, destination.Interstitial)
+		})
+	}
+}
+
+func TestResolveRedirectStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	useCase := usecase.New(repo, logger, usecase.WithDefaultRedirectStatus(http.StatusFound))
+
+	defaultLink := &model.Link{OriginalURL: "https://example.com/default"}
+	permanentLink := &model.Link{OriginalURL: "https://example.com/permanent", RedirectStatus: http.StatusPermanentRedirect}
+
+	_, err := useCase.Shorten(ctx, []*model.Link{defaultLink, permanentLink}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.NoError(t, err)
+
+	destination, err := useCase.Resolve(ctx, "", defaultLink.GetStoredLink("").Hash, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, destination.StatusCode)
+	assert.True(t, destination.Cacheable)
+
+	destination, err = useCase.Resolve(ctx, "", permanentLink.GetStoredLink("").Hash, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPermanentRedirect, destination.StatusCode)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{{
+		OriginalURL:    "https://example.com/invalid",
+		RedirectStatus: http.StatusOK,
+	}}, "http://localhost:8080", "test-user-id", "test-user-id")
+	require.ErrorIs(t, err, model.ErrInvalidRedirectStatus)
+}
+
+func TestCustomDomains(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	useCase := usecase.New(repo, logger)
+	records := map[string][]string{}
+	domainUseCase := usecase.NewDomainUseCase(repo, logger,
+		usecase.WithReservedDomains("short.example"),
+		usecase.WithTXTResolver(func(_ context.Context, name string) ([]string, error) {
+			return records[name], nil
+		}),
+	)
+
+	_, err := domainUseCase.Register(ctx, "Short.Example", "brand-user-id", "")
+	require.ErrorIs(t, err, model.ErrDomainReserved, "the host of the default domain must not be taken over")
+
+	domain, err := domainUseCase.Register(ctx, "Go.Brand.Example.", "brand-user-id", "")
+	require.NoError(t, err)
+	assert.Equal(t, "go.brand.example", domain.Name)
+	assert.False(t, domain.Verified())
+
+	claim, err := domainUseCase.Register(ctx, "go.brand.example", "another-user-id", "")
+	require.NoError(t, err, "unverified domains must not be held by whoever registered them first")
+	assert.NotEqual(t, domain.VerificationToken, claim.VerificationToken)
+
+	_, err = domainUseCase.Register(ctx, "go.brand.example", "brand-user-id", "")
+	require.ErrorIs(t, err, model.ErrDomainTaken)
+
+	_, err = domainUseCase.Register(ctx, "not a domain", "brand-user-id", "")
+	require.ErrorIs(t, err, model.ErrInvalidDomain)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/shared", Domain: "go.brand.example"},
+	}, "https://short.example", "brand-user-id", "brand-user-id")
+	require.ErrorIs(t, err, model.ErrDomainNotVerified)
+
+	_, err = domainUseCase.Verify(ctx, "go.brand.example", "brand-user-id")
+	require.ErrorIs(t, err, model.ErrDomainNotVerified)
+
+	records["_shortener-challenge.go.brand.example"] = []string{"unrelated", domain.VerificationToken}
+
+	_, err = domainUseCase.Verify(ctx, "go.brand.example", "another-user-id")
+	require.ErrorIs(t, err, model.ErrDomainNotVerified, "the token of another registration must not verify it")
+
+	_, err = domainUseCase.Verify(ctx, "go.brand.example", "stranger-id")
+	require.ErrorIs(t, err, model.ErrUnknownDomain)
+
+	domain, err = domainUseCase.Verify(ctx, "go.brand.example", "brand-user-id")
+	require.NoError(t, err)
+	assert.True(t, domain.Verified())
+
+	_, err = domainUseCase.Register(ctx, "go.brand.example", "another-user-id", "")
+	require.ErrorIs(t, err, model.ErrDomainTaken, "verified domains must not be registered again")
+
+	_, err = domainUseCase.Verify(ctx, "go.brand.example", "another-user-id")
+	require.ErrorIs(t, err, model.ErrUnknownDomain, "other registrations are dropped once one is verified")
+
+	verified, err := repo.VerifyDomain(ctx, "go.brand.example", "another-user-id", time.Now())
+	require.NoError(t, err)
+	assert.False(t, verified, "only the first registration verified counts")
+
+	shortenedLinks, err := useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/shared"},
+		{OriginalURL: "https://example.com/shared", Domain: "go.brand.example"},
+	}, "https://short.example", "brand-user-id", "brand-user-id")
+	require.NoError(t, err)
+	require.Len(t, shortenedLinks, 2)
+	assert.True(t, shortenedLinks[0].Saved)
+	assert.True(t, shortenedLinks[1].Saved, "the same code must be available on another domain")
+	assert.Equal(t, "https://short.example/b47c3b", shortenedLinks[0].ShortURL)
+	assert.Equal(t, "https://go.brand.example/b47c3b", shortenedLinks[1].ShortURL)
+
+	_, err = useCase.Resolve(ctx, "go.brand.example", "b47c3b", nil)
+	require.NoError(t, err)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/other", Domain: "go.brand.example"},
+	}, "https://short.example", "another-user-id", "another-user-id")
+	require.ErrorIs(t, err, model.ErrUnknownDomain)
+	require.ErrorIs(t, err, model.ErrInvalidLink)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/default-only"},
+	}, "https://short.example", "brand-user-id", "brand-user-id")
+	require.NoError(t, err)
+
+	_, err = useCase.Resolve(ctx, "go.brand.example", "9c37bf", nil)
+	require.ErrorIs(t, err, model.ErrNotFound, "links of the default domain must not leak to custom domains")
+
+	require.NoError(t, useCase.DeleteUserLinks(ctx, "go.brand.example", []string{"b47c3b"}, "brand-user-id", ""))
+
+	_, err = useCase.Resolve(ctx, "go.brand.example", "b47c3b", nil)
+	require.ErrorIs(t, err, model.ErrDeleted)
+
+	_, err = useCase.Resolve(ctx, "short.example", "b47c3b", nil)
+	require.NoError(t, err, "the same code on another domain must survive")
+}
+
+// failingDomainRepository fails to look up domains, like a database that is down.
+type failingDomainRepository struct {
+	*memoryRepository.Repository
+}
+
+var errDatabaseDown = errors.New("database is down")
+
+func (r failingDomainRepository) GetDomain(context.Context, string) (*model.Domain, error) {
+	return nil, errDatabaseDown
+}
+
+func TestCustomDomainLookupFailure(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	useCase := usecase.New(failingDomainRepository{memoryRepository.New(nil, logger)}, logger)
+
+	_, err := useCase.Shorten(context.Background(), []*model.Link{
+		{OriginalURL: "https://example.com/shared", Domain: "go.brand.example"},
+	}, "https://short.example", "brand-user-id", "brand-user-id")
+	require.ErrorIs(t, err, errDatabaseDown)
+	assert.NotErrorIs(t, err, model.ErrInvalidLink, "lookup failures are not the client's fault")
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/maxpain/shortener/internal/model"
+)
+
+// CounterRepository keeps counters shared by all instances, e.g. for rate
+// limits and quotas. Counters are dropped after they expire.
+type CounterRepository interface {
+	// IncrementCounter adds delta to the counter and returns the new value.
+	IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error)
+}
+
+// WithDailyQuota limits how many links may be created per UTC day under the
+// quota key given to Shorten.
+func WithDailyQuota(limit int64) Option {
+	return func(u *LinkUseCase) {
+		u.dailyQuota = limit
+	}
+}
+
+// reserveQuota counts the links against the daily quota of the key. The
+// returned release gives back the given number of them if they end up not
+// being created.
+func (u *LinkUseCase) reserveQuota(ctx context.Context, quotaKey string, links int64) (func(int64), error) {
+	if u.dailyQuota <= 0 {
+		return func(int64) {}, nil
+	}
+
+	now := u.clock()
+	key := "quota:" + quotaKey + ":" + model.QuotaDay(now).Format(time.DateOnly)
+	// Kept past the reset so clock skew between instances does not matter
+	expiresAt := model.QuotaReset(now).Add(24 * time.Hour)
+
+	release := func(unused int64) {
+		if unused <= 0 {
+			return
+		}
+
+		if _, err := u.repo.IncrementCounter(ctx, key, -unused, expiresAt); err != nil {
+			u.logger.Error("Failed to release quota", slog.Any("error", err))
+		}
+	}
+
+	used, err := u.repo.IncrementCounter(ctx, key, links, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count quota: %w", err)
+	}
+
+	if used > u.dailyQuota {
+		release(links)
+
+		return nil, model.ErrQuotaExceeded
+	}
+
+	return release, nil
+}
@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxpain/shortener/internal/model"
+	"github.com/maxpain/shortener/internal/password"
+)
+
+type UserRepository interface {
+	// SaveUser returns false if the email is already registered.
+	SaveUser(ctx context.Context, user *model.User) (bool, error)
+	// SaveExternalUser creates the account of an identity provider user or
+	// updates its email, and returns the stored account.
+	SaveExternalUser(ctx context.Context, user *model.User) (*model.User, error)
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// ClaimLinks transfers all links created by one user to another and
+	// returns the number of links moved.
+	ClaimLinks(ctx context.Context, fromUserID string, toUserID string) (int64, error)
+	// ClaimWorkspacesAndDomains transfers the workspace memberships and the
+	// domains of one user to another. Memberships of workspaces the other
+	// user already belongs to are dropped.
+	ClaimWorkspacesAndDomains(ctx context.Context, fromUserID string, toUserID string) error
+}
+
+// TokenRepository keeps the IDs of revoked session tokens until the tokens
+// expire.
+type TokenRepository interface {
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+type UserUseCase struct {
+	logger *slog.Logger
+	repo   UserRepository
+	clock  func() time.Time
+	// dummyHash is verified when the email is unknown, so response times do
+	// not reveal which emails are registered.
+	dummyHash func() (string, error)
+}
+
+func NewUserUseCase(repo UserRepository, logger *slog.Logger) *UserUseCase {
+	return &UserUseCase{
+		logger: logger.With(
+			slog.String("usecase", "user"),
+		),
+		repo:  repo,
+		clock: time.Now,
+		dummyHash: sync.OnceValues(func() (string, error) {
+			return password.Hash(uuid.New().String())
+		}),
+	}
+}
+
+// SignUp registers an account and claims the links of the anonymous
+// identity the request was made with.
+func (u *UserUseCase) SignUp(ctx context.Context, email string, pass string, anonymousID string) (*model.User, error) {
+	email, err := model.NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.ValidatePassword(pass); err != nil {
+		return nil, err
+	}
+
+	hash, err := password.Hash(pass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &model.User{
+		ID:           uuid.New().String(),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    u.clock(),
+	}
+
+	saved, err := u.repo.SaveUser(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+
+	if !saved {
+		return nil, model.ErrEmailTaken
+	}
+
+	if err := u.claim(ctx, anonymousID, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Login checks the credentials and claims the links of the anonymous
+// identity the request was made with.
+func (u *UserUseCase) Login(ctx context.Context, email string, pass string, anonymousID string) (*model.User, error) {
+	email, err := model.NormalizeEmail(email)
+	if err != nil {
+		return nil, model.ErrInvalidCredentials
+	}
+
+	user, err := u.repo.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var hash string
+
+	if user != nil {
+		hash = user.PasswordHash
+	} else if hash, err = u.dummyHash(); err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+
+	ok, err := password.Verify(hash, pass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify password: %w", err)
+	}
+
+	if user == nil || !ok {
+		return nil, model.ErrInvalidCredentials
+	}
+
+	if err := u.claim(ctx, anonymousID, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// LoginExternal signs in a user authenticated by the identity provider,
+// creating the account on first login. The account ID is derived from the
+// provider subject, so it stays stable when the email changes.
+func (u *UserUseCase) LoginExternal(
+	ctx context.Context,
+	identity *model.ExternalIdentity,
+	anonymousID string,
+) (*model.User, error) {
+	// The email is informational only, providers may omit it
+	email, err := model.NormalizeEmail(identity.Email)
+	if err != nil {
+		email = ""
+	}
+
+	user, err := u.repo.SaveExternalUser(ctx, &model.User{
+		ID:        identity.UserID(),
+		Email:     email,
+		CreatedAt: u.clock(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+
+	if err := u.claim(ctx, anonymousID, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u *UserUseCase) GetUser(ctx context.Context, id string) (*model.User, error) {
+	user, err := u.repo.GetUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// claim moves the links, workspaces and domains of an anonymous identity
+// into the account. Session IDs of other accounts are left alone, so
+// logging in as someone else never steals their links.
+func (u *UserUseCase) claim(ctx context.Context, anonymousID string, userID string) error {
+	if anonymousID == "" || anonymousID == userID {
+		return nil
+	}
+
+	_, err := u.repo.GetUser(ctx, anonymousID)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	claimed, err := u.repo.ClaimLinks(ctx, anonymousID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to claim links: %w", err)
+	}
+
+	if err := u.repo.ClaimWorkspacesAndDomains(ctx, anonymousID, userID); err != nil {
+		return fmt.Errorf("failed to claim workspaces and domains: %w", err)
+	}
+
+	if claimed > 0 {
+		u.logger.Info("claimed anonymous links",
+			slog.String("user_id", userID),
+			slog.Int64("links", claimed),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package usecase_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxpain/shortener/internal/model"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/maxpain/shortener/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccounts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	useCase := usecase.New(repo, logger)
+	userUseCase := usecase.NewUserUseCase(repo, logger)
+
+	_, err := userUseCase.SignUp(ctx, "not an email", "long enough", "")
+	require.ErrorIs(t, err, model.ErrInvalidEmail)
+
+	_, err = userUseCase.SignUp(ctx, "user@example.com", "short", "")
+	require.ErrorIs(t, err, model.ErrWeakPassword)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/before-signup"},
+	}, "http://localhost:8080", "anonymous-id", "anonymous-id")
+	require.NoError(t, err)
+
+	user, err := userUseCase.SignUp(ctx, " User@Example.com ", "long enough", "anonymous-id")
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.NotEqual(t, "long enough", user.PasswordHash)
+
+	links, err := useCase.GetUserLinks(ctx, "http://localhost:8080", user.ID, model.LinkFilter{})
+	require.NoError(t, err)
+	require.Len(t, links, 1, "signup must claim the anonymous links")
+	assert.Equal(t, "https://example.com/before-signup", links[0].OriginalURL)
+
+	links, err = useCase.GetUserLinks(ctx, "http://localhost:8080", "anonymous-id", model.LinkFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	_, err = userUseCase.SignUp(ctx, "user@example.com", "another password", "")
+	require.ErrorIs(t, err, model.ErrEmailTaken)
+
+	_, err = userUseCase.Login(ctx, "user@example.com", "wrong password", "")
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = userUseCase.Login(ctx, "nobody@example.com", "long enough", "")
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/other-browser"},
+	}, "http://localhost:8080", "second-anonymous-id", "second-anonymous-id")
+	require.NoError(t, err)
+
+	other, err := userUseCase.SignUp(ctx, "other@example.com", "long enough", "")
+	require.NoError(t, err)
+
+	loggedIn, err := userUseCase.Login(ctx, "USER@example.com", "long enough", "second-anonymous-id")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+
+	_, err = userUseCase.Login(ctx, "user@example.com", "long enough", other.ID)
+	require.NoError(t, err)
+
+	links, err = useCase.GetUserLinks(ctx, "http://localhost:8080", user.ID, model.LinkFilter{})
+	require.NoError(t, err)
+	assert.Len(t, links, 2, "login must claim anonymous links but never those of other accounts")
+
+	external, err := userUseCase.LoginExternal(ctx, &model.ExternalIdentity{
+		Issuer: "https://idp.example", Subject: "idp|42", Email: "user@example.com",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "oidc:https://idp.example:idp|42", external.ID, "the user ID is derived from the provider subject")
+
+	external, err = userUseCase.LoginExternal(ctx, &model.ExternalIdentity{Issuer: "https://idp.example", Subject: "idp|42"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "oidc:https://idp.example:idp|42", external.ID)
+	assert.Empty(t, external.Email)
+
+	_, err = userUseCase.LoginExternal(ctx, &model.ExternalIdentity{
+		Issuer: "https://idp.example", Subject: user.ID, Email: "attacker@example.com",
+	}, "")
+	require.NoError(t, err)
+
+	loggedIn, err = userUseCase.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", loggedIn.Email, "a subject equal to an account ID must not take it over")
+
+	_, err = userUseCase.Login(ctx, "user@example.com", "long enough", "")
+	require.NoError(t, err, "provider accounts must not take over password logins")
+}
+
+func TestClaimWorkspacesAndDomains(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "journal.json")
+
+	open := func() *memoryRepository.Repository {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+
+		repo := memoryRepository.New(file, logger)
+		require.NoError(t, repo.Init(ctx))
+
+		return repo
+	}
+
+	repo := open()
+	userUseCase := usecase.NewUserUseCase(repo, logger)
+	workspaceUseCase := usecase.NewWorkspaceUseCase(repo, logger)
+	domainUseCase := usecase.NewDomainUseCase(repo, logger)
+
+	workspace, err := workspaceUseCase.Create(ctx, "Before signup", "anonymous-id")
+	require.NoError(t, err)
+
+	_, err = domainUseCase.Register(ctx, "go.brand.example", "anonymous-id", workspace.ID)
+	require.NoError(t, err)
+
+	user, err := userUseCase.SignUp(ctx, "user@example.com", "long enough", "anonymous-id")
+	require.NoError(t, err)
+
+	// The journal must replay the claim too
+	for _, repo := range []*memoryRepository.Repository{repo, open()} {
+		workspaceUseCase := usecase.NewWorkspaceUseCase(repo, logger)
+		domainUseCase := usecase.NewDomainUseCase(repo, logger)
+
+		workspaces, err := workspaceUseCase.GetUserWorkspaces(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, workspaces, 1, "signup must claim the anonymous workspaces")
+		assert.Equal(t, model.RoleOwner, workspaces[0].Role)
+
+		workspaces, err = workspaceUseCase.GetUserWorkspaces(ctx, "anonymous-id")
+		require.NoError(t, err)
+		assert.Empty(t, workspaces)
+
+		domains, err := domainUseCase.GetUserDomains(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, domains, 1, "signup must claim the anonymous domains")
+		assert.Equal(t, "go.brand.example", domains[0].Name)
+
+		domains, err = domainUseCase.GetUserDomains(ctx, "anonymous-id")
+		require.NoError(t, err)
+		assert.Empty(t, domains)
+	}
+}
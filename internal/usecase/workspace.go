@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxpain/shortener/internal/model"
+)
+
+const (
+	invitationTTL         = 7 * 24 * time.Hour
+	invitationTokenLength = 32
+)
+
+type WorkspaceRepository interface {
+	// CreateWorkspace stores the workspace together with its first owner.
+	CreateWorkspace(ctx context.Context, workspace *model.Workspace, owner *model.Member) error
+	GetWorkspace(ctx context.Context, id string) (*model.Workspace, error)
+	GetUserWorkspaces(ctx context.Context, userID string) ([]*model.Workspace, error)
+	GetMember(ctx context.Context, workspaceID string, userID string) (*model.Member, error)
+	GetMembers(ctx context.Context, workspaceID string) ([]*model.Member, error)
+	SaveInvitation(ctx context.Context, invitation *model.Invitation) error
+	GetInvitation(ctx context.Context, token string) (*model.Invitation, error)
+	// AcceptInvitation marks an active invitation as accepted and adds the
+	// member in one step. It returns false if the invitation is not active.
+	AcceptInvitation(ctx context.Context, token string, member *model.Member) (bool, error)
+	GetWorkspaceLinks(ctx context.Context, workspaceID string) ([]*model.StoredLink, error)
+	MarkWorkspaceLinksForDeletion(domain string, hashes []string, workspaceID string) error
+}
+
+type WorkspaceUseCase struct {
+	logger *slog.Logger
+	repo   WorkspaceRepository
+	clock  func() time.Time
+}
+
+func NewWorkspaceUseCase(repo WorkspaceRepository, logger *slog.Logger) *WorkspaceUseCase {
+	return &WorkspaceUseCase{
+		logger: logger.With(
+			slog.String("usecase", "workspace"),
+		),
+		repo:  repo,
+		clock: time.Now,
+	}
+}
+
+// Create makes a new workspace owned by the user.
+func (u *WorkspaceUseCase) Create(ctx context.Context, name string, userID string) (*model.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, model.ErrInvalidWorkspace
+	}
+
+	now := u.clock()
+	workspace := &model.Workspace{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedAt: now,
+		Role:      model.RoleOwner,
+	}
+
+	err := u.repo.CreateWorkspace(ctx, workspace, &model.Member{
+		WorkspaceID: workspace.ID,
+		UserID:      userID,
+		Role:        model.RoleOwner,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func (u *WorkspaceUseCase) GetUserWorkspaces(ctx context.Context, userID string) ([]*model.Workspace, error) {
+	workspaces, err := u.repo.GetUserWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user workspaces: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+// GetMembers lists the members of a workspace to any of its members.
+func (u *WorkspaceUseCase) GetMembers(ctx context.Context, workspaceID string, userID string) ([]*model.Member, error) {
+	if _, err := authorize(ctx, u.repo, workspaceID, userID, model.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	members, err := u.repo.GetMembers(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %w", err)
+	}
+
+	return members, nil
+}
+
+// Invite creates a single-use invitation. Only owners may invite.
+func (u *WorkspaceUseCase) Invite(
+	ctx context.Context,
+	workspaceID string,
+	role model.Role,
+	userID string,
+) (*model.Invitation, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := authorize(ctx, u.repo, workspaceID, userID, model.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(invitationTokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	now := u.clock()
+	invitation := &model.Invitation{
+		Token:       token,
+		WorkspaceID: workspaceID,
+		Role:        role,
+		InvitedBy:   userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(invitationTTL),
+	}
+
+	if err := u.repo.SaveInvitation(ctx, invitation); err != nil {
+		return nil, fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// Accept adds the user to the workspace of the invitation. Existing members
+// keep their current role.
+func (u *WorkspaceUseCase) Accept(ctx context.Context, token string, userID string) (*model.Member, error) {
+	invitation, err := u.repo.GetInvitation(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	now := u.clock()
+
+	if !invitation.IsActive(now) {
+		return nil, model.ErrInvitationInactive
+	}
+
+	member, err := u.repo.GetMember(ctx, invitation.WorkspaceID, userID)
+	if err == nil {
+		return member, nil
+	}
+
+	if !errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	member = &model.Member{
+		WorkspaceID: invitation.WorkspaceID,
+		UserID:      userID,
+		Role:        invitation.Role,
+		CreatedAt:   now,
+	}
+
+	accepted, err := u.repo.AcceptInvitation(ctx, token, member)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if !accepted {
+		return nil, model.ErrInvitationInactive
+	}
+
+	return member, nil
+}
+
+// authorize checks that the user is a member of the workspace with at least
+// the required role.
+func authorize(
+	ctx context.Context,
+	repo WorkspaceRepository,
+	workspaceID string,
+	userID string,
+	required model.Role,
+) (*model.Member, error) {
+	member, err := repo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, model.ErrForbidden
+		}
+
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	if !member.Role.Allows(required) {
+		return nil, model.ErrForbidden
+	}
+
+	return member, nil
+}
+
+func generateToken(length int) (string, error) {
+	token := make([]byte, length)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return hex.EncodeToString(token), nil
+}
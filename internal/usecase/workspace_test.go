@@ -0,0 +1,105 @@
+package usecase_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/maxpain/shortener/internal/model"
+	memoryRepository "github.com/maxpain/shortener/internal/repository/memory"
+	"github.com/maxpain/shortener/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaces(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := memoryRepository.New(nil, logger)
+	require.NoError(t, repo.Init(ctx))
+
+	useCase := usecase.New(repo, logger)
+	workspaceUseCase := usecase.NewWorkspaceUseCase(repo, logger)
+
+	_, err := workspaceUseCase.Create(ctx, " ", "owner-id")
+	require.ErrorIs(t, err, model.ErrInvalidWorkspace)
+
+	workspace, err := workspaceUseCase.Create(ctx, "Marketing", "owner-id")
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleOwner, workspace.Role)
+
+	_, err = workspaceUseCase.Invite(ctx, workspace.ID, "admin", "owner-id")
+	require.ErrorIs(t, err, model.ErrInvalidRole)
+
+	_, err = workspaceUseCase.Invite(ctx, workspace.ID, model.RoleEditor, "stranger-id")
+	require.ErrorIs(t, err, model.ErrForbidden)
+
+	editorInvitation, err := workspaceUseCase.Invite(ctx, workspace.ID, model.RoleEditor, "owner-id")
+	require.NoError(t, err)
+
+	viewerInvitation, err := workspaceUseCase.Invite(ctx, workspace.ID, model.RoleViewer, "owner-id")
+	require.NoError(t, err)
+
+	member, err := workspaceUseCase.Accept(ctx, editorInvitation.Token, "editor-id")
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleEditor, member.Role)
+
+	_, err = workspaceUseCase.Accept(ctx, editorInvitation.Token, "another-id")
+	require.ErrorIs(t, err, model.ErrInvitationInactive, "invitations are single-use")
+
+	_, err = workspaceUseCase.Accept(ctx, viewerInvitation.Token, "viewer-id")
+	require.NoError(t, err)
+
+	_, err = workspaceUseCase.Invite(ctx, workspace.ID, model.RoleViewer, "editor-id")
+	require.ErrorIs(t, err, model.ErrForbidden, "only owners may invite")
+
+	members, err := workspaceUseCase.GetMembers(ctx, workspace.ID, "viewer-id")
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	workspaces, err := workspaceUseCase.GetUserWorkspaces(ctx, "viewer-id")
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+	assert.Equal(t, model.RoleViewer, workspaces[0].Role)
+
+	_, err = useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/viewer", WorkspaceID: workspace.ID},
+	}, "http://localhost:8080", "viewer-id", "viewer-id")
+	require.ErrorIs(t, err, model.ErrForbidden)
+
+	shortenedLinks, err := useCase.Shorten(ctx, []*model.Link{
+		{OriginalURL: "https://example.com/team", WorkspaceID: workspace.ID},
+	}, "http://localhost:8080", "editor-id", "editor-id")
+	require.NoError(t, err)
+	require.Len(t, shortenedLinks, 1)
+
+	hash := shortenedLinks[0].ShortURL[len("http://localhost:8080/"):]
+	filter := model.LinkFilter{WorkspaceID: workspace.ID}
+
+	links, err := useCase.GetUserLinks(ctx, "http://localhost:8080", "owner-id", filter)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "https://example.com/team", links[0].OriginalURL)
+
+	_, err = useCase.GetUserLinks(ctx, "http://localhost:8080", "stranger-id", filter)
+	require.ErrorIs(t, err, model.ErrForbidden)
+
+	preview, err := useCase.Preview(ctx, "", hash, "http://localhost:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "Marketing", preview.CreatedBy, "previews name the workspace instead of its members")
+
+	_, err = useCase.GetLinkStats(ctx, "", hash, "viewer-id")
+	require.NoError(t, err)
+
+	err = useCase.DeleteUserLinks(ctx, "", []string{hash}, "viewer-id", workspace.ID)
+	require.ErrorIs(t, err, model.ErrForbidden)
+
+	err = useCase.DeleteUserLinks(ctx, "", []string{hash}, "owner-id", workspace.ID)
+	require.NoError(t, err)
+
+	_, err = useCase.Resolve(ctx, "", hash, nil)
+	require.ErrorIs(t, err, model.ErrDeleted)
+}